@@ -0,0 +1,207 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+// Metrics of the requests that abort rules can watch, besides monitor.<metric>.
+const (
+	AbortErrorRate  = "error_rate"
+	AbortP99        = "p99"
+	AbortThroughput = "throughput"
+)
+
+const monitorMetricPrefix = "monitor."
+
+// defaultAbortWindow is the rolling window abort rules use by default.
+const defaultAbortWindow = time.Second * 30
+
+const abortCheckInterval = time.Second
+
+type AbortRule struct {
+	Metric string
+	// Below makes the rule fire when the metric falls below Threshold.
+	Below     bool
+	Threshold float64
+}
+
+// ParseAbortRule parses a rule like "error_rate>5%", "p99>2s" or "monitor.close_wait>500".
+func ParseAbortRule(s string) (*AbortRule, error) {
+	i := strings.IndexAny(s, "<>")
+	if i < 0 {
+		return nil, errors.Errorf("abort rule %q should look like metric>threshold or metric<threshold", s)
+	}
+
+	rule := &AbortRule{
+		Metric: strings.TrimSpace(s[:i]),
+		Below:  s[i] == '<',
+	}
+	value := strings.TrimSpace(s[i+1:])
+
+	var err error
+	switch {
+	case rule.Metric == AbortErrorRate:
+		if strings.HasSuffix(value, "%") {
+			rule.Threshold, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			rule.Threshold /= 100
+		} else {
+			rule.Threshold, err = strconv.ParseFloat(value, 64)
+		}
+		if err == nil && (rule.Threshold < 0 || rule.Threshold > 1) {
+			return nil, errors.Errorf("abort rule %q - the error rate should be between 0%% and 100%%", s)
+		}
+	case rule.Metric == AbortP99:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		rule.Threshold = d.Seconds()
+	case rule.Metric == AbortThroughput:
+		rule.Threshold, err = strconv.ParseFloat(strings.TrimSuffix(value, "/s"), 64)
+	case strings.HasPrefix(rule.Metric, monitorMetricPrefix):
+		if !sqlite.IsMonitorMetric(strings.TrimPrefix(rule.Metric, monitorMetricPrefix)) {
+			return nil, errors.Errorf("abort rule %q - unknown monitor metric %s", s, rule.Metric)
+		}
+		rule.Threshold, err = strconv.ParseFloat(value, 64)
+	default:
+		return nil, errors.Errorf("abort rule %q - unknown metric %s", s, rule.Metric)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "abort rule %q has an invalid threshold", s)
+	}
+
+	return rule, nil
+}
+
+func (r *AbortRule) String() string {
+	op := ">"
+	if r.Below {
+		op = "<"
+	}
+	return r.Metric + op + r.format(r.Threshold)
+}
+
+func (r *AbortRule) format(value float64) string {
+	switch r.Metric {
+	case AbortErrorRate:
+		return strconv.FormatFloat(value*100, 'f', -1, 64) + "%"
+	case AbortP99:
+		return time.Duration(value * float64(time.Second)).String()
+	case AbortThroughput:
+		return strconv.FormatFloat(value, 'f', -1, 64) + "/s"
+	default:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+}
+
+func (r *AbortRule) formatMeasured(value float64) string {
+	switch r.Metric {
+	case AbortErrorRate:
+		return fmt.Sprintf("%.2f%%", value*100)
+	case AbortP99:
+		return time.Duration(value * float64(time.Second)).Round(time.Millisecond).String()
+	case AbortThroughput:
+		return fmt.Sprintf("%.1f/s", value)
+	default:
+		return r.format(value)
+	}
+}
+
+func (r *AbortRule) crossed(value float64) bool {
+	if r.Below {
+		return value < r.Threshold
+	}
+	return value > r.Threshold
+}
+
+// ruleViolation is the cause a run is cancelled with when an abort rule fires.
+type ruleViolation struct {
+	rule   *AbortRule
+	time   time.Time
+	reason string
+}
+
+func (v *ruleViolation) Error() string {
+	return v.reason
+}
+
+type abortWatcher struct {
+	rules  []*AbortRule
+	window *rollingWindow
+	db     *sqlite.DataStore
+	run    *sqlite.Run
+}
+
+// watch calls abort with the first rule that fires once the run is a window old.
+func (w *abortWatcher) watch(stopReciever *util.StopReciever, abort context.CancelCauseFunc) {
+	defer stopReciever.Done()
+
+	ticker := time.NewTicker(abortCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopReciever.ShouldStopC:
+			return
+		}
+
+		now := time.Now().UTC()
+		if now.Sub(w.run.StartTime) < w.window.window {
+			continue
+		}
+
+		violation := w.check(now)
+		if violation != nil {
+			log.Println(fmt.Sprintf("abort rule %s fired: %s", violation.rule, violation.reason))
+			abort(violation)
+			return
+		}
+	}
+}
+
+// check returns the first rule the window crosses, logging rules it can't evaluate.
+func (w *abortWatcher) check(now time.Time) *ruleViolation {
+	stats := w.window.stats(now)
+
+	for _, rule := range w.rules {
+		value, ok, err := w.value(rule, stats, now)
+		if err != nil {
+			log.Println(fmt.Sprintf("abort rule %s couldn't be evaluated: %v", rule, err))
+			continue
+		}
+		if !ok || !rule.crossed(value) {
+			continue
+		}
+
+		return &ruleViolation{
+			rule:   rule,
+			time:   now,
+			reason: fmt.Sprintf("%s - it was %s over the last %v", rule, rule.formatMeasured(value), w.window.window),
+		}
+	}
+
+	return nil
+}
+
+// value returns the rule's metric over the window, or ok false if there's nothing to measure.
+func (w *abortWatcher) value(rule *AbortRule, stats *windowStats, now time.Time) (value float64, ok bool, err error) {
+	switch rule.Metric {
+	case AbortErrorRate:
+		return stats.ErrorRate, stats.Requests > 0, nil
+	case AbortP99:
+		return stats.P99.Seconds(), stats.Requests > 0, nil
+	case AbortThroughput:
+		return stats.Throughput, true, nil
+	default:
+		metric := strings.TrimPrefix(rule.Metric, monitorMetricPrefix)
+		return w.db.GetMonitorMetric(context.Background(), metric, now.Add(-w.window.window))
+	}
+}
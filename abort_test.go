@@ -0,0 +1,129 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAbortRule(t *testing.T) {
+	tests := []struct {
+		spec string
+		rule AbortRule
+		str  string
+	}{
+		{"error_rate>5%", AbortRule{Metric: AbortErrorRate, Threshold: 0.05}, "error_rate>5%"},
+		{"error_rate > 0.5", AbortRule{Metric: AbortErrorRate, Threshold: 0.5}, "error_rate>50%"},
+		{"p99>2s", AbortRule{Metric: AbortP99, Threshold: 2}, "p99>2s"},
+		{"p99 > 250ms", AbortRule{Metric: AbortP99, Threshold: 0.25}, "p99>250ms"},
+		{"throughput<100", AbortRule{Metric: AbortThroughput, Below: true, Threshold: 100}, "throughput<100/s"},
+		{"throughput<12.5/s", AbortRule{Metric: AbortThroughput, Below: true, Threshold: 12.5}, "throughput<12.5/s"},
+		{"monitor.close_wait>500", AbortRule{Metric: "monitor.close_wait", Threshold: 500}, "monitor.close_wait>500"},
+	}
+	for _, test := range tests {
+		rule, err := ParseAbortRule(test.spec)
+		require.NoError(t, err, test.spec)
+		require.Equal(t, test.rule, *rule, test.spec)
+		require.Equal(t, test.str, rule.String(), test.spec)
+	}
+
+	for _, spec := range []string{
+		"error_rate",
+		"error_rate>150%",
+		"latency>2s",
+		"p99>2",
+		"throughput<lots",
+		"monitor.id>1",
+	} {
+		_, err := ParseAbortRule(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestAbortWatcherCheck(t *testing.T) {
+	now := time.Now().UTC()
+	w := &abortWatcher{
+		rules: []*AbortRule{
+			{Metric: AbortP99, Threshold: 1},
+			{Metric: AbortErrorRate, Threshold: 0.1},
+		},
+		window: newRollingWindow(time.Second * 10),
+	}
+
+	// A window without requests has no error rate or p99.
+	violation := w.check(now)
+	require.Nil(t, violation)
+
+	for i := 0; i < 9; i++ {
+		w.window.add(now.Add(-time.Millisecond*100), now, true, "")
+	}
+	w.window.add(now.Add(-time.Millisecond*100), now, false, sqlite.ErrorCategoryTimeout)
+	violation = w.check(now)
+	require.Nil(t, violation)
+
+	w.window.add(now.Add(-time.Millisecond*100), now, false, sqlite.ErrorCategoryTimeout)
+	violation = w.check(now)
+	require.NotNil(t, violation)
+	require.Equal(t, w.rules[1], violation.rule)
+	require.Equal(t, now, violation.time)
+	require.Equal(t, "error_rate>10% - it was 18.18% over the last 10s", violation.Error())
+}
+
+func TestAbortWatcherCheckFailingRule(t *testing.T) {
+	// The monitor's tables don't exist, so its metrics can't be read.
+	data, err := sqlite.NewDataStore(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer data.Close()
+
+	now := time.Now().UTC()
+	w := &abortWatcher{
+		rules: []*AbortRule{
+			{Metric: "monitor.close_wait", Threshold: 500},
+			{Metric: AbortThroughput, Below: true, Threshold: 100},
+		},
+		window: newRollingWindow(time.Second * 10),
+		db:     data,
+	}
+
+	violation := w.check(now)
+	require.NotNil(t, violation)
+	require.Equal(t, w.rules[1], violation.rule)
+}
+
+func TestGenerateLoadAbortRule(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:   filepath.Join(t.TempDir(), "test.db"),
+		RunID:        util.NewID(),
+		NumWorkers:   2,
+		TestDuration: time.Second * 30,
+		AbortRules: []*AbortRule{
+			{Metric: AbortThroughput, Below: true, Threshold: 1},
+			{Metric: AbortErrorRate, Threshold: 0.5},
+		},
+		AbortWindow: time.Millisecond * 500,
+	}
+
+	start := time.Now()
+	err := GenerateLoad(context.Background(), config, func(ctx context.Context, _ int) (*RequestResult, error) {
+		time.Sleep(time.Millisecond)
+		return nil, errors.New("connection refused")
+	})
+	require.True(t, time.Since(start) < time.Second*5)
+
+	abortErr, ok := errors.Cause(err).(*AbortError)
+	require.True(t, ok, "%v", err)
+	require.Equal(t, "throughput<1/s", abortErr.Rule)
+
+	status := getTestRunStatus(t, config)
+	require.Equal(t, sqlite.RunStatusAborted, status.Status)
+	require.Equal(t, "throughput<1/s", status.AbortRule)
+	require.Equal(t, "throughput<1/s - it was 0.0/s over the last 500ms", status.AbortReason)
+	require.NotNil(t, status.AbortTime)
+	require.True(t, status.AbortTime.Sub(start) >= config.AbortWindow)
+}
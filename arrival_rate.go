@@ -0,0 +1,115 @@
+package webservice_benchmarks
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+)
+
+// maxScheduleWait bounds how long the scheduler sleeps before checking the rate.
+const maxScheduleWait = time.Millisecond * 100
+
+// rateScheduler produces intended send times at a rate that can change while it runs.
+type rateScheduler struct {
+	rateBits       uint64
+	intendedStarts chan time.Time
+	stopSender     *util.StopSender
+}
+
+func newRateScheduler() *rateScheduler {
+	return &rateScheduler{
+		intendedStarts: make(chan time.Time),
+		stopSender:     util.NewStopSender(),
+	}
+}
+
+func (s *rateScheduler) start() {
+	go s.schedule(s.stopSender.NewReciever())
+}
+
+func (s *rateScheduler) stopAndWait() {
+	s.stopSender.StopAndWait()
+}
+
+func (s *rateScheduler) setRate(rate float64) {
+	atomic.StoreUint64(&s.rateBits, math.Float64bits(rate))
+}
+
+func (s *rateScheduler) rate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.rateBits))
+}
+
+func (s *rateScheduler) schedule(stopReciever *util.StopReciever) {
+	defer stopReciever.Done()
+
+	last := time.Now().UTC()
+	sentAny := false
+
+	for {
+		rate := s.rate()
+
+		var next time.Time
+		switch {
+		case rate <= 0:
+			// Nothing is scheduled while the rate is 0. Restart the schedule
+			// from now once it is raised so the pause isn't made up for.
+			sentAny = false
+			next = time.Now().UTC().Add(maxScheduleWait)
+		case !sentAny:
+			next = time.Now().UTC()
+		default:
+			next = last.Add(time.Duration(float64(time.Second) / rate))
+		}
+
+		wait := time.Until(next)
+		if wait > maxScheduleWait {
+			wait = maxScheduleWait
+		}
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-stopReciever.ShouldStopC:
+				timer.Stop()
+				return
+			}
+		}
+
+		if rate <= 0 || time.Now().Before(next) {
+			continue
+		}
+
+		select {
+		case s.intendedStarts <- next:
+		case <-stopReciever.ShouldStopC:
+			return
+		}
+
+		last = next
+		sentAny = true
+	}
+}
+
+func sendScheduledRequests(
+	stopReciever *util.StopReciever,
+	sender *requestSender,
+	workerID int,
+	intendedStarts <-chan time.Time) {
+
+	defer stopReciever.Done()
+	atomic.AddInt64(&sender.workers, 1)
+	defer atomic.AddInt64(&sender.workers, -1)
+
+	for {
+		select {
+		case intendedStart := <-intendedStarts:
+			if !sender.send(workerID, intendedStart) {
+				return
+			}
+		case <-stopReciever.ShouldStopC:
+			return
+		}
+	}
+}
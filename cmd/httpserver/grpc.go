@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/grpcwire"
+)
+
+// grpcServicePath is the path prefix of the methods in benchmark.proto.
+const grpcServicePath = "/benchmarks.Benchmark/"
+
+// grpcStatus is a gRPC status a call ends with.
+type grpcStatus struct {
+	code    grpcwire.Code
+	message string
+}
+
+// grpcMethod handles a call, sending its replies through send.
+type grpcMethod func(req []byte, send func(msg []byte) error) *grpcStatus
+
+var grpcMethods = map[string]grpcMethod{
+	"Time":   grpcTime,
+	"Prime":  grpcPrime,
+	"Primes": grpcPrimes,
+}
+
+// serveGRPC serves the benchmark service, which needs --tls or --h2c.
+func serveGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 ||
+		!strings.HasPrefix(r.Header.Get("Content-Type"), grpcwire.ContentType) {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		w.Write([]byte("expected a gRPC call over HTTP/2"))
+		return
+	}
+
+	w.Header().Set("Content-Type", grpcwire.ContentType)
+	w.WriteHeader(http.StatusOK)
+
+	status := callGRPC(w, r)
+	w.Header().Set(http.TrailerPrefix+grpcwire.StatusHeader, strconv.Itoa(int(status.code)))
+	if status.message != "" {
+		w.Header().Set(http.TrailerPrefix+grpcwire.MessageHeader, status.message)
+	}
+}
+
+func callGRPC(w http.ResponseWriter, r *http.Request) *grpcStatus {
+	method, ok := grpcMethods[strings.TrimPrefix(r.URL.Path, grpcServicePath)]
+	if !ok {
+		return &grpcStatus{grpcwire.Unimplemented, "unknown method " + r.URL.Path}
+	}
+
+	req, err := grpcwire.ReadMessage(r.Body)
+	if err != nil {
+		return &grpcStatus{grpcwire.Internal, err.Error()}
+	}
+
+	flusher, _ := w.(http.Flusher)
+	return method(req, func(msg []byte) error {
+		err := grpcwire.WriteMessage(w, msg)
+		if err == nil && flusher != nil {
+			flusher.Flush()
+		}
+		return err
+	})
+}
+
+func grpcTime(_ []byte, send func(msg []byte) error) *grpcStatus {
+	reply := grpcwire.AppendBytes(nil, 1, []byte(time.Now().String()))
+	if err := send(reply); err != nil {
+		return &grpcStatus{grpcwire.Unavailable, err.Error()}
+	}
+	return &grpcStatus{code: grpcwire.OK}
+}
+
+func grpcPrime(req []byte, send func(msg []byte) error) *grpcStatus {
+	n, status := parsePrimeRequest(req)
+	if status != nil {
+		return status
+	}
+
+	reply := grpcwire.AppendVarint(nil, 1, uint64(calcNthPrime(n)))
+	if err := send(reply); err != nil {
+		return &grpcStatus{grpcwire.Unavailable, err.Error()}
+	}
+	return &grpcStatus{code: grpcwire.OK}
+}
+
+func grpcPrimes(req []byte, send func(msg []byte) error) *grpcStatus {
+	n, status := parsePrimeRequest(req)
+	if status != nil {
+		return status
+	}
+
+	for i, sent := 2, 0; sent < n; i++ {
+		if !isPrime(i) {
+			continue
+		}
+		if err := send(grpcwire.AppendVarint(nil, 1, uint64(i))); err != nil {
+			return &grpcStatus{grpcwire.Unavailable, err.Error()}
+		}
+		sent++
+	}
+	return &grpcStatus{code: grpcwire.OK}
+}
+
+// parsePrimeRequest returns n of a PrimeRequest.
+func parsePrimeRequest(req []byte) (int, *grpcStatus) {
+	fields, err := grpcwire.ParseFields(req)
+	if err != nil {
+		return 0, &grpcStatus{grpcwire.InvalidArgument, err.Error()}
+	}
+
+	n := 0
+	for _, field := range fields {
+		if field.Number == 1 && field.WireType == grpcwire.WireVarint {
+			n = int(int64(field.Varint))
+		}
+	}
+	if n < 1 {
+		return 0, &grpcStatus{grpcwire.InvalidArgument, fmt.Sprintf("n should be at least 1, got %d", n)}
+	}
+	return n, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jlym/webservice-benchmarks/grpcwire"
+	"github.com/stretchr/testify/require"
+)
+
+// callTestGRPC calls method with the request message and returns the reply
+// messages and the status the call ended with.
+func callTestGRPC(t *testing.T, server *httptest.Server, method string, req []byte) ([][]byte, grpcwire.Code) {
+	body := &bytes.Buffer{}
+	require.NoError(t, grpcwire.WriteMessage(body, req))
+	httpReq, err := http.NewRequest(http.MethodPost, server.URL+grpcServicePath+method, body)
+	require.NoError(t, err)
+	httpReq.Header.Set("Content-Type", grpcwire.ContentType)
+
+	resp, err := server.Client().Do(httpReq)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var replies [][]byte
+	r := bytes.NewReader(respBody)
+	for r.Len() > 0 {
+		msg, err := grpcwire.ReadMessage(r)
+		require.NoError(t, err)
+		replies = append(replies, msg)
+	}
+
+	code, _, err := grpcwire.ResponseStatus(resp)
+	require.NoError(t, err)
+	return replies, code
+}
+
+func replyVarints(t *testing.T, replies [][]byte) []uint64 {
+	values := make([]uint64, 0, len(replies))
+	for _, reply := range replies {
+		fields, err := grpcwire.ParseFields(reply)
+		require.NoError(t, err)
+		require.Len(t, fields, 1)
+		values = append(values, fields[0].Varint)
+	}
+	return values
+}
+
+func TestServeGRPC(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(serveGRPC))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	replies, code := callTestGRPC(t, server, "Time", nil)
+	require.Equal(t, grpcwire.OK, code)
+	require.Len(t, replies, 1)
+	fields, err := grpcwire.ParseFields(replies[0])
+	require.NoError(t, err)
+	require.Equal(t, grpcwire.WireBytes, fields[0].WireType)
+	require.NotEmpty(t, fields[0].Bytes)
+
+	replies, code = callTestGRPC(t, server, "Prime", grpcwire.AppendVarint(nil, 1, 10))
+	require.Equal(t, grpcwire.OK, code)
+	require.Equal(t, []uint64{29}, replyVarints(t, replies))
+
+	replies, code = callTestGRPC(t, server, "Primes", grpcwire.AppendVarint(nil, 1, 4))
+	require.Equal(t, grpcwire.OK, code)
+	require.Equal(t, []uint64{2, 3, 5, 7}, replyVarints(t, replies))
+
+	_, code = callTestGRPC(t, server, "Prime", nil)
+	require.Equal(t, grpcwire.InvalidArgument, code)
+	_, code = callTestGRPC(t, server, "Missing", nil)
+	require.Equal(t, grpcwire.Unimplemented, code)
+}
+
+func TestServeGRPCNotHTTP2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serveGRPC))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+grpcServicePath+"Time", grpcwire.ContentType, nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
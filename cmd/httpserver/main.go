@@ -1,24 +1,192 @@
 package main
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
+
+	"github.com/jlym/webservice-benchmarks/websocket"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
 )
 
 func main() {
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "addr",
+			Usage: "The TCP address to listen on. Empty to only listen on the unix socket.",
+			Value: ":8080",
+		},
+		cli.StringFlag{
+			Name:  "unix-socket",
+			Usage: "The path of a unix domain socket to listen on, as well as or instead of the TCP address.",
+		},
+		cli.BoolFlag{
+			Name:  "tls",
+			Usage: "Serve TLS. Without a certificate and key, a self-signed certificate is generated.",
+		},
+		cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "Path to the PEM encoded certificate to serve TLS with.",
+		},
+		cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "Path to the PEM encoded key of the certificate.",
+		},
+		cli.BoolTFlag{
+			Name:  "http2",
+			Usage: "Offer HTTP/2 to TLS clients. Set to false to only serve HTTP/1.1.",
+		},
+		cli.BoolFlag{
+			Name:  "h2c",
+			Usage: "Serve cleartext HTTP/2 to clients that start with it, as well as HTTP/1.1.",
+		},
+	}
+	app.Action = func(c *cli.Context) error {
+		return serve(getConfig(c))
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type config struct {
+	addr       string
+	socketPath string
+	tls        bool
+	certFile   string
+	keyFile    string
+	http2      bool
+	h2c        bool
+}
+
+func getConfig(c *cli.Context) *config {
+	return &config{
+		addr:       c.String("addr"),
+		socketPath: c.String("unix-socket"),
+		tls:        c.Bool("tls"),
+		certFile:   c.String("tls-cert"),
+		keyFile:    c.String("tls-key"),
+		http2:      c.BoolT("http2"),
+		h2c:        c.Bool("h2c"),
+	}
+}
+
+// protocols returns the protocols the server speaks.
+func (conf *config) protocols() *http.Protocols {
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(conf.tls && conf.http2)
+	protocols.SetUnencryptedHTTP2(conf.h2c)
+	return protocols
+}
+
+func serve(conf *config) error {
+	if conf.tls && conf.h2c {
+		return errors.New("h2c is cleartext HTTP/2, it can't be used with tls")
+	}
+	if conf.h2c && !conf.http2 {
+		return errors.New("h2c can't be used with HTTP/2 disabled")
+	}
+
+	listeners, err := listen(conf.addr, conf.socketPath)
+	if err != nil {
+		return err
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/time", serveTime)
 	mux.HandleFunc("/prime", servePrime)
+	mux.HandleFunc(grpcServicePath, serveGRPC)
+	mux.HandleFunc("/echo", serveEcho)
 
-	s := http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+	s := &http.Server{
+		Handler:   mux,
+		Protocols: conf.protocols(),
 	}
-	log.Println("Serving")
-	s.ListenAndServe()
+
+	if conf.tls {
+		cert, err := loadCertificate(conf.certFile, conf.keyFile)
+		if err != nil {
+			return err
+		}
+		s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		log.Println(fmt.Sprintf("Serving on %s %s (tls: %t, protocols: %s)",
+			l.Addr().Network(), l.Addr(), conf.tls, s.Protocols))
+		go func(l net.Listener) {
+			if conf.tls {
+				// The certificate is in TLSConfig already.
+				errs <- s.ServeTLS(l, "", "")
+				return
+			}
+			errs <- s.Serve(l)
+		}(l)
+	}
+	return <-errs
+}
+
+// listen opens a listener on the TCP address and the unix socket, skipping empty ones.
+func listen(addr, socketPath string) ([]net.Listener, error) {
+	if addr == "" && socketPath == "" {
+		return nil, errors.New("expected a TCP address or a unix socket to listen on")
+	}
+
+	var listeners []net.Listener
+	if addr != "" {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "listening on tcp failed")
+		}
+		listeners = append(listeners, l)
+	}
+
+	if socketPath != "" {
+		l, err := listenUnix(socketPath)
+		if err != nil {
+			for _, other := range listeners {
+				other.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// listenUnix listens on socketPath, removing a socket file left behind but no other file.
+func listenUnix(socketPath string) (net.Listener, error) {
+	info, err := os.Lstat(socketPath)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, errors.Wrap(err, "checking unix socket path failed")
+	case info.Mode()&os.ModeSocket == 0:
+		return nil, errors.Errorf("%s already exists and isn't a unix socket", socketPath)
+	default:
+		err = os.Remove(socketPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "removing stale unix socket failed")
+		}
+	}
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "listening on unix socket failed")
+	}
+	return l, nil
 }
 
 func serveTime(w http.ResponseWriter, r *http.Request) {
@@ -26,6 +194,26 @@ func serveTime(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(body))
 }
 
+// serveEcho sends every WebSocket message it gets back until the client closes.
+func serveEcho(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.NetConn().Close()
+
+	for {
+		opcode, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		err = conn.WriteMessage(opcode, data)
+		if err != nil {
+			return
+		}
+	}
+}
+
 func servePrime(w http.ResponseWriter, r *http.Request) {
 	values := r.URL.Query()
 	nStr := values.Get("n")
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "server.sock")
+
+	// A socket left behind by a previous server is replaced.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	require.NoError(t, err)
+	stale.SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	listeners, err := listen("", socketPath)
+	require.NoError(t, err)
+	require.Len(t, listeners, 1)
+	defer listeners[0].Close()
+
+	go func() {
+		conn, err := listeners[0].Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestListenUnixSocketOverFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	require.NoError(t, ioutil.WriteFile(path, []byte("results"), 0644))
+
+	_, err := listen("", path)
+	require.Error(t, err)
+
+	// The file is still there.
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "results", string(b))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// assertion is a check on a response; exactly one of its checks is set.
+type assertion struct {
+	// Name defaults to the kind of check, e.g. "header X-Request-Id".
+	Name      string `yaml:"name,omitempty"`
+	Status    []int  `yaml:"status,omitempty"`
+	Header    string `yaml:"header,omitempty"`
+	BodyRegex string `yaml:"body_regex,omitempty"`
+	// JSON is a dot separated path into a JSON body that must exist, and equal Equals if it is set.
+	JSON         string        `yaml:"json,omitempty"`
+	Equals       string        `yaml:"equals,omitempty"`
+	MaxBodyBytes int           `yaml:"max_body_bytes,omitempty"`
+	MaxLatency   time.Duration `yaml:"max_latency,omitempty"`
+}
+
+type assertionError struct {
+	name string
+	err  error
+}
+
+func (e *assertionError) Error() string {
+	return fmt.Sprintf("assertion %s failed - %v", e.name, e.err)
+}
+
+type compiledAssertion struct {
+	name  string
+	check func(resp *http.Response, body []byte, latency time.Duration) error
+}
+
+func (a *assertion) compile() (*compiledAssertion, error) {
+	// The checks keep using the assertion after it is compiled.
+	copied := *a
+	a = &copied
+
+	set := 0
+	for _, isSet := range []bool{
+		len(a.Status) > 0, a.Header != "", a.BodyRegex != "", a.JSON != "", a.MaxBodyBytes > 0, a.MaxLatency > 0,
+	} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.Errorf("assertion %q should have exactly one check", a.Name)
+	}
+	if a.Equals != "" && a.JSON == "" {
+		return nil, errors.Errorf("assertion %q has equals without json", a.Name)
+	}
+
+	compiled := &compiledAssertion{name: a.Name}
+	switch {
+	case len(a.Status) > 0:
+		compiled.setDefaultName("status")
+		compiled.check = checkStatus(a.Status)
+
+	case a.Header != "":
+		compiled.setDefaultName("header " + a.Header)
+		compiled.check = func(resp *http.Response, _ []byte, _ time.Duration) error {
+			if _, ok := resp.Header[http.CanonicalHeaderKey(a.Header)]; !ok {
+				return errors.Errorf("no %s header", a.Header)
+			}
+			return nil
+		}
+
+	case a.BodyRegex != "":
+		compiled.setDefaultName("body_regex")
+		regex, err := regexp.Compile(a.BodyRegex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "assertion %s has an invalid regex", compiled.name)
+		}
+		compiled.check = func(_ *http.Response, body []byte, _ time.Duration) error {
+			if !regex.Match(body) {
+				return errors.Errorf("body doesn't match %s; body - %s", regex, truncate(body, maxErrorBodyLen))
+			}
+			return nil
+		}
+
+	case a.JSON != "":
+		compiled.setDefaultName("json " + a.JSON)
+		path := strings.Split(a.JSON, ".")
+		compiled.check = func(_ *http.Response, body []byte, _ time.Duration) error {
+			value, err := extractJSON(body, path)
+			if err != nil {
+				return err
+			}
+			if a.Equals != "" && value != a.Equals {
+				return errors.Errorf("%s is %s, expected %s", a.JSON, truncate([]byte(value), maxErrorBodyLen), a.Equals)
+			}
+			return nil
+		}
+
+	case a.MaxBodyBytes > 0:
+		compiled.setDefaultName("max_body_bytes")
+		compiled.check = func(_ *http.Response, body []byte, _ time.Duration) error {
+			if len(body) > a.MaxBodyBytes {
+				return errors.Errorf("body is %d bytes, more than %d", len(body), a.MaxBodyBytes)
+			}
+			return nil
+		}
+
+	default:
+		compiled.setDefaultName("max_latency")
+		compiled.check = func(_ *http.Response, _ []byte, latency time.Duration) error {
+			if latency > a.MaxLatency {
+				return errors.Errorf("took %v, more than %v", latency, a.MaxLatency)
+			}
+			return nil
+		}
+	}
+
+	return compiled, nil
+}
+
+func (a *compiledAssertion) setDefaultName(name string) {
+	if a.name == "" {
+		a.name = name
+	}
+}
+
+func checkStatus(statuses []int) func(resp *http.Response, body []byte, _ time.Duration) error {
+	expected := make(map[int]bool, len(statuses))
+	for _, status := range statuses {
+		expected[status] = true
+	}
+
+	return func(resp *http.Response, body []byte, _ time.Duration) error {
+		if !expected[resp.StatusCode] {
+			return errors.Errorf(
+				"unexpected status - %s, expected %s; body - %s",
+				resp.Status, formatStatuses(expected), truncate(body, maxErrorBodyLen))
+		}
+		return nil
+	}
+}
+
+// checkAssertions returns an assertionError for the first assertion the response fails.
+func checkAssertions(assertions []*compiledAssertion, resp *http.Response, body []byte, latency time.Duration) *assertionError {
+	for _, a := range assertions {
+		err := a.check(resp, body, latency)
+		if err != nil {
+			return &assertionError{name: a.name, err: err}
+		}
+	}
+	return nil
+}
+
+// parseAssertion parses an assertion like "status:200" or "max-latency:500ms".
+func parseAssertion(spec string) (*assertion, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.Errorf("assertion %q should be formatted as kind:argument", spec)
+	}
+	kind, arg := parts[0], parts[1]
+
+	switch kind {
+	case "status":
+		a := &assertion{}
+		for _, s := range strings.Split(arg, ",") {
+			status, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return nil, errors.Wrapf(err, "assertion %q has an invalid status", spec)
+			}
+			a.Status = append(a.Status, status)
+		}
+		return a, nil
+	case "header":
+		return &assertion{Header: arg}, nil
+	case "body":
+		return &assertion{BodyRegex: arg}, nil
+	case "json":
+		pathAndValue := strings.SplitN(arg, "=", 2)
+		a := &assertion{JSON: pathAndValue[0]}
+		if len(pathAndValue) == 2 {
+			a.Equals = pathAndValue[1]
+		}
+		return a, nil
+	case "max-body":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "assertion %q has an invalid size", spec)
+		}
+		return &assertion{MaxBodyBytes: n}, nil
+	case "max-latency":
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "assertion %q has an invalid duration", spec)
+		}
+		return &assertion{MaxLatency: d}, nil
+	default:
+		return nil, errors.Errorf("assertion %q has an unknown kind %s", spec, kind)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertions(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"X-Request-Id": []string{"1"}},
+	}
+	body := []byte(`{"result": {"n": 7919}}`)
+
+	tests := []struct {
+		assertion *assertion
+		name      string
+		passes    bool
+	}{
+		{&assertion{Status: []int{200, 204}}, "status", true},
+		{&assertion{Status: []int{204}}, "status", false},
+		{&assertion{Header: "x-request-id"}, "header x-request-id", true},
+		{&assertion{Header: "X-Missing"}, "header X-Missing", false},
+		{&assertion{BodyRegex: `"n": \d+`}, "body_regex", true},
+		{&assertion{Name: "no error", BodyRegex: `error`}, "no error", false},
+		{&assertion{JSON: "result.n"}, "json result.n", true},
+		{&assertion{JSON: "result.n", Equals: "7919"}, "json result.n", true},
+		{&assertion{JSON: "result.n", Equals: "7"}, "json result.n", false},
+		{&assertion{JSON: "result.m"}, "json result.m", false},
+		{&assertion{MaxBodyBytes: 100}, "max_body_bytes", true},
+		{&assertion{MaxBodyBytes: 10}, "max_body_bytes", false},
+		{&assertion{MaxLatency: time.Second}, "max_latency", true},
+		{&assertion{MaxLatency: time.Millisecond}, "max_latency", false},
+	}
+
+	for _, test := range tests {
+		compiled, err := test.assertion.compile()
+		require.NoError(t, err)
+		require.Equal(t, test.name, compiled.name)
+
+		failed := checkAssertions([]*compiledAssertion{compiled}, resp, body, time.Millisecond*5)
+		if test.passes {
+			require.Nil(t, failed, test.name)
+		} else {
+			require.NotNil(t, failed, test.name)
+			require.Equal(t, test.name, failed.name)
+		}
+	}
+}
+
+func TestAssertionInvalid(t *testing.T) {
+	for _, a := range []*assertion{
+		{},
+		{Header: "a", BodyRegex: "b"},
+		{BodyRegex: "("},
+		{Header: "a", Equals: "b"},
+	} {
+		_, err := a.compile()
+		require.Error(t, err)
+	}
+}
+
+func TestParseAssertion(t *testing.T) {
+	tests := map[string]*assertion{
+		"status:200, 204":  {Status: []int{200, 204}},
+		"header:X-Id":      {Header: "X-Id"},
+		"body:^\\d+$":      {BodyRegex: "^\\d+$"},
+		"json:a.b":         {JSON: "a.b"},
+		"json:a.b=c=d":     {JSON: "a.b", Equals: "c=d"},
+		"max-body:1024":    {MaxBodyBytes: 1024},
+		"max-latency:50ms": {MaxLatency: time.Millisecond * 50},
+	}
+	for spec, expected := range tests {
+		a, err := parseAssertion(spec)
+		require.NoError(t, err, spec)
+		require.Equal(t, expected, a, spec)
+	}
+
+	for _, spec := range []string{"header", "status:ok", "max-body:big", "max-latency:soon", "size:1"} {
+		_, err := parseAssertion(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestClientAssertionFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not a number"))
+	}))
+	defer server.Close()
+
+	target, err := (&targetFlags{}).resolve(nil)
+	require.NoError(t, err)
+	s := &scenario{Endpoint: server.URL, Target: target}
+	f, _, err := s.newRequestFuncs()
+	require.NoError(t, err)
+
+	result, err := f(context.Background(), 0)
+	require.Error(t, err)
+	require.Equal(t, "integer body", result.FailedAssertion)
+	require.Equal(t, sqlite.ValidationFailed, result.Validation)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/pkg/errors"
+)
+
+type client struct {
+	settings *clientSettings
+	baseURL  *url.URL
+	mix      *requestMix
+	feeders  feeders
+	sources  *sourceAddrs
+	// shared is the HTTP client of every worker, unless each worker has its
+	// own.
+	shared *http.Client
+
+	mu         sync.Mutex
+	iterations map[int]int
+	perWorker  map[int]*http.Client
+	// sinceClose is the number of requests each worker sent since it last
+	// closed its connection.
+	sinceClose map[int]int
+}
+
+func newClient(baseURL *url.URL, settings *clientSettings, mix *requestMix) (*client, error) {
+	if settings.H2C && settings.DisableHTTP2 {
+		return nil, errors.New("h2c can't be used with HTTP/2 disabled")
+	}
+	sources, err := settings.newSourceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &client{
+		settings:   settings,
+		sources:    sources,
+		baseURL:    baseURL,
+		mix:        mix,
+		iterations: make(map[int]int),
+		perWorker:  make(map[int]*http.Client),
+		sinceClose: make(map[int]int),
+	}
+	if !settings.PerWorker {
+		c.shared = settings.newHTTPClient(sources)
+	}
+	return c, nil
+}
+
+// httpClient returns the HTTP client workerID sends its requests with.
+func (c *client) httpClient(workerID int) *http.Client {
+	if c.shared != nil {
+		return c.shared
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	httpClient, ok := c.perWorker[workerID]
+	if !ok {
+		httpClient = c.settings.newHTTPClient(c.sources)
+		c.perWorker[workerID] = httpClient
+	}
+	return httpClient
+}
+
+// closesConn returns whether workerID's next request should close its connection.
+func (c *client) closesConn(workerID int) bool {
+	if c.settings.RequestsPerConn <= 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sinceClose[workerID]++
+	if c.sinceClose[workerID] < c.settings.RequestsPerConn {
+		return false
+	}
+	c.sinceClose[workerID] = 0
+	return true
+}
+
+// nextIteration returns the number of requests workerID sent before this one.
+func (c *client) nextIteration(workerID int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	iteration := c.iterations[workerID]
+	c.iterations[workerID] = iteration + 1
+	return iteration
+}
+
+// sendRequest sends the next request of workerID's journey through the request mix.
+func (c *client) sendRequest(ctx context.Context, workerID int) (*webservice_benchmarks.RequestResult, error) {
+	journey := c.mix.next(workerID)
+	step := journey.currentStep()
+
+	if journey.feed == nil {
+		feed, err := c.feeders.draw(workerID)
+		if err != nil {
+			c.mix.abandon(workerID)
+			return &webservice_benchmarks.RequestResult{Name: step.name}, err
+		}
+		journey.feed = feed
+	}
+
+	data := &templateData{
+		WorkerID:  workerID,
+		Iteration: c.nextIteration(workerID),
+		Vars:      journey.vars,
+		Feed:      journey.feed,
+	}
+
+	req, err := step.target.newRequest(ctx, c.baseURL, data)
+	if err != nil {
+		c.mix.abandon(workerID)
+		return &webservice_benchmarks.RequestResult{Name: step.name}, err
+	}
+
+	start := time.Now()
+	resp, body, result, err := c.do(workerID, req)
+	latency := time.Since(start)
+	result.Name = step.name
+	if err != nil {
+		c.mix.abandon(workerID)
+		return result, err
+	}
+	if step.target.grpc {
+		result.GRPCStatus = grpcStatusName(resp)
+		err = checkGRPCStatus(resp)
+		if err != nil {
+			c.mix.abandon(workerID)
+			return result, err
+		}
+	}
+
+	failed := checkAssertions(step.target.assertions, resp, body, latency)
+	if failed != nil {
+		c.mix.abandon(workerID)
+		result.Validation = sqlite.ValidationFailed
+		result.FailedAssertion = failed.name
+		return result, failed
+	}
+
+	values, err := step.extractValues(resp, body)
+	if err != nil {
+		c.mix.abandon(workerID)
+		result.Validation = sqlite.ValidationFailed
+		result.FailedAssertion = "extract"
+		return result, err
+	}
+
+	c.mix.advance(workerID, values)
+	result.Validation = sqlite.ValidationPassed
+	return result, nil
+}
+
+// do sends req for workerID and reads the whole response body.
+func (c *client) do(workerID int, req *http.Request) (*http.Response, []byte, *webservice_benchmarks.RequestResult, error) {
+	result := &webservice_benchmarks.RequestResult{}
+
+	if c.closesConn(workerID) {
+		req.Close = true
+	}
+
+	trace := &requestTrace{multiplexed: c.settings.H2C}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	resp, err := c.httpClient(workerID).Do(req)
+	if err != nil {
+		trace.fill(result)
+		return nil, nil, result, errors.Wrap(err, "sending request failed")
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.Protocol = resp.Proto
+
+	body, err := ioutil.ReadAll(resp.Body)
+	trace.done()
+	trace.fill(result)
+	if err != nil {
+		return nil, nil, result, errors.Wrap(err, "reading response body failed")
+	}
+
+	return resp, body, result, nil
+}
+
+// maxErrorBodyLen is how much of a response body is put in an error.
+const maxErrorBodyLen = 200
+
+func truncate(b []byte, n int) string {
+	if len(b) <= n {
+		return string(b)
+	}
+	return string(b[:n]) + "..."
+}
+
+// countingConn counts the bytes written to and read from an HTTP/1.1 connection.
+type countingConn struct {
+	net.Conn
+	written int64
+	read    int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, err
+}
+
+func (c *countingConn) counts() (written int64, read int64) {
+	return atomic.LoadInt64(&c.written), atomic.LoadInt64(&c.read)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	stderrors "errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/websocket"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+const (
+	defaultMessageInterval = time.Second
+	defaultMessageSize     = 64
+)
+
+// connectionSettings make each worker hold a WebSocket connection open and send messages the server echoes.
+type connectionSettings struct {
+	Path            string        `yaml:"path"`
+	MessageInterval time.Duration `yaml:"message_interval,omitempty"`
+	MessageSize     int           `yaml:"message_size,omitempty"`
+}
+
+func (c *connectionSettings) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "websocket",
+			Usage:       "The path of a WebSocket echo endpoint, e.g. /echo. Each worker holds a connection to it open and sends messages over it instead of sending requests.",
+			Destination: &c.Path,
+		},
+		cli.DurationFlag{
+			Name:        "message-interval",
+			Usage:       "With --websocket, how often each connection sends a message. (default: 1s)",
+			Destination: &c.MessageInterval,
+		},
+		cli.IntFlag{
+			Name:        "message-size",
+			Usage:       "With --websocket, the size of each message in bytes. (default: 64)",
+			Destination: &c.MessageSize,
+		},
+	}
+}
+
+func (c *connectionSettings) interval() time.Duration {
+	if c.MessageInterval <= 0 {
+		return defaultMessageInterval
+	}
+	return c.MessageInterval
+}
+
+func (c *connectionSettings) size() int {
+	if c.MessageSize <= 0 {
+		return defaultMessageSize
+	}
+	return c.MessageSize
+}
+
+type connClient struct {
+	settings  *connectionSettings
+	url       *url.URL
+	dial      func(ctx context.Context, network, addr string) (net.Conn, error)
+	tlsConfig *tls.Config
+	message   []byte
+
+	mu    sync.Mutex
+	conns map[int]*heldConn
+}
+
+// heldConn is an open connection whose reader hands echoes to echoes.
+type heldConn struct {
+	ws        *websocket.Conn
+	localPort int
+	echoes    chan []byte
+	dropped   chan struct{}
+	dropTime  time.Time
+	dropErr   error
+}
+
+func newConnClient(baseURL *url.URL, settings *connectionSettings, client *clientSettings) (*connClient, error) {
+	sources, err := client.newSourceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	u := *baseURL
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return nil, errors.Errorf("websocket connections need an http or https endpoint, got %s", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(settings.Path, "/")
+
+	c := &connClient{
+		settings: settings,
+		url:      &u,
+		dial:     client.dialContext(sources),
+		message:  []byte(strings.Repeat("x", settings.size())),
+		conns:    make(map[int]*heldConn),
+	}
+	if u.Scheme == "wss" {
+		c.tlsConfig = &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: client.InsecureSkipVerify,
+		}
+	}
+	return c, nil
+}
+
+func (c *connClient) address() string {
+	if c.url.Port() != "" {
+		return c.url.Host
+	}
+	if c.url.Scheme == "wss" {
+		return net.JoinHostPort(c.url.Hostname(), "443")
+	}
+	return net.JoinHostPort(c.url.Hostname(), "80")
+}
+
+// sendMessage opens workerID's connection if it has none, or sends a message and waits for the echo.
+func (c *connClient) sendMessage(ctx context.Context, workerID int) (*webservice_benchmarks.RequestResult, error) {
+	c.mu.Lock()
+	h := c.conns[workerID]
+	c.mu.Unlock()
+	if h == nil {
+		return c.connect(ctx, workerID)
+	}
+
+	result := &webservice_benchmarks.RequestResult{
+		Name:       "message",
+		ConnReused: true,
+		LocalPort:  h.localPort,
+	}
+
+	// An echo that came after its message timed out isn't this message's.
+	select {
+	case <-h.echoes:
+	default:
+	}
+
+	stop := h.closeOnDone(ctx)
+	err := h.ws.WriteMessage(websocket.OpBinary, c.message)
+	stop()
+	if err != nil {
+		if ctx.Err() != nil {
+			return c.abandon(ctx, workerID, h, result, "sending message failed")
+		}
+		h.ws.NetConn().Close()
+		return c.dropped(workerID, h, time.Now().UTC(), err, result)
+	}
+	result.BytesSent = int64(len(c.message))
+
+	select {
+	case echo := <-h.echoes:
+		result.BytesReceived = int64(len(echo))
+		if len(echo) != len(c.message) {
+			result.Validation = sqlite.ValidationFailed
+			result.FailedAssertion = "echo"
+			return result, errors.Errorf("echo has %d bytes, sent %d", len(echo), len(c.message))
+		}
+		result.Validation = sqlite.ValidationPassed
+		return result, nil
+	case <-h.dropped:
+		if ctx.Err() != nil {
+			return c.abandon(ctx, workerID, h, result, "waiting for echo failed")
+		}
+		return c.dropped(workerID, h, h.dropTime, h.dropErr, result)
+	case <-ctx.Done():
+		return c.abandon(ctx, workerID, h, result, "waiting for echo failed")
+	}
+}
+
+// closeOnDone closes h's connection if ctx is done first; the returned function stops it.
+func (h *heldConn) closeOnDone(ctx context.Context) func() {
+	conn := h.ws.NetConn()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	return func() {
+		stop()
+		conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// abandon closes workerID's connection, since the echo of the message in flight might still come.
+func (c *connClient) abandon(
+	ctx context.Context,
+	workerID int,
+	h *heldConn,
+	result *webservice_benchmarks.RequestResult,
+	message string) (*webservice_benchmarks.RequestResult, error) {
+
+	h.ws.NetConn().Close()
+
+	c.mu.Lock()
+	delete(c.conns, workerID)
+	c.mu.Unlock()
+
+	result.ConnEvents = append(result.ConnEvents, &webservice_benchmarks.ConnEvent{
+		Time:      time.Now().UTC(),
+		Event:     sqlite.ConnEventClose,
+		LocalPort: h.localPort,
+	})
+	return result, errors.Wrap(ctx.Err(), message)
+}
+
+// dropped forgets workerID's connection so its next call opens a new one.
+func (c *connClient) dropped(
+	workerID int,
+	h *heldConn,
+	t time.Time,
+	err error,
+	result *webservice_benchmarks.RequestResult) (*webservice_benchmarks.RequestResult, error) {
+
+	c.mu.Lock()
+	delete(c.conns, workerID)
+	c.mu.Unlock()
+
+	result.ConnEvents = append(result.ConnEvents, &webservice_benchmarks.ConnEvent{
+		Time:      t,
+		Event:     sqlite.ConnEventDrop,
+		Error:     err.Error(),
+		LocalPort: h.localPort,
+	})
+	return result, errors.Wrap(err, "connection dropped")
+}
+
+func (c *connClient) connect(ctx context.Context, workerID int) (*webservice_benchmarks.RequestResult, error) {
+	result := &webservice_benchmarks.RequestResult{Name: "connect"}
+
+	start := time.Now()
+	conn, err := c.dial(ctx, "tcp", c.address())
+	if err != nil {
+		return result, errors.Wrap(err, "connecting failed")
+	}
+	result.Connect = time.Since(start)
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		result.LocalPort = addr.Port
+	}
+
+	if c.tlsConfig != nil {
+		start = time.Now()
+		tlsConn := tls.Client(conn, c.tlsConfig)
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return result, errors.Wrap(err, "tls handshake failed")
+		}
+		result.TLSHandshake = time.Since(start)
+		conn = tlsConn
+	}
+
+	start = time.Now()
+	ws, err := websocket.Handshake(ctx, conn, c.url)
+	result.TimeToFirstByte = time.Since(start)
+	if err != nil {
+		conn.Close()
+		var handshakeErr *websocket.HandshakeError
+		if stderrors.As(err, &handshakeErr) {
+			result.StatusCode = handshakeErr.StatusCode
+			result.Validation = sqlite.ValidationFailed
+			result.FailedAssertion = "handshake"
+		}
+		return result, err
+	}
+
+	h := &heldConn{
+		ws:        ws,
+		localPort: result.LocalPort,
+		echoes:    make(chan []byte, 1),
+		dropped:   make(chan struct{}),
+	}
+	go h.read()
+
+	c.mu.Lock()
+	c.conns[workerID] = h
+	c.mu.Unlock()
+
+	result.ConnEvents = []*webservice_benchmarks.ConnEvent{{
+		Time:      time.Now().UTC(),
+		Event:     sqlite.ConnEventOpen,
+		LocalPort: h.localPort,
+	}}
+	return result, nil
+}
+
+func (h *heldConn) read() {
+	for {
+		_, data, err := h.ws.ReadMessage()
+		if err != nil {
+			h.dropTime = time.Now().UTC()
+			h.dropErr = err
+			close(h.dropped)
+			return
+		}
+
+		select {
+		case h.echoes <- data:
+		default:
+		}
+	}
+}
+
+// closeWorker closes workerID's connection, returning a nil result if it has none.
+func (c *connClient) closeWorker(ctx context.Context, workerID int) (*webservice_benchmarks.RequestResult, error) {
+	c.mu.Lock()
+	h := c.conns[workerID]
+	delete(c.conns, workerID)
+	c.mu.Unlock()
+	if h == nil {
+		return nil, nil
+	}
+
+	result := &webservice_benchmarks.RequestResult{
+		Name:       "close",
+		ConnReused: true,
+		LocalPort:  h.localPort,
+	}
+
+	select {
+	case <-h.dropped:
+		// It dropped while the worker was waiting to send its next message.
+		return c.dropped(workerID, h, h.dropTime, h.dropErr, result)
+	default:
+	}
+
+	stop := h.closeOnDone(ctx)
+	err := h.ws.Close(websocket.CloseNormal)
+	stop()
+	result.ConnEvents = []*webservice_benchmarks.ConnEvent{{
+		Time:      time.Now().UTC(),
+		Event:     sqlite.ConnEventClose,
+		LocalPort: h.localPort,
+	}}
+	if err != nil {
+		return result, errors.Wrap(err, "closing connection failed")
+	}
+	return result, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestEchoServer echoes messages until it gets one of "drop", then
+// closes the connection. It doesn't echo messages of "ignore".
+func newTestEchoServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ws/echo", r.URL.Path)
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.NetConn().Close()
+
+		for {
+			opcode, data, err := conn.ReadMessage()
+			if err != nil || string(data) == "drop" {
+				return
+			}
+			if string(data) == "ignore" {
+				continue
+			}
+			conn.WriteMessage(opcode, data)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestConnClient(t *testing.T) {
+	server := newTestEchoServer(t)
+	base, err := parseEndpoint(server.URL + "/ws")
+	require.NoError(t, err)
+	c, err := newConnClient(base, &connectionSettings{Path: "/echo", MessageSize: 10}, &clientSettings{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	result, err := c.sendMessage(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, "connect", result.Name)
+	require.Len(t, result.ConnEvents, 1)
+	require.Equal(t, sqlite.ConnEventOpen, result.ConnEvents[0].Event)
+	require.NotZero(t, result.LocalPort)
+
+	for i := 0; i < 3; i++ {
+		result, err = c.sendMessage(ctx, 0)
+		require.NoError(t, err)
+		require.Equal(t, "message", result.Name)
+		require.Equal(t, int64(10), result.BytesReceived)
+		require.Empty(t, result.ConnEvents)
+	}
+
+	result, err = c.closeWorker(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, "close", result.Name)
+	require.Equal(t, sqlite.ConnEventClose, result.ConnEvents[0].Event)
+
+	// A worker without a connection has nothing to close.
+	result, err = c.closeWorker(ctx, 0)
+	require.NoError(t, err)
+	require.Nil(t, result)
+}
+
+func TestConnClientDrop(t *testing.T) {
+	server := newTestEchoServer(t)
+	base, err := parseEndpoint(server.URL + "/ws")
+	require.NoError(t, err)
+	c, err := newConnClient(base, &connectionSettings{Path: "echo"}, &clientSettings{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = c.sendMessage(ctx, 0)
+	require.NoError(t, err)
+	c.message = []byte("drop")
+	result, err := c.sendMessage(ctx, 0)
+	require.Error(t, err)
+	require.Equal(t, "message", result.Name)
+	require.Len(t, result.ConnEvents, 1)
+	require.Equal(t, sqlite.ConnEventDrop, result.ConnEvents[0].Event)
+	require.NotEmpty(t, result.ConnEvents[0].Error)
+
+	// The next call opens a new connection.
+	result, err = c.sendMessage(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, "connect", result.Name)
+}
+
+func TestConnClientCancelled(t *testing.T) {
+	server := newTestEchoServer(t)
+	base, err := parseEndpoint(server.URL + "/ws")
+	require.NoError(t, err)
+	c, err := newConnClient(base, &connectionSettings{Path: "echo"}, &clientSettings{})
+	require.NoError(t, err)
+
+	_, err = c.sendMessage(context.Background(), 0)
+	require.NoError(t, err)
+
+	c.message = []byte("ignore")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	result, err := c.sendMessage(ctx, 0)
+	require.Error(t, err)
+	require.Len(t, result.ConnEvents, 1)
+	require.Equal(t, sqlite.ConnEventClose, result.ConnEvents[0].Event)
+
+	// The echo could still come, so the next call opens a new connection.
+	c.message = []byte("message")
+	result, err = c.sendMessage(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, "connect", result.Name)
+
+}
+
+func TestConnectionFlags(t *testing.T) {
+	s := resolveScenarioFromArgs(t, "--websocket", "/echo", "--message-interval", "30s", "--parallel", "20000")
+	require.Equal(t, &connectionSettings{Path: "/echo", MessageInterval: time.Second * 30}, s.Connections)
+	require.Equal(t, 64, s.Connections.size())
+
+	_, _, err := s.newConnectionFuncs()
+	require.NoError(t, err)
+
+	s.Load.Rate = 100
+	_, _, err = s.newConnectionFuncs()
+	require.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/urfave/cli"
+)
+
+// controllerSettings make the run adjust its load to hold its p99 at TargetP99.
+type controllerSettings struct {
+	Algorithm    string        `yaml:"algorithm,omitempty"`
+	TargetP99    time.Duration `yaml:"target_p99"`
+	MaxErrorRate float64       `yaml:"max_error_rate,omitempty"`
+	Interval     time.Duration `yaml:"interval,omitempty"`
+	Min          float64       `yaml:"min,omitempty"`
+	Max          float64       `yaml:"max,omitempty"`
+}
+
+func (c *controllerSettings) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.DurationFlag{
+			Name:        "latency-target",
+			Usage:       "Keep adjusting the number of workers, or the rate with --rate, to hold the p99 latency at this, e.g. 200ms. Every decision is recorded in the controller_decisions table.",
+			Destination: &c.TargetP99,
+		},
+		cli.StringFlag{
+			Name:        "controller",
+			Usage:       "With --latency-target, how the load is adjusted: aimd adds a step while the p99 is within the target and cuts it by a quarter when it isn't, pid changes it in proportion to how far off it is. (default: aimd)",
+			Destination: &c.Algorithm,
+		},
+		cli.DurationFlag{
+			Name:        "controller-interval",
+			Usage:       "With --latency-target, how often the load is adjusted, based on the requests of the last interval. (default: 5s)",
+			Destination: &c.Interval,
+		},
+		cli.Float64Flag{
+			Name:        "controller-max-error-rate",
+			Usage:       "With --latency-target, cut the load when the fraction of failed requests is above this (e.g. 0.01), whatever the latency.",
+			Destination: &c.MaxErrorRate,
+		},
+		cli.Float64Flag{
+			Name:        "controller-min",
+			Usage:       "With --latency-target, the least workers, or rate, the load is cut to. (default: 1)",
+			Destination: &c.Min,
+		},
+		cli.Float64Flag{
+			Name:        "controller-max",
+			Usage:       "With --latency-target, the most workers, or rate, the load is raised to. 0 means no limit.",
+			Destination: &c.Max,
+		},
+	}
+}
+
+func (c *controllerSettings) controller() *webservice_benchmarks.Controller {
+	algorithm := c.Algorithm
+	if algorithm == "" {
+		algorithm = webservice_benchmarks.ControllerAIMD
+	}
+	return &webservice_benchmarks.Controller{
+		Algorithm:    algorithm,
+		TargetP99:    c.TargetP99,
+		MaxErrorRate: c.MaxErrorRate,
+		Interval:     c.Interval,
+		Min:          c.Min,
+		Max:          c.Max,
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/pkg/errors"
+)
+
+const (
+	// feederOrderSequential hands out the records in order, shared between
+	// the workers.
+	feederOrderSequential = "sequential"
+	// feederOrderRandom hands out a random record each time.
+	feederOrderRandom = "random"
+	// feederOrderUnique splits the records between the workers, so no two
+	// workers use the same record, and hands out each worker's records in
+	// order.
+	feederOrderUnique = "unique"
+
+	// feederExhaustedWrap starts over from the first record.
+	feederExhaustedWrap = "wrap"
+	// feederExhaustedStop ends the run.
+	feederExhaustedStop = "stop"
+)
+
+// feeder is a CSV or JSONL data file whose records templates use as {{.Feed.name.field}}.
+type feeder struct {
+	Name        string `yaml:"name"`
+	File        string `yaml:"file"`
+	Order       string `yaml:"order,omitempty"`
+	OnExhausted string `yaml:"on_exhausted,omitempty"`
+}
+
+// parseFeeder parses a feeder formatted as name=file[:order[:on_exhausted]].
+func parseFeeder(spec string) (*feeder, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, errors.Errorf("feeder %q should be formatted as name=file[:order[:on_exhausted]]", spec)
+	}
+
+	options := strings.Split(parts[1], ":")
+	if len(options) > 3 {
+		return nil, errors.Errorf("feeder %q should be formatted as name=file[:order[:on_exhausted]]", spec)
+	}
+
+	f := &feeder{
+		Name: parts[0],
+		File: options[0],
+	}
+	if len(options) > 1 {
+		f.Order = options[1]
+	}
+	if len(options) > 2 {
+		f.OnExhausted = options[2]
+	}
+
+	return f, nil
+}
+
+type loadedFeeder struct {
+	name    string
+	order   string
+	wrap    bool
+	records []map[string]string
+	// partitions is how many workers the records are split between in
+	// unique order. The worker in slot n uses the records whose index is n
+	// modulo partitions.
+	partitions int
+
+	mu         sync.Mutex
+	next       int
+	slots      map[int]int
+	freeSlots  []int
+	nextBySlot []int
+}
+
+func (f *feeder) load(partitions int) (*loadedFeeder, error) {
+	if f.Name == "" {
+		return nil, errors.New("feeder has no name")
+	}
+
+	order := f.Order
+	if order == "" {
+		order = feederOrderSequential
+	}
+	switch order {
+	case feederOrderSequential, feederOrderRandom, feederOrderUnique:
+	default:
+		return nil, errors.Errorf("feeder %s order should be sequential, random or unique, got %q", f.Name, f.Order)
+	}
+
+	onExhausted := f.OnExhausted
+	if onExhausted == "" {
+		onExhausted = feederExhaustedWrap
+	}
+	switch onExhausted {
+	case feederExhaustedWrap, feederExhaustedStop:
+	default:
+		return nil, errors.Errorf("feeder %s on_exhausted should be wrap or stop, got %q", f.Name, f.OnExhausted)
+	}
+
+	file, err := os.Open(f.File)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening feeder %s failed", f.Name)
+	}
+	defer file.Close()
+
+	var records []map[string]string
+	switch strings.ToLower(filepath.Ext(f.File)) {
+	case ".csv":
+		records, err = readCSVRecords(file)
+	case ".jsonl", ".json":
+		records, err = readJSONLRecords(file)
+	default:
+		return nil, errors.Errorf("feeder %s file %s should be .csv or .jsonl", f.Name, f.File)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading feeder %s failed", f.Name)
+	}
+	if len(records) == 0 {
+		return nil, errors.Errorf("feeder %s file %s has no records", f.Name, f.File)
+	}
+
+	if partitions < 1 {
+		partitions = 1
+	}
+	if order == feederOrderUnique && len(records) < partitions {
+		return nil, errors.Errorf("feeder %s has %d records, which can't be split between %d workers", f.Name, len(records), partitions)
+	}
+
+	return &loadedFeeder{
+		name:       f.Name,
+		order:      order,
+		wrap:       onExhausted == feederExhaustedWrap,
+		records:    records,
+		partitions: partitions,
+		slots:      make(map[int]int),
+		nextBySlot: make([]int, 0, partitions),
+	}, nil
+}
+
+func readCSVRecords(reader io.Reader) ([]map[string]string, error) {
+	rows, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing CSV failed")
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	records := make([]map[string]string, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		record := make(map[string]string, len(header))
+		for i, field := range header {
+			record[field] = row[i]
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func readJSONLRecords(reader io.Reader) ([]map[string]string, error) {
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+
+	records := make([]map[string]string, 0)
+	for {
+		var object map[string]interface{}
+		err := decoder.Decode(&object)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing record %d failed", len(records))
+		}
+
+		record := make(map[string]string, len(object))
+		for field, value := range object {
+			record[field], err = jsonValueString(value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// draw returns the next record for workerID, or ErrNoMoreRequests if it ran out.
+func (f *loadedFeeder) draw(workerID int) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch f.order {
+	case feederOrderRandom:
+		return f.records[rand.Intn(len(f.records))], nil
+
+	case feederOrderUnique:
+		slot, err := f.slot(workerID)
+		if err != nil {
+			return nil, err
+		}
+		i := slot + f.nextBySlot[slot]*f.partitions
+		if i >= len(f.records) {
+			if !f.wrap {
+				return nil, f.exhausted()
+			}
+			i = slot
+			f.nextBySlot[slot] = 0
+		}
+		f.nextBySlot[slot]++
+		return f.records[i], nil
+
+	default:
+		if f.next >= len(f.records) {
+			if !f.wrap {
+				return nil, f.exhausted()
+			}
+			f.next = 0
+		}
+		record := f.records[f.next]
+		f.next++
+		return record, nil
+	}
+}
+
+// slot returns the slot of workerID, giving it a free one since worker IDs aren't reused.
+func (f *loadedFeeder) slot(workerID int) (int, error) {
+	if slot, ok := f.slots[workerID]; ok {
+		return slot, nil
+	}
+
+	var slot int
+	switch {
+	case len(f.freeSlots) > 0:
+		slot = f.freeSlots[len(f.freeSlots)-1]
+		f.freeSlots = f.freeSlots[:len(f.freeSlots)-1]
+	case len(f.nextBySlot) < f.partitions:
+		slot = len(f.nextBySlot)
+		f.nextBySlot = append(f.nextBySlot, 0)
+	default:
+		return 0, errors.Errorf("feeder %s splits its records between %d workers, and more are running", f.name, f.partitions)
+	}
+	f.slots[workerID] = slot
+	return slot, nil
+}
+
+// release frees the slot of workerID, which stopped.
+func (f *loadedFeeder) release(workerID int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	slot, ok := f.slots[workerID]
+	if !ok {
+		return
+	}
+	delete(f.slots, workerID)
+	f.freeSlots = append(f.freeSlots, slot)
+}
+
+func (f *loadedFeeder) exhausted() error {
+	return errors.Wrapf(webservice_benchmarks.ErrNoMoreRequests, "feeder %s ran out of records", f.name)
+}
+
+type feeders []*loadedFeeder
+
+func loadFeeders(definitions []*feeder, partitions int) (feeders, error) {
+	names := make(map[string]bool, len(definitions))
+	loaded := make(feeders, 0, len(definitions))
+	for _, definition := range definitions {
+		if names[definition.Name] {
+			return nil, errors.Errorf("more than one feeder is named %s", definition.Name)
+		}
+		names[definition.Name] = true
+
+		f, err := definition.load(partitions)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, f)
+	}
+	return loaded, nil
+}
+
+// draw returns a record from every feeder, keyed by feeder name.
+func (fs feeders) draw(workerID int) (map[string]map[string]string, error) {
+	feed := make(map[string]map[string]string, len(fs))
+	for _, f := range fs {
+		record, err := f.draw(workerID)
+		if err != nil {
+			return nil, err
+		}
+		feed[f.name] = record
+	}
+	return feed, nil
+}
+
+// release frees what workerID holds in every feeder.
+func (fs feeders) release(workerID int) {
+	for _, f := range fs {
+		f.release(workerID)
+	}
+}
+
+// jsonValueString returns strings as they are and anything else as JSON.
+func jsonValueString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	default:
+		buf := &bytes.Buffer{}
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		err := encoder.Encode(v)
+		if err != nil {
+			return "", errors.Wrap(err, "encoding value failed")
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+}
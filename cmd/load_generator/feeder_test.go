@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestFeederFile(t *testing.T, name, contents string) string {
+	file := filepath.Join(t.TempDir(), name)
+	err := ioutil.WriteFile(file, []byte(contents), 0644)
+	require.NoError(t, err)
+	return file
+}
+
+func TestParseFeeder(t *testing.T) {
+	f, err := parseFeeder("users=data/users.csv")
+	require.NoError(t, err)
+	require.Equal(t, &feeder{Name: "users", File: "data/users.csv"}, f)
+
+	f, err = parseFeeder("n=n.jsonl:random:stop")
+	require.NoError(t, err)
+	require.Equal(t, &feeder{Name: "n", File: "n.jsonl", Order: "random", OnExhausted: "stop"}, f)
+
+	for _, spec := range []string{"users.csv", "=users.csv", "a=b:c:d:e"} {
+		_, err := parseFeeder(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestFeederRecords(t *testing.T) {
+	records, err := readCSVRecords(strings.NewReader("id,name\n1,a\n2,\"b, c\"\n"))
+	require.NoError(t, err)
+	require.Equal(t, []map[string]string{
+		{"id": "1", "name": "a"},
+		{"id": "2", "name": "b, c"},
+	}, records)
+
+	records, err = readJSONLRecords(strings.NewReader(`{"n": 12345678901, "tags": ["a"], "name": "x"}
+{"n": 2}
+`))
+	require.NoError(t, err)
+	require.Equal(t, []map[string]string{
+		{"n": "12345678901", "tags": `["a"]`, "name": "x"},
+		{"n": "2"},
+	}, records)
+
+	_, err = readJSONLRecords(strings.NewReader(`{"n": 1} [1]`))
+	require.Error(t, err)
+}
+
+func TestFeederSequential(t *testing.T) {
+	file := writeTestFeederFile(t, "n.csv", "n\n1\n2\n3\n")
+
+	f, err := (&feeder{Name: "n", File: file}).load(2)
+	require.NoError(t, err)
+	values := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		record, err := f.draw(i % 2)
+		require.NoError(t, err)
+		values = append(values, record["n"])
+	}
+	require.Equal(t, []string{"1", "2", "3", "1", "2"}, values)
+
+	f, err = (&feeder{Name: "n", File: file, OnExhausted: feederExhaustedStop}).load(2)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := f.draw(0)
+		require.NoError(t, err)
+	}
+	_, err = f.draw(0)
+	require.Equal(t, webservice_benchmarks.ErrNoMoreRequests, errors.Cause(err))
+}
+
+func TestFeederUnique(t *testing.T) {
+	file := writeTestFeederFile(t, "n.csv", "n\n0\n1\n2\n3\n4\n")
+
+	f, err := (&feeder{Name: "n", File: file, Order: feederOrderUnique}).load(2)
+	require.NoError(t, err)
+	draw := func(workerID int) string {
+		record, err := f.draw(workerID)
+		require.NoError(t, err)
+		return record["n"]
+	}
+	require.Equal(t, []string{"0", "2", "4", "0"}, []string{draw(0), draw(0), draw(0), draw(0)})
+	require.Equal(t, []string{"1", "3", "1"}, []string{draw(1), draw(1), draw(1)})
+
+	// A worker started after another stopped takes over its records.
+	_, err = f.draw(2)
+	require.EqualError(t, err, "feeder n splits its records between 2 workers, and more are running")
+	f.release(0)
+	require.Equal(t, []string{"2", "4"}, []string{draw(2), draw(2)})
+	require.Equal(t, "3", draw(1))
+
+	f, err = (&feeder{Name: "n", File: file, Order: feederOrderUnique, OnExhausted: feederExhaustedStop}).load(2)
+	require.NoError(t, err)
+	draw(0)
+	draw(1)
+	draw(1)
+	_, err = f.draw(1)
+	require.Equal(t, webservice_benchmarks.ErrNoMoreRequests, errors.Cause(err))
+
+	_, err = (&feeder{Name: "n", File: file, Order: feederOrderUnique}).load(6)
+	require.Error(t, err)
+}
+
+func TestFeederInvalid(t *testing.T) {
+	file := writeTestFeederFile(t, "n.csv", "n\n1\n")
+
+	for _, f := range []*feeder{
+		{File: file},
+		{Name: "n", File: file, Order: "backwards"},
+		{Name: "n", File: file, OnExhausted: "explode"},
+		{Name: "n", File: writeTestFeederFile(t, "n.txt", "1")},
+		{Name: "n", File: writeTestFeederFile(t, "empty.csv", "n\n")},
+		{Name: "n", File: filepath.Join(t.TempDir(), "missing.csv")},
+	} {
+		_, err := f.load(1)
+		require.Error(t, err)
+	}
+
+	_, err := loadFeeders([]*feeder{{Name: "n", File: file}, {Name: "n", File: file}}, 1)
+	require.Error(t, err)
+}
+
+func TestFeederInRequests(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+	}))
+	defer server.Close()
+
+	s := &scenario{
+		Endpoint: server.URL,
+		Target:   &target{Path: "/prime", Query: map[string]string{"n": "{{.Feed.primes.n}}"}},
+		Feeders: []*feeder{{
+			Name:        "primes",
+			File:        writeTestFeederFile(t, "primes.jsonl", "{\"n\": 10}\n{\"n\": 20}\n"),
+			OnExhausted: feederExhaustedStop,
+		}},
+	}
+	f, closeWorker, err := s.newRequestFuncs()
+	require.NoError(t, err)
+	require.NotNil(t, closeWorker)
+
+	ctx := context.Background()
+	_, err = f(ctx, 0)
+	require.NoError(t, err)
+	_, err = f(ctx, 1)
+	require.NoError(t, err)
+	_, err = f(ctx, 0)
+	require.Equal(t, webservice_benchmarks.ErrNoMoreRequests, errors.Cause(err))
+
+	require.Equal(t, []string{"n=10", "n=20"}, queries)
+}
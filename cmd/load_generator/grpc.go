@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/grpcwire"
+	"github.com/pkg/errors"
+)
+
+// Types of gRPC request fields.
+const (
+	// grpcFieldInt is sent as a varint, like an int32 or int64.
+	grpcFieldInt = "int"
+	// grpcFieldString is sent length-delimited, like a string or bytes.
+	grpcFieldString = "string"
+)
+
+// grpcCall makes a target a gRPC call of the method its path names.
+type grpcCall struct {
+	Fields []*grpcField `yaml:"fields,omitempty"`
+}
+
+// grpcField is a field of the request message. Its value is a template.
+type grpcField struct {
+	Number int    `yaml:"number"`
+	Type   string `yaml:"type"`
+	Value  string `yaml:"value"`
+}
+
+// parseGRPCField parses a field formatted as number:type=value.
+func parseGRPCField(spec string) (*grpcField, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return nil, errors.Errorf("grpc field %q should be formatted as number:type=value", spec)
+	}
+	key := strings.SplitN(parts[0], ":", 2)
+	number, err := strconv.Atoi(key[0])
+	if len(key) != 2 || err != nil {
+		return nil, errors.Errorf("grpc field %q should be formatted as number:type=value", spec)
+	}
+	return &grpcField{Number: number, Type: key[1], Value: parts[1]}, nil
+}
+
+type compiledGRPCField struct {
+	number int
+	varint bool
+	value  *template.Template
+}
+
+func (g *grpcCall) compile() ([]*compiledGRPCField, error) {
+	numbers := make(map[int]bool, len(g.Fields))
+	fields := make([]*compiledGRPCField, 0, len(g.Fields))
+	for _, field := range g.Fields {
+		if field.Number < 1 {
+			return nil, errors.Errorf("invalid grpc field number %d", field.Number)
+		}
+		if numbers[field.Number] {
+			return nil, errors.Errorf("grpc field %d is set more than once", field.Number)
+		}
+		numbers[field.Number] = true
+		if field.Type != grpcFieldInt && field.Type != grpcFieldString {
+			return nil, errors.Errorf("grpc field %d type should be int or string, got %q", field.Number, field.Type)
+		}
+
+		tmpl, err := parseTemplate("grpc field "+strconv.Itoa(field.Number), field.Value)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, &compiledGRPCField{
+			number: field.Number,
+			varint: field.Type == grpcFieldInt,
+			value:  tmpl,
+		})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].number < fields[j].number })
+	return fields, nil
+}
+
+// newGRPCBody returns the framed request message.
+func newGRPCBody(fields []*compiledGRPCField, data *templateData) ([]byte, error) {
+	var msg []byte
+	for _, field := range fields {
+		value, err := executeTemplate(field.value, data)
+		if err != nil {
+			return nil, err
+		}
+		if !field.varint {
+			msg = grpcwire.AppendBytes(msg, field.number, []byte(value))
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("grpc field %d should be an integer, got %q", field.number, value)
+		}
+		msg = grpcwire.AppendVarint(msg, field.number, uint64(n))
+	}
+
+	buf := &bytes.Buffer{}
+	err := grpcwire.WriteMessage(buf, msg)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkGRPCStatus returns an error if the call ended with a status other than OK.
+func checkGRPCStatus(resp *http.Response) error {
+	code, message, err := grpcwire.ResponseStatus(resp)
+	if err != nil || code == grpcwire.OK {
+		return nil
+	}
+	return errors.Errorf("grpc status %s: %s", code, message)
+}
+
+// checkGRPCResponse fails responses that aren't well formed gRPC responses.
+func checkGRPCResponse(resp *http.Response, body []byte, _ time.Duration) error {
+	_, _, err := grpcwire.ResponseStatus(resp)
+	if err != nil {
+		return err
+	}
+
+	r := bytes.NewReader(body)
+	for {
+		_, err := grpcwire.ReadMessage(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// grpcStatusName returns the name of the response's gRPC status, if it has one.
+func grpcStatusName(resp *http.Response) string {
+	code, _, err := grpcwire.ResponseStatus(resp)
+	if err != nil {
+		return ""
+	}
+	return code.String()
+}
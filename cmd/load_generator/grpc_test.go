@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/jlym/webservice-benchmarks/grpcwire"
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGRPCServer serves a method that echoes field 1 of its request as
+// that many messages, and fails with INVALID_ARGUMENT when it is 0.
+func newTestGRPCServer(t *testing.T) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/test.Service/Count", r.URL.Path)
+		require.Equal(t, grpcwire.ContentType, r.Header.Get("Content-Type"))
+
+		req, err := grpcwire.ReadMessage(r.Body)
+		require.NoError(t, err)
+		fields, err := grpcwire.ParseFields(req)
+		require.NoError(t, err)
+		require.Len(t, fields, 2)
+		require.Equal(t, "name", string(fields[1].Bytes))
+
+		w.Header().Set("Content-Type", grpcwire.ContentType)
+		status := grpcwire.OK
+		if fields[0].Varint == 0 {
+			status = grpcwire.InvalidArgument
+		}
+		for i := uint64(0); i < fields[0].Varint; i++ {
+			require.NoError(t, grpcwire.WriteMessage(w, grpcwire.AppendVarint(nil, 1, i)))
+		}
+		w.Header().Set(http.TrailerPrefix+grpcwire.StatusHeader, strconv.Itoa(int(status)))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientGRPC(t *testing.T) {
+	server := newTestGRPCServer(t)
+
+	for _, test := range []struct {
+		count      string
+		grpcStatus string
+		failed     bool
+	}{
+		{count: "3", grpcStatus: "OK"},
+		{count: "0", grpcStatus: "INVALID_ARGUMENT", failed: true},
+	} {
+		s := &scenario{Target: &target{
+			Path: "/test.Service/Count",
+			GRPC: &grpcCall{Fields: []*grpcField{
+				{Number: 1, Type: grpcFieldInt, Value: test.count},
+				{Number: 2, Type: grpcFieldString, Value: "name"},
+			}},
+		}}
+		operations, err := s.compileRequests()
+		require.NoError(t, err)
+		base, err := parseEndpoint(server.URL)
+		require.NoError(t, err)
+		c, err := newClient(base, &clientSettings{InsecureSkipVerify: true}, newRequestMix(operations))
+		require.NoError(t, err)
+
+		result, err := c.sendRequest(context.Background(), 0)
+		require.Equal(t, test.failed, err != nil, test.count)
+		require.Equal(t, "HTTP/2.0", result.Protocol)
+		require.Equal(t, test.grpcStatus, result.GRPCStatus)
+		// A failed call isn't a failed assertion.
+		require.Empty(t, result.FailedAssertion)
+		if test.failed {
+			require.EqualError(t, err, "grpc status INVALID_ARGUMENT: ")
+		} else {
+			require.Equal(t, sqlite.ValidationPassed, result.Validation)
+		}
+	}
+}
+
+func TestGRPCTargetCompile(t *testing.T) {
+	_, err := (&target{Path: "/s/M", Method: "GET", GRPC: &grpcCall{}}).compile()
+	require.Error(t, err)
+	_, err = (&target{Path: "/s/M", Body: "body", GRPC: &grpcCall{}}).compile()
+	require.Error(t, err)
+	for _, fields := range [][]*grpcField{
+		{{Number: 0, Type: grpcFieldInt, Value: "1"}},
+		{{Number: 1, Value: "1"}},
+		{{Number: 1, Type: "float", Value: "1"}},
+		{{Number: 1, Type: grpcFieldInt, Value: "1"}, {Number: 1, Type: grpcFieldString, Value: "1"}},
+	} {
+		_, err = (&target{Path: "/s/M", GRPC: &grpcCall{Fields: fields}}).compile()
+		require.Error(t, err)
+	}
+
+	compiled, err := (&target{Path: "/s/M", GRPC: &grpcCall{}}).compile()
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPost, compiled.method)
+}
+
+func TestGRPCBody(t *testing.T) {
+	fields, err := (&grpcCall{Fields: []*grpcField{
+		{Number: 2, Type: grpcFieldString, Value: "42"},
+		{Number: 1, Type: grpcFieldInt, Value: "{{.WorkerID}}"},
+	}}).compile()
+	require.NoError(t, err)
+
+	body, err := newGRPCBody(fields, &templateData{WorkerID: 42})
+	require.NoError(t, err)
+	msg, err := grpcwire.ReadMessage(bytes.NewReader(body))
+	require.NoError(t, err)
+	parsed, err := grpcwire.ParseFields(msg)
+	require.NoError(t, err)
+	require.Len(t, parsed, 2)
+	require.Equal(t, grpcwire.WireVarint, parsed[0].WireType)
+	require.Equal(t, uint64(42), parsed[0].Varint)
+	// A string field holding a number is still sent as a string.
+	require.Equal(t, grpcwire.WireBytes, parsed[1].WireType)
+	require.Equal(t, "42", string(parsed[1].Bytes))
+
+	fields, err = (&grpcCall{Fields: []*grpcField{{Number: 1, Type: grpcFieldInt, Value: "name"}}}).compile()
+	require.NoError(t, err)
+	_, err = newGRPCBody(fields, &templateData{})
+	require.EqualError(t, err, `grpc field 1 should be an integer, got "name"`)
+}
+
+func TestGRPCFlags(t *testing.T) {
+	s := resolveScenarioFromArgs(t, "--grpc-field", "1:int=500", "--grpc-field", "2:string={{.WorkerID}}")
+	require.Equal(t, "/benchmarks.Benchmark/Prime", s.Target.Path)
+	require.Equal(t, http.MethodPost, s.Target.Method)
+	require.Equal(t, []*grpcField{
+		{Number: 1, Type: grpcFieldInt, Value: "500"},
+		{Number: 2, Type: grpcFieldString, Value: "{{.WorkerID}}"},
+	}, s.Target.GRPC.Fields)
+	require.Empty(t, s.Target.Query)
+
+	// The type of a field has to be given.
+	_, err := parseGRPCField("1=500")
+	require.Error(t, err)
+
+	// gRPC needs HTTP/2, which plain http endpoints only get with h2c.
+	_, _, err = s.newRequestFuncs()
+	require.Error(t, err)
+	s.Client.H2C = true
+	_, _, err = s.newRequestFuncs()
+	require.NoError(t, err)
+}
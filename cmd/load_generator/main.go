@@ -1,18 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
 	"github.com/jlym/webservice-benchmarks/util"
-	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 )
 
@@ -22,7 +19,43 @@ func main() {
 	config := &webservice_benchmarks.TestConfig{
 		RunID: util.NewID(),
 	}
-	var serverBaseEndpoint string
+	scenarioFlags := &scenarioFlags{}
+
+	// prepare resolves the scenario, applies it to config and returns the
+	// function that sends its requests. repeated is set when the function
+	// is used for several runs.
+	prepare := func(c *cli.Context, repeated bool) (webservice_benchmarks.SendRequestFunc, error) {
+		s, err := scenarioFlags.resolve(c)
+		if err != nil {
+			return nil, err
+		}
+		if repeated {
+			err = s.checkRepeatable()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = s.applyTo(config)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println(fmt.Sprintf("Scenario: %v", scenarioFlags.scenarioFile))
+		log.Println(fmt.Sprintf("ServiceBaseEndpoint: %v", s.Endpoint))
+		log.Println(fmt.Sprintf("Label: %v", s.Label))
+
+		newFuncs := s.newRequestFuncs
+		if s.Connections != nil {
+			newFuncs = s.newConnectionFuncs
+		}
+		send, closeWorker, err := newFuncs()
+		if err != nil {
+			return nil, err
+		}
+		config.CloseWorker = closeWorker
+		return send, nil
+	}
 
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
@@ -31,45 +64,51 @@ func main() {
 			Required:    true,
 			Destination: &config.DBFilePath,
 		},
-		cli.IntFlag{
-			Name:        "parallel",
-			Usage:       "Number of goroutines that will be sending requests.",
-			Value:       10,
-			Destination: &config.NumWorkers,
-		},
-		cli.DurationFlag{
-			Name:        "test-duration",
-			Usage:       "The amount of time the test should run (after ramp up).",
-			Value:       time.Minute * 2,
-			Destination: &config.TestDuration,
-		},
 		cli.DurationFlag{
-			Name:        "ramp-up-duration",
-			Usage:       "The amount of time the test waits before creating a new goroutine.",
-			Value:       0,
-			Destination: &config.RampUpDuration,
+			Name:        "progress-interval",
+			Usage:       "How often to log a summary of the requests of the last interval while a run is going. 0 turns it off.",
+			Value:       time.Second * 5,
+			Destination: &config.ProgressInterval,
 		},
 		cli.StringFlag{
-			Name:        "endpoint",
-			Usage:       "The base endpoint of the server. (format: [hostname]:[port])",
-			Value:       "localhost:8080",
-			Destination: &serverBaseEndpoint,
+			Name:        "control-addr",
+			Usage:       "The address to serve the control API on while a run is going, e.g. localhost:8089. It can read live stats, change the workers or rate, pause, annotate and stop the run. Off if empty.",
+			Destination: &config.ControlAddr,
 		},
 	}
-	app.Action = func(_ *cli.Context) error {
+	app.Flags = append(app.Flags, scenarioFlags.flags()...)
+	app.Action = func(c *cli.Context) error {
+		f, err := prepare(c, false)
+		if err != nil {
+			return err
+		}
+
 		log.Println(fmt.Sprintf("DBFilePath: %v", config.DBFilePath))
 		log.Println(fmt.Sprintf("NumWorkers: %v", config.NumWorkers))
+		log.Println(fmt.Sprintf("ArrivalRate: %v", config.ArrivalRate))
 		log.Println(fmt.Sprintf("RampUpDuration: %v", config.RampUpDuration))
 		log.Println(fmt.Sprintf("RunID: %v", config.RunID))
 		log.Println(fmt.Sprintf("TestDuration: %v", config.TestDuration))
-		log.Println(fmt.Sprintf("ServiceBaseEndpoint: %v", serverBaseEndpoint))
-
-		client := newClient(serverBaseEndpoint)
-
-		return webservice_benchmarks.GenerateLoad(config, func(workerID int) error {
-			_, err := client.calcNthPrime(1000)
-			return err
-		})
+		log.Println(fmt.Sprintf("RequestTimeout: %v", config.RequestTimeout))
+		log.Println(fmt.Sprintf("ShutdownTimeout: %v", config.ShutdownTimeout))
+		stages := make([]string, 0, len(config.Stages))
+		for _, stage := range config.Stages {
+			stages = append(stages, stage.String())
+		}
+		log.Println(fmt.Sprintf("Stages: %v", strings.Join(stages, ", ")))
+		log.Println(fmt.Sprintf("AbortRules: %v, AbortWindow: %v", config.AbortRules, config.AbortWindow))
+		log.Println(fmt.Sprintf("ControlAddr: %v", config.ControlAddr))
+		if config.Controller != nil {
+			log.Println(fmt.Sprintf("Controller: %v, LatencyTarget: %v", config.Controller.Algorithm, config.Controller.TargetP99))
+		}
+
+		ctx, stop := util.SignalContext(context.Background())
+		defer stop()
+		return webservice_benchmarks.GenerateLoad(ctx, config, f)
+	}
+	app.Commands = []cli.Command{
+		newSearchCommand(config, prepare),
+		newSweepCommand(config, prepare),
 	}
 
 	err := app.Run(os.Args)
@@ -78,48 +117,3 @@ func main() {
 	}
 	log.Println("Done")
 }
-
-type client struct {
-	client       *http.Client
-	baseEndpoint string
-}
-
-func newClient(baseEndpoint string) *client {
-	return &client{
-		client:       &http.Client{},
-		baseEndpoint: baseEndpoint,
-	}
-}
-
-func (c *client) calcNthPrime(n int) (int, error) {
-	query := url.Values{}
-	query.Set("n", strconv.Itoa(n))
-
-	u := url.URL{
-		Scheme:   "http",
-		Host:     c.baseEndpoint,
-		Path:     "prime",
-		RawQuery: query.Encode(),
-	}
-	resp, err := c.client.Get(u.String())
-	if err != nil {
-		return 0, errors.Wrap(err, "sending request failed")
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, errors.Wrap(err, "reading response body failed")
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, errors.Errorf("unexpected stauts - %d %s; body - %s", resp.StatusCode, resp.Status, string(body))
-	}
-
-	result, err := strconv.Atoi(string(body))
-	if err != nil {
-		return 0, errors.Wrap(err, "response body was not an int")
-	}
-
-	return result, nil
-}
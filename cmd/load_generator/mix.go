@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// operation is a single request, or a journey of steps sent in order by the same worker.
+type operation struct {
+	Name string `yaml:"name"`
+	// Weight is how often the operation is picked relative to the others.
+	// It defaults to 1.
+	Weight int     `yaml:"weight,omitempty"`
+	Target *target `yaml:"target,omitempty"`
+	Steps  []*step `yaml:"steps,omitempty"`
+}
+
+type step struct {
+	Name    string                `yaml:"name"`
+	Target  *target               `yaml:"target"`
+	Extract map[string]*extractor `yaml:"extract,omitempty"`
+}
+
+// extractor takes a value from a response; exactly one of its fields is set.
+type extractor struct {
+	// JSON is a dot separated path into a JSON body, e.g. items.0.id.
+	JSON string `yaml:"json,omitempty"`
+	// Regex is matched against the body. The value is the first capture
+	// group, or the whole match if there are none.
+	Regex  string `yaml:"regex,omitempty"`
+	Header string `yaml:"header,omitempty"`
+}
+
+type compiledOperation struct {
+	name   string
+	weight int
+	steps  []*compiledStep
+}
+
+type compiledStep struct {
+	// name is what the step's requests are recorded as.
+	name    string
+	target  *compiledTarget
+	extract map[string]*compiledExtractor
+}
+
+type compiledExtractor struct {
+	jsonPath []string
+	regex    *regexp.Regexp
+	header   string
+}
+
+func (o *operation) compile() (*compiledOperation, error) {
+	if o.Name == "" {
+		return nil, errors.New("request has no name")
+	}
+	if o.Weight < 0 {
+		return nil, errors.Errorf("request %s has a negative weight", o.Name)
+	}
+	if (o.Target == nil) == (len(o.Steps) == 0) {
+		return nil, errors.Errorf("request %s should have either a target or steps", o.Name)
+	}
+
+	weight := o.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	compiled := &compiledOperation{
+		name:   o.Name,
+		weight: weight,
+	}
+
+	if o.Target != nil {
+		target, err := o.Target.compile()
+		if err != nil {
+			return nil, errors.Wrapf(err, "request %s", o.Name)
+		}
+		compiled.steps = []*compiledStep{{name: o.Name, target: target}}
+		return compiled, nil
+	}
+
+	for i, s := range o.Steps {
+		if s.Name == "" {
+			return nil, errors.Errorf("step %d of request %s has no name", i, o.Name)
+		}
+		if s.Target == nil {
+			return nil, errors.Errorf("step %s of request %s has no target", s.Name, o.Name)
+		}
+
+		target, err := s.Target.compile()
+		if err != nil {
+			return nil, errors.Wrapf(err, "step %s of request %s", s.Name, o.Name)
+		}
+
+		extract := make(map[string]*compiledExtractor, len(s.Extract))
+		for name, e := range s.Extract {
+			extract[name], err = e.compile()
+			if err != nil {
+				return nil, errors.Wrapf(err, "extracting %s in step %s of request %s", name, s.Name, o.Name)
+			}
+		}
+
+		compiled.steps = append(compiled.steps, &compiledStep{
+			name:    o.Name + "/" + s.Name,
+			target:  target,
+			extract: extract,
+		})
+	}
+
+	return compiled, nil
+}
+
+func (e *extractor) compile() (*compiledExtractor, error) {
+	set := 0
+	for _, field := range []string{e.JSON, e.Regex, e.Header} {
+		if field != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("exactly one of json, regex and header should be set")
+	}
+
+	compiled := &compiledExtractor{header: e.Header}
+	if e.JSON != "" {
+		compiled.jsonPath = strings.Split(e.JSON, ".")
+	}
+	if e.Regex != "" {
+		var err error
+		compiled.regex, err = regexp.Compile(e.Regex)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid regex")
+		}
+	}
+
+	return compiled, nil
+}
+
+// extractValues returns the values the step takes from its response.
+func (s *compiledStep) extractValues(resp *http.Response, body []byte) (map[string]string, error) {
+	values := make(map[string]string, len(s.extract))
+	for name, e := range s.extract {
+		value, err := e.extract(resp, body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "extracting %s failed", name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func (e *compiledExtractor) extract(resp *http.Response, body []byte) (string, error) {
+	switch {
+	case e.header != "":
+		value := resp.Header.Get(e.header)
+		if value == "" {
+			return "", errors.Errorf("no %s header", e.header)
+		}
+		return value, nil
+
+	case e.regex != nil:
+		match := e.regex.FindSubmatch(body)
+		if match == nil {
+			return "", errors.Errorf("body doesn't match %s", e.regex)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+
+	default:
+		return extractJSON(body, e.jsonPath)
+	}
+}
+
+func extractJSON(body []byte, path []string) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return "", errors.Wrap(err, "body is not JSON")
+	}
+
+	for i, key := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			value, ok = v[key]
+			if !ok {
+				return "", errors.Errorf("no %s in body", strings.Join(path[:i+1], "."))
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return "", errors.Errorf("no %s in body", strings.Join(path[:i+1], "."))
+			}
+			value = v[index]
+		default:
+			return "", errors.Errorf("no %s in body", strings.Join(path[:i+1], "."))
+		}
+	}
+
+	return jsonValueString(value)
+}
+
+// requestMix picks the operation each worker runs next.
+type requestMix struct {
+	operations  []*compiledOperation
+	totalWeight int
+
+	mu       sync.Mutex
+	journeys map[int]*journey
+}
+
+// journey is a worker's progress through an operation.
+type journey struct {
+	operation *compiledOperation
+	step      int
+	vars      map[string]string
+	// feed is drawn from the feeders when the journey starts, so every
+	// step uses the same records.
+	feed map[string]map[string]string
+}
+
+func newRequestMix(operations []*compiledOperation) *requestMix {
+	totalWeight := 0
+	for _, o := range operations {
+		totalWeight += o.weight
+	}
+
+	return &requestMix{
+		operations:  operations,
+		totalWeight: totalWeight,
+		journeys:    make(map[int]*journey),
+	}
+}
+
+// next returns the journey workerID is in, starting one picked by weight if needed.
+func (m *requestMix) next(workerID int) *journey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.journeys[workerID]
+	if ok {
+		return j
+	}
+
+	j = &journey{
+		operation: m.pick(),
+		vars:      make(map[string]string),
+	}
+	m.journeys[workerID] = j
+	return j
+}
+
+func (m *requestMix) pick() *compiledOperation {
+	n := rand.Intn(m.totalWeight)
+	for _, o := range m.operations {
+		if n < o.weight {
+			return o
+		}
+		n -= o.weight
+	}
+	return m.operations[len(m.operations)-1]
+}
+
+// advance moves workerID to the next step of its journey with the extracted values.
+func (m *requestMix) advance(workerID int, values map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := m.journeys[workerID]
+	for name, value := range values {
+		j.vars[name] = value
+	}
+
+	j.step++
+	if j.step == len(j.operation.steps) {
+		delete(m.journeys, workerID)
+	}
+}
+
+// abandon ends workerID's journey after a step failed.
+func (m *requestMix) abandon(workerID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.journeys, workerID)
+}
+
+func (j *journey) currentStep() *compiledStep {
+	return j.operation.steps[j.step]
+}
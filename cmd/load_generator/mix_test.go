@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractJSON(t *testing.T) {
+	body := []byte(`{"token": "abc", "items": [{"id": 12345678901}, {"id": 2}], "ok": true}`)
+
+	value, err := extractJSON(body, []string{"token"})
+	require.NoError(t, err)
+	require.Equal(t, "abc", value)
+
+	value, err = extractJSON(body, []string{"items", "0", "id"})
+	require.NoError(t, err)
+	require.Equal(t, "12345678901", value)
+
+	value, err = extractJSON(body, []string{"ok"})
+	require.NoError(t, err)
+	require.Equal(t, "true", value)
+
+	value, err = extractJSON(body, []string{"items", "1"})
+	require.NoError(t, err)
+	require.Equal(t, `{"id":2}`, value)
+
+	_, err = extractJSON(body, []string{"items", "2"})
+	require.Error(t, err)
+	_, err = extractJSON(body, []string{"token", "x"})
+	require.Error(t, err)
+	_, err = extractJSON([]byte("not json"), []string{"token"})
+	require.Error(t, err)
+}
+
+func TestOperationCompile(t *testing.T) {
+	_, err := (&operation{Name: "none"}).compile()
+	require.Error(t, err)
+
+	_, err = (&operation{Name: "both", Target: &target{}, Steps: []*step{{Name: "a", Target: &target{}}}}).compile()
+	require.Error(t, err)
+
+	_, err = (&operation{Name: "negative", Weight: -1, Target: &target{}}).compile()
+	require.Error(t, err)
+
+	_, err = (&operation{Name: "extractors", Steps: []*step{{
+		Name:    "a",
+		Target:  &target{},
+		Extract: map[string]*extractor{"x": {JSON: "a", Header: "b"}},
+	}}}).compile()
+	require.Error(t, err)
+
+	compiled, err := (&operation{Name: "journey", Steps: []*step{
+		{Name: "a", Target: &target{}},
+		{Name: "b", Target: &target{}},
+	}}).compile()
+	require.NoError(t, err)
+	require.Equal(t, 1, compiled.weight)
+	require.Len(t, compiled.steps, 2)
+	require.Equal(t, "journey/a", compiled.steps[0].name)
+	require.Equal(t, "journey/b", compiled.steps[1].name)
+}
+
+func TestRequestMixWeights(t *testing.T) {
+	mix := newRequestMix([]*compiledOperation{
+		{name: "often", weight: 4, steps: []*compiledStep{{name: "often"}}},
+		{name: "rarely", weight: 1, steps: []*compiledStep{{name: "rarely"}}},
+	})
+
+	counts := make(map[string]int)
+	for i := 0; i < 5000; i++ {
+		journey := mix.next(0)
+		counts[journey.currentStep().name]++
+		mix.advance(0, nil)
+	}
+
+	require.InDelta(t, 4000, counts["often"], 250)
+	require.InDelta(t, 1000, counts["rarely"], 250)
+}
+
+func TestJourney(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("X-Session", "session-"+r.URL.Query().Get("user"))
+			_, _ = w.Write([]byte(`{"token": "secret"}`))
+		case "/orders":
+			if r.Header.Get("Authorization") != "secret" || r.Header.Get("X-Session") != "session-7" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("order 42 created"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	s := &scenario{
+		Requests: []*operation{{
+			Name: "checkout",
+			Steps: []*step{
+				{
+					Name:   "login",
+					Target: &target{Path: "/login", Query: map[string]string{"user": "{{.WorkerID}}"}},
+					Extract: map[string]*extractor{
+						"token":   {JSON: "token"},
+						"session": {Header: "X-Session"},
+					},
+				},
+				{
+					Name: "order",
+					Target: &target{Method: "POST", Path: "/orders", Headers: map[string]string{
+						"Authorization": "{{.Vars.token}}",
+						"X-Session":     "{{.Vars.session}}",
+					}},
+					Extract: map[string]*extractor{"order": {Regex: `order (\d+)`}},
+				},
+				{
+					Name:   "missing",
+					Target: &target{Path: "/missing"},
+				},
+			},
+		}},
+	}
+	operations, err := s.compileRequests()
+	require.NoError(t, err)
+
+	base, err := parseEndpoint(server.URL)
+	require.NoError(t, err)
+	mix := newRequestMix(operations)
+	c, err := newClient(base, &clientSettings{}, mix)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	result, err := c.sendRequest(ctx, 7)
+	require.NoError(t, err)
+	require.Equal(t, "checkout/login", result.Name)
+
+	result, err = c.sendRequest(ctx, 7)
+	require.NoError(t, err)
+	require.Equal(t, "checkout/order", result.Name)
+	require.Equal(t, "42", mix.next(7).vars["order"])
+
+	result, err = c.sendRequest(ctx, 7)
+	require.Error(t, err)
+	require.Equal(t, "checkout/missing", result.Name)
+	require.Equal(t, sqlite.ValidationFailed, result.Validation)
+
+	// A failed step ends the journey, so the next request starts over.
+	result, err = c.sendRequest(ctx, 7)
+	require.NoError(t, err)
+	require.Equal(t, "checkout/login", result.Name)
+
+	// Another worker doesn't have the first worker's session.
+	_, err = c.sendRequest(ctx, 8)
+	require.NoError(t, err)
+	mix.next(8).vars["session"] = "session-9"
+	_, err = c.sendRequest(ctx, 8)
+	require.Error(t, err)
+}
+
+func TestScenarioRequestsExcludeTarget(t *testing.T) {
+	_, err := (&scenario{}).compileRequests()
+	require.Error(t, err)
+
+	_, err = (&scenario{
+		Target:   &target{Path: "/time"},
+		Requests: []*operation{{Name: "a", Target: &target{}}},
+	}).compileRequests()
+	require.Error(t, err)
+
+	_, err = (&scenario{Requests: []*operation{
+		{Name: "a", Target: &target{}},
+		{Name: "a", Target: &target{}},
+	}}).compileRequests()
+	require.Error(t, err)
+
+	operations, err := (&scenario{Target: &target{Method: "get", Path: "/time"}}).compileRequests()
+	require.NoError(t, err)
+	require.Len(t, operations, 1)
+	require.Equal(t, "GET /time", operations[0].name)
+}
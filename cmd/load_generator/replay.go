@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+const (
+	replayTimingFast = "fast"
+	// replayTimingOriginal keeps the gaps between the logged timestamps, divided by the speed.
+	replayTimingOriginal = "original"
+)
+
+type replaySettings struct {
+	// Log is the path to a JSONL file with one replayEntry per line.
+	Log    string  `yaml:"log"`
+	Timing string  `yaml:"timing,omitempty"`
+	Speed  float64 `yaml:"speed,omitempty"`
+}
+
+func (r *replaySettings) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "replay-log",
+			Usage:       "Path to a JSONL request log to replay instead of sending the target. Each line has method, url, and optionally name, headers, body and timestamp (RFC 3339). A relative url is sent to --endpoint.",
+			Destination: &r.Log,
+		},
+		cli.StringFlag{
+			Name:        "replay-timing",
+			Usage:       "fast to replay the log as fast as the workers allow, or original to keep the gaps between the logged timestamps. (default: fast)",
+			Destination: &r.Timing,
+		},
+		cli.Float64Flag{
+			Name:        "replay-speed",
+			Usage:       "With --replay-timing original, how many times faster than logged to replay. (default: 1)",
+			Destination: &r.Speed,
+		},
+	}
+}
+
+func (r *replaySettings) timing() string {
+	if r.Timing == "" {
+		return replayTimingFast
+	}
+	return r.Timing
+}
+
+type replayEntry struct {
+	// Name defaults to the request's method and path.
+	Name      string            `json:"name"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"`
+	Body      string            `json:"body"`
+	Timestamp *time.Time        `json:"timestamp"`
+}
+
+const maxReplayLineLen = 16 * 1024 * 1024
+
+func (r *replaySettings) load() ([]*replayEntry, error) {
+	if r.Log == "" {
+		return nil, errors.New("no request log to replay")
+	}
+	switch r.timing() {
+	case replayTimingFast, replayTimingOriginal:
+	default:
+		return nil, errors.Errorf("replay timing should be %s or %s, got %q", replayTimingFast, replayTimingOriginal, r.Timing)
+	}
+	if r.Speed < 0 {
+		return nil, errors.New("replay speed can't be negative")
+	}
+
+	file, err := os.Open(r.Log)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening request log failed")
+	}
+	defer file.Close()
+
+	entries, err := readReplayEntries(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading request log %s failed", r.Log)
+	}
+	if len(entries) == 0 {
+		return nil, errors.Errorf("request log %s is empty", r.Log)
+	}
+
+	if r.timing() == replayTimingOriginal {
+		for i, entry := range entries {
+			if entry.Timestamp == nil {
+				return nil, errors.Errorf("request %d of %s has no timestamp, which replaying with the original timing needs", i, r.Log)
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Timestamp.Before(*entries[j].Timestamp)
+		})
+	}
+
+	return entries, nil
+}
+
+func readReplayEntries(reader io.Reader) ([]*replayEntry, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLineLen)
+
+	entries := make([]*replayEntry, 0)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		entry := &replayEntry{}
+		err := json.Unmarshal([]byte(line), entry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", lineNumber)
+		}
+		if entry.URL == "" {
+			return nil, errors.Errorf("line %d has no url", lineNumber)
+		}
+		if entry.Method == "" {
+			entry.Method = http.MethodGet
+		}
+		entry.Method = strings.ToUpper(entry.Method)
+
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "scanning failed")
+	}
+
+	return entries, nil
+}
+
+// schedule returns when to send each entry, or nil to send them as fast as the workers allow.
+func (r *replaySettings) schedule(entries []*replayEntry) []time.Duration {
+	if r.timing() != replayTimingOriginal {
+		return nil
+	}
+
+	speed := r.Speed
+	if speed == 0 {
+		speed = 1
+	}
+
+	first := *entries[0].Timestamp
+	offsets := make([]time.Duration, 0, len(entries))
+	for _, entry := range entries {
+		offset := entry.Timestamp.Sub(first)
+		offsets = append(offsets, time.Duration(float64(offset)/speed))
+	}
+
+	return offsets
+}
+
+// replayer shares the entries of a request log between the workers, sending each once.
+type replayer struct {
+	client  *client
+	baseURL *url.URL
+	entries []*replayEntry
+	next    int64
+}
+
+func newReplayer(client *client, baseURL *url.URL, entries []*replayEntry) *replayer {
+	return &replayer{
+		client:  client,
+		baseURL: baseURL,
+		entries: entries,
+	}
+}
+
+func (r *replayer) sendRequest(ctx context.Context, workerID int) (*webservice_benchmarks.RequestResult, error) {
+	i := atomic.AddInt64(&r.next, 1) - 1
+	if i >= int64(len(r.entries)) {
+		return &webservice_benchmarks.RequestResult{}, webservice_benchmarks.ErrNoMoreRequests
+	}
+	entry := r.entries[i]
+
+	req, err := entry.newRequest(ctx, r.baseURL)
+	if err != nil {
+		return &webservice_benchmarks.RequestResult{Name: entry.Name}, err
+	}
+
+	name := entry.Name
+	if name == "" {
+		name = entry.Method + " " + req.URL.Path
+	}
+
+	resp, body, result, err := r.client.do(workerID, req)
+	result.Name = name
+	if err != nil {
+		return result, err
+	}
+
+	// The log doesn't say what the original response was, so any non-error passes.
+	if resp.StatusCode >= http.StatusBadRequest {
+		result.Validation = sqlite.ValidationFailed
+		result.FailedAssertion = "status"
+		return result, errors.Errorf(
+			"unexpected status - %s; body - %s", resp.Status, truncate(body, maxErrorBodyLen))
+	}
+
+	result.Validation = sqlite.ValidationPassed
+	return result, nil
+}
+
+// newRequest builds the logged request, resolving a relative URL against base like a target's path.
+func (e *replayEntry) newRequest(ctx context.Context, base *url.URL) (*http.Request, error) {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid url %q", e.URL)
+	}
+	if !u.IsAbs() {
+		ref := u
+		copied := *base
+		u = &copied
+		u.Path = strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(ref.Path, "/")
+		u.RawQuery = ref.RawQuery
+	}
+
+	var body io.Reader
+	if e.Body != "" {
+		body = strings.NewReader(e.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, e.Method, u.String(), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request failed")
+	}
+
+	for name, value := range e.Headers {
+		req.Header.Set(name, value)
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+		}
+	}
+
+	return req, nil
+}
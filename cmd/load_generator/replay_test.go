@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/stretchr/testify/require"
+)
+
+const testReplayLog = `
+{"method": "post", "url": "/items?x=1", "headers": {"X-Test": "yes"}, "body": "hello", "timestamp": "2020-01-01T00:00:02Z"}
+{"url": "/time", "timestamp": "2020-01-01T00:00:00Z", "status": 200}
+
+{"name": "prime", "url": "/prime?n=10", "timestamp": "2020-01-01T00:00:01Z"}
+`
+
+func writeTestReplayLog(t *testing.T, contents string) string {
+	logFile := filepath.Join(t.TempDir(), "requests.jsonl")
+	err := ioutil.WriteFile(logFile, []byte(contents), 0644)
+	require.NoError(t, err)
+	return logFile
+}
+
+func TestReadReplayEntries(t *testing.T) {
+	entries, err := readReplayEntries(strings.NewReader(testReplayLog))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "POST", entries[0].Method)
+	require.Equal(t, "/items?x=1", entries[0].URL)
+	require.Equal(t, map[string]string{"X-Test": "yes"}, entries[0].Headers)
+	require.Equal(t, "hello", entries[0].Body)
+	require.Equal(t, time.Date(2020, 1, 1, 0, 0, 2, 0, time.UTC), *entries[0].Timestamp)
+	require.Equal(t, http.MethodGet, entries[1].Method)
+
+	_, err = readReplayEntries(strings.NewReader(`{"method": "GET"}`))
+	require.Error(t, err)
+	_, err = readReplayEntries(strings.NewReader(`not json`))
+	require.Error(t, err)
+}
+
+func TestReplaySchedule(t *testing.T) {
+	settings := &replaySettings{Log: writeTestReplayLog(t, testReplayLog)}
+	entries, err := settings.load()
+	require.NoError(t, err)
+	require.Nil(t, settings.schedule(entries))
+
+	settings.Timing = replayTimingOriginal
+	settings.Speed = 2
+	entries, err = settings.load()
+	require.NoError(t, err)
+	require.Equal(t, "/time", entries[0].URL)
+	require.Equal(t, "/prime?n=10", entries[1].URL)
+	require.Equal(t, "/items?x=1", entries[2].URL)
+	require.Equal(t, []time.Duration{0, time.Millisecond * 500, time.Second}, settings.schedule(entries))
+
+	settings.Log = writeTestReplayLog(t, `{"url": "/time"}`)
+	_, err = settings.load()
+	require.Error(t, err)
+
+	settings.Timing = "later"
+	_, err = settings.load()
+	require.Error(t, err)
+}
+
+func TestReplayer(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		paths = append(paths, r.Method+" "+r.URL.String()+" "+r.Header.Get("X-Test")+" "+string(body))
+		if r.URL.Path == "/api/prime" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	entries, err := readReplayEntries(strings.NewReader(testReplayLog))
+	require.NoError(t, err)
+	entries = append(entries, &replayEntry{Method: "GET", URL: server.URL + "/absolute"})
+
+	base, err := parseEndpoint(server.URL + "/api")
+	require.NoError(t, err)
+	c, err := newClient(base, &clientSettings{}, nil)
+	require.NoError(t, err)
+	r := newReplayer(c, base, entries)
+	ctx := context.Background()
+
+	result, err := r.sendRequest(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, "POST /api/items", result.Name)
+
+	result, err = r.sendRequest(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, "GET /api/time", result.Name)
+
+	result, err = r.sendRequest(ctx, 0)
+	require.Error(t, err)
+	require.Equal(t, "prime", result.Name)
+
+	_, err = r.sendRequest(ctx, 0)
+	require.NoError(t, err)
+
+	_, err = r.sendRequest(ctx, 0)
+	require.Equal(t, webservice_benchmarks.ErrNoMoreRequests, err)
+
+	require.Equal(t, []string{
+		"POST /api/items?x=1 yes hello",
+		"GET /api/time  ",
+		"GET /api/prime?n=10  ",
+		"GET /absolute  ",
+	}, paths)
+}
+
+func TestScenarioReplayFromFlags(t *testing.T) {
+	logFile := writeTestReplayLog(t, testReplayLog)
+
+	s := resolveScenarioFromArgs(t, "--replay-log", logFile, "--replay-timing", "original")
+	require.Nil(t, s.Target)
+	require.Equal(t, logFile, s.Replay.Log)
+
+	config := &webservice_benchmarks.TestConfig{}
+	err := s.applyTo(config)
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{0, time.Second, time.Second * 2}, config.Schedule)
+}
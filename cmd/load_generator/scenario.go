@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// scenario is everything needed to reproduce a run, and is stored with every run.
+type scenario struct {
+	Desc     string         `yaml:"desc,omitempty"`
+	Endpoint string         `yaml:"endpoint"`
+	Label    string         `yaml:"label,omitempty"`
+	Load     loadSettings   `yaml:"load"`
+	Client   clientSettings `yaml:"client"`
+	Target   *target        `yaml:"target,omitempty"`
+	// Requests is a weighted mix of requests and journeys sent instead of Target.
+	Requests    []*operation        `yaml:"requests,omitempty"`
+	Feeders     []*feeder           `yaml:"feeders,omitempty"`
+	Replay      *replaySettings     `yaml:"replay,omitempty"`
+	Connections *connectionSettings `yaml:"connections,omitempty"`
+
+	replayLog []*replayEntry
+}
+
+type loadSettings struct {
+	Workers         int           `yaml:"workers"`
+	Rate            float64       `yaml:"rate,omitempty"`
+	TestDuration    time.Duration `yaml:"test_duration"`
+	RampUpDuration  time.Duration `yaml:"ramp_up_duration,omitempty"`
+	Stages          []string      `yaml:"stages,omitempty"`
+	RequestTimeout  time.Duration `yaml:"request_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// AbortIf are the rules that stop the run early.
+	AbortIf     []string            `yaml:"abort_if,omitempty"`
+	AbortWindow time.Duration       `yaml:"abort_window,omitempty"`
+	Controller  *controllerSettings `yaml:"controller,omitempty"`
+}
+
+func loadScenario(filePath string) (*scenario, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading scenario file failed")
+	}
+
+	s := &scenario{}
+	err = yaml.UnmarshalStrict(b, s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing scenario file %s failed", filePath)
+	}
+
+	return s, nil
+}
+
+type scenarioFlags struct {
+	scenarioFile string
+	scenario     scenario
+	stages       cli.StringSlice
+	abortIf      cli.StringSlice
+	feeders      cli.StringSlice
+	target       targetFlags
+	replay       replaySettings
+	connections  connectionSettings
+	controller   controllerSettings
+}
+
+func (f *scenarioFlags) flags() []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:        "scenario",
+			Usage:       "Path to a YAML or JSON scenario file. Flags given on the command line override the values in the file.",
+			Destination: &f.scenarioFile,
+		},
+		cli.StringFlag{
+			Name:        "desc",
+			Usage:       "A description of the run.",
+			Destination: &f.scenario.Desc,
+		},
+		cli.IntFlag{
+			Name:        "parallel",
+			Usage:       "Number of goroutines that will be sending requests.",
+			Value:       10,
+			Destination: &f.scenario.Load.Workers,
+		},
+		cli.DurationFlag{
+			Name:        "test-duration",
+			Usage:       "The amount of time the test should run (after ramp up).",
+			Value:       time.Minute * 2,
+			Destination: &f.scenario.Load.TestDuration,
+		},
+		cli.DurationFlag{
+			Name:        "ramp-up-duration",
+			Usage:       "The amount of time the test waits before creating a new goroutine.",
+			Value:       0,
+			Destination: &f.scenario.Load.RampUpDuration,
+		},
+		cli.Float64Flag{
+			Name:        "rate",
+			Usage:       "Requests per second to send regardless of how fast the server responds. When set, --parallel is the maximum number of requests in flight.",
+			Destination: &f.scenario.Load.Rate,
+		},
+		cli.DurationFlag{
+			Name:        "request-timeout",
+			Usage:       "The amount of time a request can take before it is abandoned and recorded as a timeout. 0 means no limit.",
+			Value:       time.Second * 30,
+			Destination: &f.scenario.Load.RequestTimeout,
+		},
+		cli.DurationFlag{
+			Name:        "shutdown-timeout",
+			Usage:       "The amount of time to wait for in-flight requests at the end of the test before cancelling them. 0 means no limit.",
+			Value:       time.Second * 10,
+			Destination: &f.scenario.Load.ShutdownTimeout,
+		},
+		cli.StringSliceFlag{
+			Name:  "stage",
+			Usage: "A stage of the load profile, formatted as [name=]duration:target[:ramp]. The target is a number of workers, or a rate when it ends in /s (e.g. 5m:200:ramp or 1m:50/s). Can be repeated; replaces --test-duration, --ramp-up-duration and --rate.",
+			Value: &f.stages,
+		},
+		cli.StringSliceFlag{
+			Name:  "abort-if",
+			Usage: "Stop the run early when a rule, evaluated every second on the requests of the last --abort-window, fires. Formatted as metric>threshold or metric<threshold, e.g. error_rate>5%, p99>2s, throughput<100 or monitor.close_wait>500; monitor metrics are the highest value recorded into the same database by any monitor, for any process or host, so only one monitor should be writing to it. Can be repeated.",
+			Value: &f.abortIf,
+		},
+		cli.DurationFlag{
+			Name:        "abort-window",
+			Usage:       "The rolling window --abort-if rules are evaluated on. The rules start being evaluated once the run is this old.",
+			Value:       time.Second * 30,
+			Destination: &f.scenario.Load.AbortWindow,
+		},
+		cli.StringSliceFlag{
+			Name:  "feeder",
+			Usage: "A CSV or JSONL data file whose records templates use as {{.Feed.name.field}}, formatted as name=file[:order[:on_exhausted]]. order is sequential (default), random or unique (split between workers); on_exhausted is wrap (default) or stop. Can be repeated.",
+			Value: &f.feeders,
+		},
+		cli.StringFlag{
+			Name:        "endpoint",
+			Usage:       "The base endpoint of the server. (format: [hostname]:[port] or a base URL like http://[hostname]:[port]/api)",
+			Value:       "localhost:8080",
+			Destination: &f.scenario.Endpoint,
+		},
+		cli.StringFlag{
+			Name:        "label",
+			Usage:       "A label stored with every request, for telling apart requests in the results.",
+			Destination: &f.scenario.Label,
+		},
+	}
+
+	flags = append(flags, f.scenario.Client.flags()...)
+	flags = append(flags, f.target.flags()...)
+	flags = append(flags, f.replay.flags()...)
+	flags = append(flags, f.connections.flags()...)
+	return append(flags, f.controller.flags()...)
+}
+
+// resolve returns the scenario file, or the flags' scenario, with the given flags applied.
+func (f *scenarioFlags) resolve(c *cli.Context) (*scenario, error) {
+	fromFlags := f.scenario
+	fromFlags.Load.Stages = f.stages
+	fromFlags.Load.AbortIf = f.abortIf
+	for _, spec := range f.feeders {
+		feeder, err := parseFeeder(spec)
+		if err != nil {
+			return nil, err
+		}
+		fromFlags.Feeders = append(fromFlags.Feeders, feeder)
+	}
+	if f.replay.Log != "" {
+		replay := f.replay
+		fromFlags.Replay = &replay
+	}
+	if f.connections.Path != "" {
+		connections := f.connections
+		fromFlags.Connections = &connections
+	}
+	if f.controller.TargetP99 > 0 {
+		controller := f.controller
+		fromFlags.Load.Controller = &controller
+	}
+
+	s := &fromFlags
+	if f.scenarioFile != "" {
+		var err error
+		s, err = loadScenario(f.scenarioFile)
+		if err != nil {
+			return nil, err
+		}
+		f.override(c, s, &fromFlags)
+	}
+
+	s.Client = s.Client.withDefaults()
+
+	if s.Replay != nil || len(s.Requests) > 0 || s.Connections != nil {
+		if f.target.isSet() {
+			return nil, errors.New("the target flags can't be used with a scenario that has requests, replays a log or holds connections")
+		}
+		return s, nil
+	}
+
+	target, err := f.target.resolve(s.Target)
+	if err != nil {
+		return nil, err
+	}
+	s.Target = target
+
+	return s, nil
+}
+
+func (f *scenarioFlags) override(c *cli.Context, s *scenario, fromFlags *scenario) {
+	overrides := []struct {
+		flag  string
+		apply func()
+	}{
+		{"desc", func() { s.Desc = fromFlags.Desc }},
+		{"parallel", func() { s.Load.Workers = fromFlags.Load.Workers }},
+		{"test-duration", func() { s.Load.TestDuration = fromFlags.Load.TestDuration }},
+		{"ramp-up-duration", func() { s.Load.RampUpDuration = fromFlags.Load.RampUpDuration }},
+		{"rate", func() { s.Load.Rate = fromFlags.Load.Rate }},
+		{"request-timeout", func() { s.Load.RequestTimeout = fromFlags.Load.RequestTimeout }},
+		{"shutdown-timeout", func() { s.Load.ShutdownTimeout = fromFlags.Load.ShutdownTimeout }},
+		{"stage", func() { s.Load.Stages = fromFlags.Load.Stages }},
+		{"abort-if", func() { s.Load.AbortIf = fromFlags.Load.AbortIf }},
+		{"abort-window", func() { s.Load.AbortWindow = fromFlags.Load.AbortWindow }},
+		{"feeder", func() { s.Feeders = fromFlags.Feeders }},
+		{"disable-keep-alives", func() { s.Client.DisableKeepAlives = fromFlags.Client.DisableKeepAlives }},
+		{"max-idle-conns", func() { s.Client.MaxIdleConns = fromFlags.Client.MaxIdleConns }},
+		{"max-idle-conns-per-host", func() { s.Client.MaxIdleConnsPerHost = fromFlags.Client.MaxIdleConnsPerHost }},
+		{"max-conns-per-host", func() { s.Client.MaxConnsPerHost = fromFlags.Client.MaxConnsPerHost }},
+		{"idle-conn-timeout", func() { s.Client.IdleConnTimeout = fromFlags.Client.IdleConnTimeout }},
+		{"dial-timeout", func() { s.Client.DialTimeout = fromFlags.Client.DialTimeout }},
+		{"client-per-worker", func() { s.Client.PerWorker = fromFlags.Client.PerWorker }},
+		{"requests-per-conn", func() { s.Client.RequestsPerConn = fromFlags.Client.RequestsPerConn }},
+		{"source-ip", func() { s.Client.SourceIPs = fromFlags.Client.SourceIPs }},
+		{"source-ports", func() { s.Client.SourcePorts = fromFlags.Client.SourcePorts }},
+		{"unix-socket", func() { s.Client.UnixSocket = fromFlags.Client.UnixSocket }},
+		{"disable-http2", func() { s.Client.DisableHTTP2 = fromFlags.Client.DisableHTTP2 }},
+		{"h2c", func() { s.Client.H2C = fromFlags.Client.H2C }},
+		{"insecure-skip-verify", func() { s.Client.InsecureSkipVerify = fromFlags.Client.InsecureSkipVerify }},
+		{"endpoint", func() { s.Endpoint = fromFlags.Endpoint }},
+		{"label", func() { s.Label = fromFlags.Label }},
+		{"replay-log", func() { s.replaySettings().Log = f.replay.Log }},
+		{"replay-timing", func() { s.replaySettings().Timing = f.replay.Timing }},
+		{"replay-speed", func() { s.replaySettings().Speed = f.replay.Speed }},
+		{"websocket", func() { s.connectionSettings().Path = f.connections.Path }},
+		{"message-interval", func() { s.connectionSettings().MessageInterval = f.connections.MessageInterval }},
+		{"message-size", func() { s.connectionSettings().MessageSize = f.connections.MessageSize }},
+		{"latency-target", func() { s.controllerSettings().TargetP99 = f.controller.TargetP99 }},
+		{"controller", func() { s.controllerSettings().Algorithm = f.controller.Algorithm }},
+		{"controller-interval", func() { s.controllerSettings().Interval = f.controller.Interval }},
+		{"controller-max-error-rate", func() { s.controllerSettings().MaxErrorRate = f.controller.MaxErrorRate }},
+		{"controller-min", func() { s.controllerSettings().Min = f.controller.Min }},
+		{"controller-max", func() { s.controllerSettings().Max = f.controller.Max }},
+	}
+	for _, override := range overrides {
+		// The scenario flags are global, so subcommand flags of the same name are not overrides.
+		if c.GlobalIsSet(override.flag) {
+			override.apply()
+		}
+	}
+
+	if s.Endpoint == "" {
+		s.Endpoint = fromFlags.Endpoint
+	}
+}
+
+func (s *scenario) applyTo(config *webservice_benchmarks.TestConfig) error {
+	config.Desc = s.Desc
+	config.NumWorkers = s.Load.Workers
+	config.ArrivalRate = s.Load.Rate
+	config.TestDuration = s.Load.TestDuration
+	config.RampUpDuration = s.Load.RampUpDuration
+	config.RequestTimeout = s.Load.RequestTimeout
+	config.ShutdownTimeout = s.Load.ShutdownTimeout
+
+	config.Stages = nil
+	for _, stageSpec := range s.Load.Stages {
+		stage, err := webservice_benchmarks.ParseStage(stageSpec)
+		if err != nil {
+			return err
+		}
+		config.Stages = append(config.Stages, stage)
+	}
+
+	config.AbortRules = nil
+	for _, ruleSpec := range s.Load.AbortIf {
+		rule, err := webservice_benchmarks.ParseAbortRule(ruleSpec)
+		if err != nil {
+			return err
+		}
+		config.AbortRules = append(config.AbortRules, rule)
+	}
+	config.AbortWindow = s.Load.AbortWindow
+
+	config.Controller = nil
+	if s.Load.Controller != nil {
+		config.Controller = s.Load.Controller.controller()
+	}
+
+	config.Pacing = 0
+	if s.Connections != nil {
+		config.Pacing = s.Connections.interval()
+	}
+
+	config.Schedule = nil
+	if s.Replay != nil {
+		entries, err := s.loadReplayLog()
+		if err != nil {
+			return err
+		}
+		config.Schedule = s.Replay.schedule(entries)
+	}
+
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "serializing scenario failed")
+	}
+	config.Scenario = string(b)
+
+	b, err = json.Marshal(s.Client.withDefaults())
+	if err != nil {
+		return errors.Wrap(err, "serializing client settings failed")
+	}
+	config.ClientSettings = string(b)
+	config.Transport = s.Client.transport()
+
+	return nil
+}
+
+func (s *scenario) maxWorkers() int {
+	workers := s.Load.Workers
+	for _, stageSpec := range s.Load.Stages {
+		stage, err := webservice_benchmarks.ParseStage(stageSpec)
+		if err == nil && stage.Workers > workers {
+			workers = stage.Workers
+		}
+	}
+	return workers
+}
+
+// checkRepeatable returns an error if the scenario's requests can run out.
+func (s *scenario) checkRepeatable() error {
+	if s.Replay != nil {
+		return errors.New("a replayed log is used up by the first run, so a search or sweep can't replay one")
+	}
+	for _, f := range s.Feeders {
+		if f.OnExhausted == feederExhaustedStop {
+			return errors.Errorf("feeder %s stops when it runs out, so a search or sweep can't use it", f.Name)
+		}
+	}
+	return nil
+}
+
+func (s *scenario) replaySettings() *replaySettings {
+	if s.Replay == nil {
+		s.Replay = &replaySettings{}
+	}
+	return s.Replay
+}
+
+func (s *scenario) connectionSettings() *connectionSettings {
+	if s.Connections == nil {
+		s.Connections = &connectionSettings{}
+	}
+	return s.Connections
+}
+
+func (s *scenario) controllerSettings() *controllerSettings {
+	if s.Load.Controller == nil {
+		s.Load.Controller = &controllerSettings{}
+	}
+	return s.Load.Controller
+}
+
+func (s *scenario) loadReplayLog() ([]*replayEntry, error) {
+	if s.replayLog != nil {
+		return s.replayLog, nil
+	}
+
+	entries, err := s.Replay.load()
+	if err != nil {
+		return nil, err
+	}
+	s.replayLog = entries
+	return entries, nil
+}
+
+// compileRequests returns the request mix, or just the target if there is none.
+func (s *scenario) compileRequests() ([]*compiledOperation, error) {
+	requests := s.Requests
+	if len(requests) == 0 {
+		if s.Target == nil {
+			return nil, errors.New("scenario has neither a target nor requests")
+		}
+		requests = []*operation{{
+			Name:   strings.ToUpper(s.Target.Method) + " " + s.Target.Path,
+			Target: s.Target,
+		}}
+	} else if s.Target != nil {
+		return nil, errors.New("scenario should have either a target or requests")
+	}
+
+	names := make(map[string]bool, len(requests))
+	operations := make([]*compiledOperation, 0, len(requests))
+	for _, request := range requests {
+		if names[request.Name] {
+			return nil, errors.Errorf("more than one request is named %s", request.Name)
+		}
+		names[request.Name] = true
+
+		operation, err := request.compile()
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
+
+// newConnectionFuncs returns the send and closeWorker functions of a scenario with Connections.
+func (s *scenario) newConnectionFuncs() (send, closeWorker webservice_benchmarks.SendRequestFunc, err error) {
+	if s.Connections.Path == "" {
+		return nil, nil, errors.New("expected the path of the websocket endpoint to hold connections to")
+	}
+	if s.Replay != nil || len(s.Requests) > 0 || len(s.Feeders) > 0 {
+		return nil, nil, errors.New("connections can't be held while sending requests, feeders or a replayed log")
+	}
+	// Each worker holds a connection, so the load is a number of workers.
+	if s.Load.Rate > 0 {
+		return nil, nil, errors.New("connections can't be held at a rate, only by a number of workers")
+	}
+	for _, stageSpec := range s.Load.Stages {
+		stage, err := webservice_benchmarks.ParseStage(stageSpec)
+		if err == nil && stage.Rate > 0 {
+			return nil, nil, errors.Errorf("stage %q has a rate, connections can only be held by a number of workers", stageSpec)
+		}
+	}
+
+	baseURL, err := parseEndpoint(s.Endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	conns, err := newConnClient(baseURL, s.Connections, &s.Client)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Println(fmt.Sprintf("Connections to %s: a %d byte message every %v", conns.url, s.Connections.size(), s.Connections.interval()))
+
+	labelled := func(f webservice_benchmarks.SendRequestFunc) webservice_benchmarks.SendRequestFunc {
+		return func(ctx context.Context, workerID int) (*webservice_benchmarks.RequestResult, error) {
+			result, err := f(ctx, workerID)
+			if result != nil {
+				result.Label = s.Label
+			}
+			return result, err
+		}
+	}
+	return labelled(conns.sendMessage), labelled(conns.closeWorker), nil
+}
+
+func (s *scenario) newRequestFuncs() (send, closeWorker webservice_benchmarks.SendRequestFunc, err error) {
+	baseURL, err := parseEndpoint(s.Endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.Replay != nil {
+		if len(s.Feeders) > 0 {
+			return nil, nil, errors.New("feeders can't be used when replaying a log")
+		}
+
+		entries, err := s.loadReplayLog()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.Println(fmt.Sprintf("Replaying %d requests from %s, timing %s", len(entries), s.Replay.Log, s.Replay.timing()))
+		client, err := newClient(baseURL, &s.Client, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		replayer := newReplayer(client, baseURL, entries)
+		return func(ctx context.Context, workerID int) (*webservice_benchmarks.RequestResult, error) {
+			result, err := replayer.sendRequest(ctx, workerID)
+			result.Label = s.Label
+			return result, err
+		}, nil, nil
+	}
+
+	operations, err := s.compileRequests()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, o := range operations {
+		for _, step := range o.steps {
+			if step.target.grpc && baseURL.Scheme == "http" && !s.Client.H2C {
+				return nil, nil, errors.Errorf("request %s is a grpc call, which needs HTTP/2: use an https endpoint or h2c", step.name)
+			}
+			log.Println(fmt.Sprintf("Request %s: weight %d, %s %s, expecting %s", step.name, o.weight, step.target.method, step.target.path.Root.String(), step.target.expectedStatuses()))
+		}
+	}
+	feeders, err := loadFeeders(s.Feeders, s.maxWorkers())
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range feeders {
+		log.Println(fmt.Sprintf("Feeder %s: %d records, %s order", f.name, len(f.records), f.order))
+	}
+
+	client, err := newClient(baseURL, &s.Client, newRequestMix(operations))
+	if err != nil {
+		return nil, nil, err
+	}
+	client.feeders = feeders
+
+	send = func(ctx context.Context, workerID int) (*webservice_benchmarks.RequestResult, error) {
+		result, err := client.sendRequest(ctx, workerID)
+		result.Label = s.Label
+		return result, err
+	}
+	if len(feeders) > 0 {
+		// A stopped worker's feeder records go to the next one started.
+		closeWorker = func(ctx context.Context, workerID int) (*webservice_benchmarks.RequestResult, error) {
+			feeders.release(workerID)
+			return nil, nil
+		}
+	}
+	return send, closeWorker, nil
+}
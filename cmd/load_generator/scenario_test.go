@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func resolveScenarioFromArgs(t *testing.T, args ...string) *scenario {
+	f := &scenarioFlags{}
+	var s *scenario
+
+	app := cli.NewApp()
+	app.Flags = f.flags()
+	app.Action = func(c *cli.Context) error {
+		var err error
+		s, err = f.resolve(c)
+		return err
+	}
+
+	err := app.Run(append([]string{"load_generator"}, args...))
+	require.NoError(t, err)
+	return s
+}
+
+func TestScenarioFromFlags(t *testing.T) {
+	s := resolveScenarioFromArgs(t, "--parallel", "3", "--stage", "1m:5", "--label", "a")
+	require.Equal(t, 3, s.Load.Workers)
+	require.Equal(t, time.Minute*2, s.Load.TestDuration)
+	require.Equal(t, time.Second*30, s.Load.RequestTimeout)
+	require.Equal(t, []string{"1m:5"}, s.Load.Stages)
+	require.Equal(t, "localhost:8080", s.Endpoint)
+	require.Equal(t, "a", s.Label)
+	require.Equal(t, "/prime", s.Target.Path)
+}
+
+func TestScenarioFileWithOverrides(t *testing.T) {
+	scenarioFile := filepath.Join(t.TempDir(), "scenario.yaml")
+	err := ioutil.WriteFile(scenarioFile, []byte(`
+desc: steady time requests
+endpoint: localhost:9090
+load:
+  workers: 20
+  rate: 50
+  test_duration: 30s
+  request_timeout: 2s
+target:
+  path: /time
+  expect_status: [200]
+`), 0644)
+	require.NoError(t, err)
+
+	s := resolveScenarioFromArgs(t, "--scenario", scenarioFile, "--parallel", "5", "--method", "HEAD")
+	require.Equal(t, "steady time requests", s.Desc)
+	require.Equal(t, "localhost:9090", s.Endpoint)
+	require.Equal(t, 5, s.Load.Workers)
+	require.Equal(t, 50.0, s.Load.Rate)
+	require.Equal(t, time.Second*30, s.Load.TestDuration)
+	require.Equal(t, time.Second*2, s.Load.RequestTimeout)
+	require.Equal(t, time.Duration(0), s.Load.ShutdownTimeout)
+	require.Equal(t, "/time", s.Target.Path)
+	require.Equal(t, "HEAD", s.Target.Method)
+
+	config := &webservice_benchmarks.TestConfig{}
+	err = s.applyTo(config)
+	require.NoError(t, err)
+	require.Equal(t, 5, config.NumWorkers)
+	require.Equal(t, 50.0, config.ArrivalRate)
+	require.Equal(t, "steady time requests", config.Desc)
+
+	// The stored scenario loads back into the same scenario.
+	storedFile := filepath.Join(t.TempDir(), "stored.yaml")
+	err = ioutil.WriteFile(storedFile, []byte(config.Scenario), 0644)
+	require.NoError(t, err)
+	stored, err := loadScenario(storedFile)
+	require.NoError(t, err)
+	require.Equal(t, s, stored)
+}
+
+func TestScenarioFileInvalid(t *testing.T) {
+	scenarioFile := filepath.Join(t.TempDir(), "scenario.json")
+	err := ioutil.WriteFile(scenarioFile, []byte(`{"load": {"workers": 1, "unknown": 2}}`), 0644)
+	require.NoError(t, err)
+
+	_, err = loadScenario(scenarioFile)
+	require.Error(t, err)
+
+	err = (&scenario{Load: loadSettings{Stages: []string{"bad"}}}).applyTo(&webservice_benchmarks.TestConfig{})
+	require.Error(t, err)
+
+	err = (&scenario{Load: loadSettings{AbortIf: []string{"p99>fast"}}}).applyTo(&webservice_benchmarks.TestConfig{})
+	require.Error(t, err)
+}
+
+func TestScenarioAbortRules(t *testing.T) {
+	scenarioFile := filepath.Join(t.TempDir(), "scenario.yaml")
+	err := ioutil.WriteFile(scenarioFile, []byte(`
+load:
+  workers: 20
+  test_duration: 1h
+  abort_if:
+    - error_rate>5%
+    - monitor.num_fds>60000
+  abort_window: 1m
+`), 0644)
+	require.NoError(t, err)
+
+	s := resolveScenarioFromArgs(t, "--scenario", scenarioFile, "--abort-window", "2m")
+	require.Equal(t, []string{"error_rate>5%", "monitor.num_fds>60000"}, s.Load.AbortIf)
+	require.Equal(t, time.Minute*2, s.Load.AbortWindow)
+
+	config := &webservice_benchmarks.TestConfig{}
+	err = s.applyTo(config)
+	require.NoError(t, err)
+	require.Equal(t, []*webservice_benchmarks.AbortRule{
+		{Metric: webservice_benchmarks.AbortErrorRate, Threshold: 0.05},
+		{Metric: "monitor.num_fds", Threshold: 60000},
+	}, config.AbortRules)
+	require.Equal(t, time.Minute*2, config.AbortWindow)
+
+	s = resolveScenarioFromArgs(t, "--abort-if", "p99>2s", "--abort-if", "throughput<10")
+	require.Equal(t, []string{"p99>2s", "throughput<10"}, s.Load.AbortIf)
+	require.Equal(t, time.Second*30, s.Load.AbortWindow)
+}
+
+func TestScenarioController(t *testing.T) {
+	scenarioFile := filepath.Join(t.TempDir(), "scenario.yaml")
+	err := ioutil.WriteFile(scenarioFile, []byte(`
+load:
+  workers: 20
+  test_duration: 1h
+  controller:
+    algorithm: pid
+    target_p99: 200ms
+    max: 500
+`), 0644)
+	require.NoError(t, err)
+
+	s := resolveScenarioFromArgs(t, "--scenario", scenarioFile, "--controller-interval", "10s")
+	require.Equal(t, &controllerSettings{
+		Algorithm: "pid",
+		TargetP99: time.Millisecond * 200,
+		Interval:  time.Second * 10,
+		Max:       500,
+	}, s.Load.Controller)
+
+	config := &webservice_benchmarks.TestConfig{}
+	err = s.applyTo(config)
+	require.NoError(t, err)
+	require.Equal(t, &webservice_benchmarks.Controller{
+		Algorithm: webservice_benchmarks.ControllerPID,
+		TargetP99: time.Millisecond * 200,
+		Interval:  time.Second * 10,
+		Max:       500,
+	}, config.Controller)
+
+	s = resolveScenarioFromArgs(t, "--latency-target", "50ms")
+	err = s.applyTo(config)
+	require.NoError(t, err)
+	require.Equal(t, webservice_benchmarks.ControllerAIMD, config.Controller.Algorithm)
+	require.Equal(t, time.Millisecond*50, config.Controller.TargetP99)
+
+	s = resolveScenarioFromArgs(t)
+	require.Nil(t, s.Load.Controller)
+}
+
+func TestScenarioCheckRepeatable(t *testing.T) {
+	require.NoError(t, (&scenario{Feeders: []*feeder{{Name: "users"}}}).checkRepeatable())
+
+	err := (&scenario{Replay: &replaySettings{Log: "requests.log"}}).checkRepeatable()
+	require.Error(t, err)
+	err = (&scenario{Feeders: []*feeder{{Name: "users", OnExhausted: feederExhaustedStop}}}).checkRepeatable()
+	require.EqualError(t, err, "feeder users stops when it runs out, so a search or sweep can't use it")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func newSearchCommand(config *webservice_benchmarks.TestConfig,
+	prepare func(c *cli.Context, repeated bool) (webservice_benchmarks.SendRequestFunc, error)) cli.Command {
+	searchConfig := &webservice_benchmarks.SearchConfig{
+		SearchID: util.NewID(),
+	}
+	var by string
+
+	return cli.Command{
+		Name:  "search",
+		Usage: "Raise the load one run at a time until the server stops meeting the SLO. Each run lasts --test-duration.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "by",
+				Usage:       "What to raise: workers (--parallel) or rate (--rate, with --parallel requests in flight).",
+				Value:       "workers",
+				Destination: &by,
+			},
+			cli.StringFlag{
+				Name:        "strategy",
+				Usage:       "step (raise the load by --step until a run fails) or bisect (bisect between --start and --max).",
+				Value:       webservice_benchmarks.SearchStep,
+				Destination: &searchConfig.Strategy,
+			},
+			cli.Float64Flag{
+				Name:        "start",
+				Usage:       "The load of the first run.",
+				Value:       10,
+				Destination: &searchConfig.Start,
+			},
+			cli.Float64Flag{
+				Name:        "step",
+				Usage:       "How much the load is raised between runs with the step strategy.",
+				Value:       10,
+				Destination: &searchConfig.Step,
+			},
+			cli.Float64Flag{
+				Name:        "max",
+				Usage:       "The highest load to try.",
+				Value:       1000,
+				Destination: &searchConfig.Max,
+			},
+			cli.Float64Flag{
+				Name:        "resolution",
+				Usage:       "With the bisect strategy, stop when the highest passing and lowest failing load are this close.",
+				Value:       1,
+				Destination: &searchConfig.Resolution,
+			},
+			cli.DurationFlag{
+				Name:        "cooldown",
+				Usage:       "The amount of time to wait between runs.",
+				Destination: &searchConfig.Cooldown,
+			},
+			cli.DurationFlag{
+				Name:        "max-p99",
+				Usage:       "A run fails when its p99 latency is above this.",
+				Destination: &searchConfig.SLO.MaxP99,
+			},
+			cli.Float64Flag{
+				Name:        "max-error-rate",
+				Usage:       "A run fails when the fraction of failed requests is above this (e.g. 0.01).",
+				Destination: &searchConfig.SLO.MaxErrorRate,
+			},
+			cli.Float64Flag{
+				Name:        "min-throughput-gain",
+				Usage:       "A run fails when its throughput grew by less than this fraction of the growth in load compared to the last passing run (e.g. 0.5).",
+				Destination: &searchConfig.SLO.MinThroughputGain,
+			},
+			cli.StringFlag{
+				Name:        "desc",
+				Usage:       "A description of the search.",
+				Destination: &searchConfig.Desc,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			switch by {
+			case "workers":
+				searchConfig.ByRate = false
+			case "rate":
+				searchConfig.ByRate = true
+			default:
+				return errors.Errorf("--by should be workers or rate, got %q", by)
+			}
+			f, err := prepare(c, true)
+			if err != nil {
+				return err
+			}
+			searchConfig.Probe = *config
+
+			log.Println(fmt.Sprintf("DBFilePath: %v", config.DBFilePath))
+			log.Println(fmt.Sprintf("SearchID: %v", searchConfig.SearchID))
+			log.Println(fmt.Sprintf("By: %v", by))
+			log.Println(fmt.Sprintf("Strategy: %v", searchConfig.Strategy))
+			log.Println(fmt.Sprintf("Start: %v, Step: %v, Max: %v", searchConfig.Start, searchConfig.Step, searchConfig.Max))
+			log.Println(fmt.Sprintf("TestDuration: %v", config.TestDuration))
+			log.Println(fmt.Sprintf("SLO: %+v", searchConfig.SLO))
+
+			ctx, stop := util.SignalContext(context.Background())
+			defer stop()
+			result, err := webservice_benchmarks.SearchBreakingPoint(ctx, searchConfig, f)
+			if err != nil {
+				return err
+			}
+
+			for i, probe := range result.Probes {
+				log.Println(fmt.Sprintf("probe %d: load %v, passed %v, run %s - %s", i, probe.Load, probe.Passed, probe.RunID, probe.Reason))
+			}
+			if !result.Found {
+				log.Println(fmt.Sprintf("no load met the SLO, starting at %v", searchConfig.Start))
+				return nil
+			}
+			log.Println(fmt.Sprintf("highest sustainable load: %v", result.MaxSustainableLoad))
+			return nil
+		},
+	}
+}
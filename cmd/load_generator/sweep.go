@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/urfave/cli"
+)
+
+func newSweepCommand(config *webservice_benchmarks.TestConfig,
+	prepare func(c *cli.Context, repeated bool) (webservice_benchmarks.SendRequestFunc, error)) cli.Command {
+	sweepConfig := &webservice_benchmarks.SweepConfig{
+		SweepID: util.NewID(),
+	}
+	var workerCounts string
+
+	return cli.Command{
+		Name:  "sweep",
+		Usage: "Run the test once per worker count, back to back. Each run lasts --test-duration.",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:        "workers",
+				Usage:       "Comma separated worker counts and ranges (e.g. 1,2,5 or 10-100:10).",
+				Required:    true,
+				Destination: &workerCounts,
+			},
+			cli.DurationFlag{
+				Name:        "cooldown",
+				Usage:       "The amount of time to wait between runs.",
+				Destination: &sweepConfig.Cooldown,
+			},
+			cli.StringFlag{
+				Name:        "desc",
+				Usage:       "A description of the sweep.",
+				Destination: &sweepConfig.Desc,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			counts, err := webservice_benchmarks.ParseWorkerCounts(workerCounts)
+			if err != nil {
+				return err
+			}
+			sweepConfig.WorkerCounts = counts
+
+			f, err := prepare(c, true)
+			if err != nil {
+				return err
+			}
+			sweepConfig.Run = *config
+
+			log.Println(fmt.Sprintf("DBFilePath: %v", config.DBFilePath))
+			log.Println(fmt.Sprintf("SweepID: %v", sweepConfig.SweepID))
+			log.Println(fmt.Sprintf("WorkerCounts: %v", sweepConfig.WorkerCounts))
+			log.Println(fmt.Sprintf("Cooldown: %v", sweepConfig.Cooldown))
+			log.Println(fmt.Sprintf("TestDuration: %v", config.TestDuration))
+
+			ctx, stop := util.SignalContext(context.Background())
+			defer stop()
+			runIDs, err := webservice_benchmarks.SweepWorkers(ctx, sweepConfig, f)
+			if err != nil {
+				return err
+			}
+
+			for i, runID := range runIDs {
+				log.Println(fmt.Sprintf("%d workers: run %s", sweepConfig.WorkerCounts[i], runID))
+			}
+			return nil
+		},
+	}
+}
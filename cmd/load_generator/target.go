@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jlym/webservice-benchmarks/grpcwire"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// target is the request the load generator sends; its parts are templates.
+type target struct {
+	Method       string            `yaml:"method"`
+	Path         string            `yaml:"path"`
+	Query        map[string]string `yaml:"query,omitempty"`
+	Headers      map[string]string `yaml:"headers,omitempty"`
+	Body         string            `yaml:"body,omitempty"`
+	ExpectStatus []int             `yaml:"expect_status"`
+	// Assert are checks on the response besides its status.
+	Assert []*assertion `yaml:"assert,omitempty"`
+	// GRPC, when set, makes the request a gRPC call instead of a plain HTTP
+	// request. The query and body aren't used.
+	GRPC *grpcCall `yaml:"grpc,omitempty"`
+}
+
+type templateData struct {
+	WorkerID int
+	// Iteration is the number of requests the worker sent before this one.
+	Iteration int
+	// Vars are the values extracted by the earlier steps of a journey.
+	Vars map[string]string
+	// Feed is the record drawn from each feeder, keyed by feeder name.
+	Feed map[string]map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+	// randInt returns a random number in [min, max].
+	"randInt": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + rand.Intn(max-min+1)
+	},
+}
+
+func loadTarget(filePath string) (*target, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading target file failed")
+	}
+
+	t := &target{}
+	err = yaml.UnmarshalStrict(b, t)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing target file %s failed", filePath)
+	}
+
+	return t, nil
+}
+
+type compiledTarget struct {
+	method       string
+	path         *template.Template
+	query        map[string]*template.Template
+	headers      map[string]*template.Template
+	body         *template.Template
+	expectStatus map[int]bool
+	// assertions start with the check of the status.
+	assertions []*compiledAssertion
+	// grpcFields is the request message of a gRPC call, and grpc whether
+	// the target is one.
+	grpc       bool
+	grpcFields []*compiledGRPCField
+}
+
+func (t *target) compile() (*compiledTarget, error) {
+	method := strings.ToUpper(t.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if t.GRPC != nil {
+		if t.Method != "" && method != http.MethodPost {
+			return nil, errors.Errorf("grpc calls are sent with POST, not %s", method)
+		}
+		if len(t.Query) > 0 || t.Body != "" {
+			return nil, errors.New("grpc calls don't have a query or body, the request message is made of grpc fields")
+		}
+		method = http.MethodPost
+	}
+
+	path, err := parseTemplate("path", t.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	query := make(map[string]*template.Template, len(t.Query))
+	for name, value := range t.Query {
+		query[name], err = parseTemplate("query "+name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	headers := make(map[string]*template.Template, len(t.Headers))
+	for name, value := range t.Headers {
+		headers[name], err = parseTemplate("header "+name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := parseTemplate("body", t.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	expectStatus := make(map[int]bool, len(t.ExpectStatus))
+	for _, status := range t.ExpectStatus {
+		expectStatus[status] = true
+	}
+	if len(expectStatus) == 0 {
+		expectStatus[http.StatusOK] = true
+	}
+
+	statuses := make([]int, 0, len(expectStatus))
+	for status := range expectStatus {
+		statuses = append(statuses, status)
+	}
+	assertions := []*compiledAssertion{{name: "status", check: checkStatus(statuses)}}
+
+	var grpcFields []*compiledGRPCField
+	if t.GRPC != nil {
+		grpcFields, err = t.GRPC.compile()
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, &compiledAssertion{name: "grpc response", check: checkGRPCResponse})
+	}
+
+	for _, a := range t.Assert {
+		compiled, err := a.compile()
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, compiled)
+	}
+
+	return &compiledTarget{
+		method:       method,
+		path:         path,
+		query:        query,
+		headers:      headers,
+		body:         body,
+		expectStatus: expectStatus,
+		assertions:   assertions,
+		grpc:         t.GRPC != nil,
+		grpcFields:   grpcFields,
+	}, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %s template failed", name)
+	}
+	return tmpl, nil
+}
+
+func executeTemplate(tmpl *template.Template, data *templateData) (string, error) {
+	buf := &bytes.Buffer{}
+	err := tmpl.Execute(buf, data)
+	if err != nil {
+		return "", errors.Wrapf(err, "executing %s template failed", tmpl.Name())
+	}
+	return buf.String(), nil
+}
+
+// newRequest builds the request for one iteration of a worker.
+func (t *compiledTarget) newRequest(ctx context.Context, base *url.URL, data *templateData) (*http.Request, error) {
+	path, err := executeTemplate(t.path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid path %q", path)
+	}
+
+	u := *base
+	u.Path = strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(ref.Path, "/")
+
+	query := ref.Query()
+	for name, tmpl := range t.query {
+		value, err := executeTemplate(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		query.Set(name, value)
+	}
+	u.RawQuery = query.Encode()
+
+	body, err := executeTemplate(t.body, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var bodyReader io.Reader
+	if body != "" {
+		bodyReader = strings.NewReader(body)
+	}
+	if t.grpc {
+		grpcBody, err := newGRPCBody(t.grpcFields, data)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(grpcBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, t.method, u.String(), bodyReader)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request failed")
+	}
+
+	for name, tmpl := range t.headers {
+		value, err := executeTemplate(tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(name, value)
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+		}
+	}
+	if t.grpc {
+		req.Header.Set("Content-Type", grpcwire.ContentType)
+		req.Header.Set("TE", "trailers")
+	}
+
+	return req, nil
+}
+
+func (t *compiledTarget) expectedStatuses() string {
+	return formatStatuses(t.expectStatus)
+}
+
+func formatStatuses(expectStatus map[int]bool) string {
+	statuses := make([]int, 0, len(expectStatus))
+	for status := range expectStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+
+	strs := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		strs = append(strs, strconv.Itoa(status))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// parseEndpoint accepts a base URL, or a bare [hostname]:[port] served over http.
+func parseEndpoint(endpoint string) (*url.URL, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid endpoint %q", endpoint)
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("endpoint %q has no host", endpoint)
+	}
+
+	return u, nil
+}
+
+// targetFlags override the target file, which overrides the scenario's target.
+type targetFlags struct {
+	targetFile   string
+	method       string
+	path         string
+	query        cli.StringSlice
+	headers      cli.StringSlice
+	body         string
+	bodyFile     string
+	expectStatus cli.IntSlice
+	asserts      cli.StringSlice
+	grpc         bool
+	grpcFields   cli.StringSlice
+}
+
+func (f *targetFlags) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "target-file",
+			Usage:       "Path to a YAML or JSON file defining the request (method, path, query, headers, body, expect_status).",
+			Destination: &f.targetFile,
+		},
+		cli.StringFlag{
+			Name:        "method",
+			Usage:       "The HTTP method of the request. (default: GET)",
+			Destination: &f.method,
+		},
+		cli.StringFlag{
+			Name:        "path",
+			Usage:       "The path of the request, e.g. /time. Can use {{.WorkerID}}, {{.Iteration}} and {{randInt min max}}. (default: /prime?n=1000)",
+			Destination: &f.path,
+		},
+		cli.StringSliceFlag{
+			Name:  "query",
+			Usage: "A query parameter of the request, formatted as name=value. The value is a template like --path. Can be repeated.",
+			Value: &f.query,
+		},
+		cli.StringSliceFlag{
+			Name:  "header",
+			Usage: "A header of the request, formatted as 'Name: value'. The value is a template like --path. Can be repeated.",
+			Value: &f.headers,
+		},
+		cli.StringFlag{
+			Name:        "body",
+			Usage:       "The body of the request. It is a template like --path.",
+			Destination: &f.body,
+		},
+		cli.StringFlag{
+			Name:        "body-file",
+			Usage:       "Path to a file with the body of the request.",
+			Destination: &f.bodyFile,
+		},
+		cli.IntSliceFlag{
+			Name:  "expect-status",
+			Usage: "A status code that counts as a success. Can be repeated. (default: 200)",
+			Value: &f.expectStatus,
+		},
+		cli.StringSliceFlag{
+			Name:  "assert",
+			Usage: "A check on the response, formatted as kind:argument. kind is status (e.g. status:200,204), header (header present), body (body regex), json (json:path or json:path=value), max-body (bytes) or max-latency (e.g. max-latency:200ms). Can be repeated.",
+			Value: &f.asserts,
+		},
+		cli.BoolFlag{
+			Name:        "grpc",
+			Usage:       "Make a gRPC call of the method --path names, e.g. /benchmarks.Benchmark/Prime. Needs an https endpoint or --h2c.",
+			Destination: &f.grpc,
+		},
+		cli.StringSliceFlag{
+			Name:  "grpc-field",
+			Usage: "A field of the gRPC request message, formatted as number:type=value, e.g. 1:int=1000 or 2:string=name. int fields are sent as varints and string fields as strings or bytes. The value is a template like --path. Implies --grpc. Can be repeated.",
+			Value: &f.grpcFields,
+		},
+	}
+}
+
+// isSet returns whether any of the target flags were given.
+func (f *targetFlags) isSet() bool {
+	return f.targetFile != "" || f.method != "" || f.path != "" ||
+		len(f.query) > 0 || len(f.headers) > 0 ||
+		f.body != "" || f.bodyFile != "" || len(f.expectStatus) > 0 ||
+		len(f.asserts) > 0 || f.grpc || len(f.grpcFields) > 0
+}
+
+func (f *targetFlags) resolve(base *target) (*target, error) {
+	t := &target{}
+	if base != nil {
+		copied := *base
+		t = &copied
+	}
+
+	if f.targetFile != "" {
+		var err error
+		t, err = loadTarget(f.targetFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f.method != "" {
+		t.Method = f.method
+	}
+	if f.path != "" {
+		t.Path = f.path
+	}
+
+	if len(f.query) > 0 {
+		t.Query = make(map[string]string, len(f.query))
+		for _, param := range f.query {
+			parts := strings.SplitN(param, "=", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("query parameter %q should be formatted as name=value", param)
+			}
+			t.Query[parts[0]] = parts[1]
+		}
+	}
+
+	if len(f.headers) > 0 {
+		t.Headers = make(map[string]string, len(f.headers))
+		for _, header := range f.headers {
+			parts := strings.SplitN(header, ":", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("header %q should be formatted as 'Name: value'", header)
+			}
+			t.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if f.body != "" {
+		t.Body = f.body
+	}
+	if f.bodyFile != "" {
+		b, err := ioutil.ReadFile(f.bodyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading body file failed")
+		}
+		t.Body = string(b)
+	}
+
+	if len(f.expectStatus) > 0 {
+		t.ExpectStatus = f.expectStatus
+	}
+
+	if len(f.asserts) > 0 {
+		t.Assert = append([]*assertion{}, t.Assert...)
+		for _, spec := range f.asserts {
+			a, err := parseAssertion(spec)
+			if err != nil {
+				return nil, err
+			}
+			t.Assert = append(t.Assert, a)
+		}
+	}
+
+	if f.grpc || len(f.grpcFields) > 0 {
+		call := &grpcCall{}
+		if t.GRPC != nil {
+			copied := *t.GRPC
+			call = &copied
+		}
+		t.GRPC = call
+		if t.Path == "" {
+			t.Path = "/benchmarks.Benchmark/Prime"
+		}
+	}
+	if len(f.grpcFields) > 0 {
+		t.GRPC.Fields = make([]*grpcField, 0, len(f.grpcFields))
+		for _, spec := range f.grpcFields {
+			field, err := parseGRPCField(spec)
+			if err != nil {
+				return nil, err
+			}
+			t.GRPC.Fields = append(t.GRPC.Fields, field)
+		}
+	}
+
+	// Without a path, the target is the server's prime endpoint, which
+	// responds with a number.
+	if t.Path == "" {
+		t.Path = "/prime"
+		if len(t.Query) == 0 {
+			t.Query = map[string]string{"n": "1000"}
+		}
+		if len(t.Assert) == 0 {
+			t.Assert = []*assertion{{Name: "integer body", BodyRegex: `^\d+$`}}
+		}
+	}
+	if t.Method == "" {
+		t.Method = http.MethodGet
+		if t.GRPC != nil {
+			t.Method = http.MethodPost
+		}
+	}
+	if len(t.ExpectStatus) == 0 {
+		t.ExpectStatus = []int{http.StatusOK}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetNewRequest(t *testing.T) {
+	target := &target{
+		Method: "post",
+		Path:   "/users/{{.WorkerID}}/items?x=1",
+		Query: map[string]string{
+			"n": "{{.Iteration}}",
+		},
+		Headers: map[string]string{
+			"X-Worker": "worker-{{.WorkerID}}",
+		},
+		Body:         `{"iteration": {{.Iteration}}}`,
+		ExpectStatus: []int{201, 200},
+	}
+	compiled, err := target.compile()
+	require.NoError(t, err)
+	require.Equal(t, "200, 201", compiled.expectedStatuses())
+
+	base, err := parseEndpoint("http://localhost:8080/api/")
+	require.NoError(t, err)
+
+	req, err := compiled.newRequest(context.Background(), base, &templateData{WorkerID: 3, Iteration: 7})
+	require.NoError(t, err)
+	require.Equal(t, http.MethodPost, req.Method)
+	require.Equal(t, "http://localhost:8080/api/users/3/items?n=7&x=1", req.URL.String())
+	require.Equal(t, "worker-3", req.Header.Get("X-Worker"))
+
+	body, err := ioutil.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, `{"iteration": 7}`, string(body))
+}
+
+func TestTargetInvalidTemplate(t *testing.T) {
+	_, err := (&target{Path: "/{{.WorkerID"}).compile()
+	require.Error(t, err)
+
+	compiled, err := (&target{Path: "/{{.Missing}}"}).compile()
+	require.NoError(t, err)
+
+	base, err := parseEndpoint("localhost:8080")
+	require.NoError(t, err)
+	_, err = compiled.newRequest(context.Background(), base, &templateData{})
+	require.Error(t, err)
+}
+
+func TestParseEndpoint(t *testing.T) {
+	u, err := parseEndpoint("localhost:8080")
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:8080", u.String())
+
+	u, err = parseEndpoint("https://example.com/api")
+	require.NoError(t, err)
+	require.Equal(t, "https", u.Scheme)
+	require.Equal(t, "/api", u.Path)
+
+	_, err = parseEndpoint("http://")
+	require.Error(t, err)
+}
+
+func TestTargetFlagsResolve(t *testing.T) {
+	target, err := (&targetFlags{}).resolve(nil)
+	require.NoError(t, err)
+	require.Equal(t, "/prime", target.Path)
+	require.Equal(t, map[string]string{"n": "1000"}, target.Query)
+	require.Equal(t, http.MethodGet, target.Method)
+	require.Equal(t, []int{http.StatusOK}, target.ExpectStatus)
+
+	targetFile := filepath.Join(t.TempDir(), "target.yaml")
+	err = ioutil.WriteFile(targetFile, []byte(`
+method: PUT
+path: /time
+headers:
+  Accept: text/plain
+expect_status: [200, 204]
+`), 0644)
+	require.NoError(t, err)
+
+	f := &targetFlags{
+		targetFile: targetFile,
+		method:     "GET",
+		query:      []string{"a=b=c"},
+		headers:    []string{"X-Test: yes"},
+	}
+	target, err = f.resolve(nil)
+	require.NoError(t, err)
+	require.Equal(t, "GET", target.Method)
+	require.Equal(t, "/time", target.Path)
+	require.Equal(t, map[string]string{"a": "b=c"}, target.Query)
+	require.Equal(t, map[string]string{"X-Test": "yes"}, target.Headers)
+	require.Equal(t, []int{200, 204}, target.ExpectStatus)
+
+	_, err = (&targetFlags{headers: []string{"no colon"}}).resolve(nil)
+	require.Error(t, err)
+
+	_, err = (&targetFlags{targetFile: filepath.Join(t.TempDir(), "missing.yaml")}).resolve(nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	webservice_benchmarks "github.com/jlym/webservice-benchmarks"
+)
+
+// requestTrace records when each phase of a request starts and ends, guarded by mu.
+type requestTrace struct {
+	mu sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+	bodyDone                  time.Time
+
+	conn       net.Conn
+	connReused bool
+	// multiplexed is set when the connection is HTTP/2, which carries other
+	// requests alongside this one.
+	multiplexed bool
+	// The connection's byte counts when the request got it.
+	writtenAtGotConn, readAtGotConn int64
+}
+
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	now := func(field *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		*field = time.Now()
+	}
+	first := func(field *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if field.IsZero() {
+			*field = time.Now()
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		// Dialing can try several addresses; the connect phase runs from
+		// the first attempt to the last one that finished.
+		ConnectStart:      func(string, string) { first(&t.connectStart) },
+		ConnectDone:       func(string, string, error) { now(&t.connectDone) },
+		TLSHandshakeStart: func() { now(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.conn = info.Conn
+			t.connReused = info.Reused
+			if tlsConn, ok := info.Conn.(*tls.Conn); ok && tlsConn.ConnectionState().NegotiatedProtocol == "h2" {
+				t.multiplexed = true
+			}
+			if cc, ok := countingConnOf(info.Conn); ok {
+				t.writtenAtGotConn, t.readAtGotConn = cc.counts()
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wroteRequest) },
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+	}
+}
+
+// done marks the end of the response body.
+func (t *requestTrace) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bodyDone = time.Now()
+}
+
+// fill copies what the trace saw into result.
+func (t *requestTrace) fill(result *webservice_benchmarks.RequestResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result.DNS = between(t.dnsStart, t.dnsDone)
+	result.Connect = between(t.connectStart, t.connectDone)
+	result.TLSHandshake = between(t.tlsStart, t.tlsDone)
+	result.TimeToFirstByte = between(t.wroteRequest, t.firstByte)
+	result.BodyRead = between(t.firstByte, t.bodyDone)
+	result.ConnReused = t.connReused
+
+	if t.conn == nil {
+		return
+	}
+
+	if addr, ok := t.conn.LocalAddr().(*net.TCPAddr); ok {
+		result.LocalPort = addr.Port
+	}
+
+	// The counts of an HTTP/2 connection include the other requests
+	// multiplexed over it, so its requests' sizes are left 0.
+	if t.multiplexed {
+		return
+	}
+	if cc, ok := countingConnOf(t.conn); ok {
+		written, read := cc.counts()
+		result.BytesSent = written - t.writtenAtGotConn
+		result.BytesReceived = read - t.readAtGotConn
+	}
+}
+
+// countingConnOf returns the countingConn under conn, which might be a tls.Conn.
+func countingConnOf(conn net.Conn) (*countingConn, bool) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	cc, ok := conn.(*countingConn)
+	return cc, ok
+}
+
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
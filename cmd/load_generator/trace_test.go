@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestTrace(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+		time.Sleep(time.Millisecond * 20)
+		w.Write([]byte("second"))
+	}))
+	defer server.Close()
+
+	// Going through localhost makes the client resolve a name.
+	base, err := parseEndpoint(strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	require.NoError(t, err)
+	operations, err := (&scenario{Target: &target{Path: "/"}}).compileRequests()
+	require.NoError(t, err)
+	c, err := newClient(base, &clientSettings{InsecureSkipVerify: true}, newRequestMix(operations))
+	require.NoError(t, err)
+
+	first, err := c.sendRequest(context.Background(), 0)
+	require.NoError(t, err)
+	require.False(t, first.ConnReused)
+	require.True(t, first.DNS > 0)
+	require.True(t, first.Connect > 0)
+	require.True(t, first.TLSHandshake > 0)
+	require.True(t, first.TimeToFirstByte > 0)
+	require.True(t, first.BodyRead >= time.Millisecond*20, "%v", first.BodyRead)
+	require.NotZero(t, first.LocalPort)
+
+	second, err := c.sendRequest(context.Background(), 0)
+	require.NoError(t, err)
+	require.True(t, second.ConnReused)
+	require.Equal(t, time.Duration(0), second.DNS)
+	require.Equal(t, time.Duration(0), second.Connect)
+	require.Equal(t, time.Duration(0), second.TLSHandshake)
+	require.True(t, second.TimeToFirstByte > 0)
+	require.True(t, second.BodyRead >= time.Millisecond*20, "%v", second.BodyRead)
+	require.Equal(t, first.LocalPort, second.LocalPort)
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	stderrors "errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// clientSettings configure the HTTP client; zero values mean net/http's defaults.
+type clientSettings struct {
+	DisableKeepAlives   bool `yaml:"disable_keep_alives,omitempty" json:"disable_keep_alives"`
+	MaxIdleConns        int  `yaml:"max_idle_conns,omitempty" json:"max_idle_conns"`
+	MaxIdleConnsPerHost int  `yaml:"max_idle_conns_per_host,omitempty" json:"max_idle_conns_per_host"`
+	// MaxConnsPerHost of 0 means no limit.
+	MaxConnsPerHost int           `yaml:"max_conns_per_host,omitempty" json:"max_conns_per_host"`
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout,omitempty" json:"idle_conn_timeout_ns"`
+	DialTimeout     time.Duration `yaml:"dial_timeout,omitempty" json:"dial_timeout_ns"`
+	// PerWorker gives each worker its own client, and so its own connection
+	// pool, instead of sharing one between all workers.
+	PerWorker bool `yaml:"per_worker,omitempty" json:"per_worker"`
+	// RequestsPerConn closes a worker's connection after every
+	// RequestsPerConn requests it sends. 0 means connections are only
+	// closed by the pool.
+	RequestsPerConn int `yaml:"requests_per_conn,omitempty" json:"requests_per_conn"`
+
+	// SourceIPs are the local addresses outgoing connections are bound to,
+	// round-robin. Each has its own ephemeral ports, so several of them
+	// allow more connections than the port range of one.
+	SourceIPs []string `yaml:"source_ips,omitempty" json:"source_ips"`
+	// SourcePorts is a range of local ports, formatted as min-max, that
+	// outgoing connections are bound to round-robin instead of letting the
+	// kernel pick.
+	SourcePorts string `yaml:"source_ports,omitempty" json:"source_ports"`
+
+	// UnixSocket is the path of a unix domain socket every connection is
+	// made to instead of the endpoint's host. The endpoint is still used
+	// for the request URLs and the Host header.
+	UnixSocket string `yaml:"unix_socket,omitempty" json:"unix_socket"`
+
+	// DisableHTTP2 keeps https connections on HTTP/1.1 instead of
+	// negotiating HTTP/2 with servers that offer it.
+	DisableHTTP2 bool `yaml:"disable_http2,omitempty" json:"disable_http2"`
+	// H2C sends requests to http endpoints over cleartext HTTP/2, without
+	// upgrading from HTTP/1.1 first, instead of over HTTP/1.1.
+	H2C bool `yaml:"h2c,omitempty" json:"h2c"`
+	// InsecureSkipVerify accepts any certificate the server presents, like
+	// the self-signed one of cmd/httpserver.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify"`
+}
+
+// Transports recorded with a run.
+const (
+	transportTCP  = "tcp"
+	transportUnix = "unix"
+)
+
+const (
+	defaultDialTimeout = 30 * time.Second
+	dialKeepAlive      = 30 * time.Second
+)
+
+func (s *clientSettings) flags() []cli.Flag {
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:        "disable-keep-alives",
+			Usage:       "Use a new connection for every request.",
+			Destination: &s.DisableKeepAlives,
+		},
+		cli.IntFlag{
+			Name:        "max-idle-conns",
+			Usage:       "The most idle connections kept open across all hosts.",
+			Value:       http.DefaultTransport.(*http.Transport).MaxIdleConns,
+			Destination: &s.MaxIdleConns,
+		},
+		cli.IntFlag{
+			Name:        "max-idle-conns-per-host",
+			Usage:       "The most idle connections kept open to each host.",
+			Value:       http.DefaultMaxIdleConnsPerHost,
+			Destination: &s.MaxIdleConnsPerHost,
+		},
+		cli.IntFlag{
+			Name:        "max-conns-per-host",
+			Usage:       "The most connections, in use or idle, to each host. Requests wait for a connection beyond it. 0 means no limit.",
+			Destination: &s.MaxConnsPerHost,
+		},
+		cli.DurationFlag{
+			Name:        "idle-conn-timeout",
+			Usage:       "How long an idle connection is kept open.",
+			Value:       http.DefaultTransport.(*http.Transport).IdleConnTimeout,
+			Destination: &s.IdleConnTimeout,
+		},
+		cli.DurationFlag{
+			Name:        "dial-timeout",
+			Usage:       "How long connecting to the server can take.",
+			Value:       defaultDialTimeout,
+			Destination: &s.DialTimeout,
+		},
+		cli.BoolFlag{
+			Name:        "client-per-worker",
+			Usage:       "Give each worker its own HTTP client and connection pool instead of sharing one.",
+			Destination: &s.PerWorker,
+		},
+		cli.IntFlag{
+			Name:        "requests-per-conn",
+			Usage:       "Close a worker's connection after every N requests it sends. 0 means never.",
+			Destination: &s.RequestsPerConn,
+		},
+		cli.StringSliceFlag{
+			Name:  "source-ip",
+			Usage: "A local IP address to bind outgoing connections to, e.g. 127.0.0.2. Connections are spread round-robin over the addresses. Can be repeated.",
+			Value: (*cli.StringSlice)(&s.SourceIPs),
+		},
+		cli.StringFlag{
+			Name:        "source-ports",
+			Usage:       "A range of local ports to bind outgoing connections to round-robin, formatted as min-max.",
+			Destination: &s.SourcePorts,
+		},
+		cli.StringFlag{
+			Name:        "unix-socket",
+			Usage:       "The path of a unix domain socket to connect to instead of the endpoint's host.",
+			Destination: &s.UnixSocket,
+		},
+		cli.BoolFlag{
+			Name:        "disable-http2",
+			Usage:       "Use HTTP/1.1 for https endpoints instead of negotiating HTTP/2.",
+			Destination: &s.DisableHTTP2,
+		},
+		cli.BoolFlag{
+			Name:        "h2c",
+			Usage:       "Use cleartext HTTP/2 for http endpoints instead of HTTP/1.1.",
+			Destination: &s.H2C,
+		},
+		cli.BoolFlag{
+			Name:        "insecure-skip-verify",
+			Usage:       "Accept any certificate the server presents, e.g. a self-signed one.",
+			Destination: &s.InsecureSkipVerify,
+		},
+	}
+}
+
+// transport is the transport connections are made over.
+func (s *clientSettings) transport() string {
+	if s.UnixSocket != "" {
+		return transportUnix
+	}
+	return transportTCP
+}
+
+// withDefaults returns the settings with zero values replaced by net/http's defaults.
+func (s clientSettings) withDefaults() clientSettings {
+	defaults := http.DefaultTransport.(*http.Transport)
+	if s.MaxIdleConns == 0 {
+		s.MaxIdleConns = defaults.MaxIdleConns
+	}
+	if s.MaxIdleConnsPerHost == 0 {
+		s.MaxIdleConnsPerHost = http.DefaultMaxIdleConnsPerHost
+	}
+	if s.IdleConnTimeout == 0 {
+		s.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+	if s.DialTimeout == 0 {
+		s.DialTimeout = defaultDialTimeout
+	}
+	return s
+}
+
+// newHTTPClient returns a client whose connections are bound to sources, if it isn't nil.
+func (s *clientSettings) newHTTPClient(sources *sourceAddrs) *http.Client {
+	settings := s.withDefaults()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = settings.DisableKeepAlives
+	transport.MaxIdleConns = settings.MaxIdleConns
+	transport.MaxIdleConnsPerHost = settings.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = settings.MaxConnsPerHost
+	transport.IdleConnTimeout = settings.IdleConnTimeout
+	transport.Protocols = settings.protocols()
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+	transport.DialContext = settings.dialContext(sources)
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// dialContext returns a dial function that binds connections to sources and counts their bytes.
+func (s *clientSettings) dialContext(sources *sourceAddrs) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	settings := s.withDefaults()
+
+	dialer := &net.Dialer{
+		Timeout:   settings.DialTimeout,
+		KeepAlive: dialKeepAlive,
+	}
+	dial := dialer.DialContext
+	if sources != nil {
+		dial = sources.dialer(dialer)
+	}
+	if settings.UnixSocket != "" {
+		dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", settings.UnixSocket)
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &countingConn{Conn: conn}, nil
+	}
+}
+
+// protocols returns the protocols the transport may use; H2C leaves HTTP/1.1 out.
+func (s *clientSettings) protocols() *http.Protocols {
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(!s.H2C)
+	protocols.SetHTTP2(!s.DisableHTTP2)
+	protocols.SetUnencryptedHTTP2(s.H2C)
+	return protocols
+}
+
+// maxBindAttempts is how many local addresses a dial tries when they are in use.
+const maxBindAttempts = 16
+
+// sourceAddrs hands out local addresses round-robin over the source IPs and ports.
+type sourceAddrs struct {
+	ips      []net.IP
+	minPort  int
+	numPorts int
+	next     uint64
+}
+
+// newSourceAddrs returns the source addresses of the settings, or nil if there are none.
+func (s *clientSettings) newSourceAddrs() (*sourceAddrs, error) {
+	if len(s.SourceIPs) == 0 && s.SourcePorts == "" {
+		return nil, nil
+	}
+	if s.UnixSocket != "" {
+		return nil, errors.New("source addresses can't be used with a unix socket")
+	}
+
+	addrs := &sourceAddrs{}
+	for _, ipStr := range s.SourceIPs {
+		ip := net.ParseIP(strings.TrimSpace(ipStr))
+		if ip == nil {
+			return nil, errors.Errorf("invalid source ip %q", ipStr)
+		}
+		addrs.ips = append(addrs.ips, ip)
+	}
+	if len(addrs.ips) == 0 {
+		addrs.ips = []net.IP{nil}
+	}
+
+	if s.SourcePorts != "" {
+		parts := strings.SplitN(s.SourcePorts, "-", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("source ports %q should be formatted as min-max", s.SourcePorts)
+		}
+		minPort, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid source ports %q", s.SourcePorts)
+		}
+		maxPort, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid source ports %q", s.SourcePorts)
+		}
+		if minPort < 1 || maxPort > 65535 || minPort > maxPort {
+			return nil, errors.Errorf("source ports %q should be a range within 1-65535", s.SourcePorts)
+		}
+		addrs.minPort = minPort
+		addrs.numPorts = maxPort - minPort + 1
+	}
+
+	return addrs, nil
+}
+
+func (a *sourceAddrs) nextAddr() *net.TCPAddr {
+	i := int(atomic.AddUint64(&a.next, 1) - 1)
+
+	addr := &net.TCPAddr{IP: a.ips[i%len(a.ips)]}
+	if a.numPorts > 0 {
+		addr.Port = a.minPort + (i/len(a.ips))%a.numPorts
+	}
+	return addr
+}
+
+// dialer returns a dial function that binds each connection to the next source address.
+func (a *sourceAddrs) dialer(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	attempts := 1
+	if a.numPorts > 0 {
+		attempts = maxBindAttempts
+		if a.numPorts*len(a.ips) < attempts {
+			attempts = a.numPorts * len(a.ips)
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var conn net.Conn
+		var err error
+		for i := 0; i < attempts; i++ {
+			bound := *dialer
+			bound.LocalAddr = a.nextAddr()
+			conn, err = bound.DialContext(ctx, network, addr)
+			if err == nil || !stderrors.Is(err, syscall.EADDRINUSE) {
+				break
+			}
+		}
+		return conn, err
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSettingsWithDefaults(t *testing.T) {
+	settings := (clientSettings{MaxIdleConnsPerHost: 50}).withDefaults()
+	require.Equal(t, 100, settings.MaxIdleConns)
+	require.Equal(t, 50, settings.MaxIdleConnsPerHost)
+	require.Equal(t, 0, settings.MaxConnsPerHost)
+	require.Equal(t, time.Second*90, settings.IdleConnTimeout)
+	require.Equal(t, time.Second*30, settings.DialTimeout)
+}
+
+// reusedConns sends n requests as workerID and returns how many of them
+// reused a connection.
+func reusedConns(t *testing.T, c *client, workerID int, n int) int {
+	reused := 0
+	for i := 0; i < n; i++ {
+		result, err := c.sendRequest(context.Background(), workerID)
+		require.NoError(t, err)
+		if result.ConnReused {
+			reused++
+		}
+	}
+	return reused
+}
+
+func newTestTransportClient(t *testing.T, settings *clientSettings) *client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	base, err := parseEndpoint(server.URL)
+	require.NoError(t, err)
+	operations, err := (&scenario{Target: &target{Path: "/"}}).compileRequests()
+	require.NoError(t, err)
+	c, err := newClient(base, settings, newRequestMix(operations))
+	require.NoError(t, err)
+	return c
+}
+
+func TestClientKeepAlives(t *testing.T) {
+	c := newTestTransportClient(t, &clientSettings{})
+	require.Equal(t, 5, reusedConns(t, c, 0, 6))
+
+	c = newTestTransportClient(t, &clientSettings{DisableKeepAlives: true})
+	require.Equal(t, 0, reusedConns(t, c, 0, 6))
+}
+
+func TestClientRequestsPerConn(t *testing.T) {
+	c := newTestTransportClient(t, &clientSettings{RequestsPerConn: 3})
+
+	// Each connection serves 3 requests, so 2 of every 3 reuse one.
+	require.Equal(t, 4, reusedConns(t, c, 0, 6))
+}
+
+func TestClientPerWorker(t *testing.T) {
+	c := newTestTransportClient(t, &clientSettings{})
+	require.Equal(t, c.httpClient(0), c.httpClient(1))
+	require.Equal(t, 2, reusedConns(t, c, 0, 3))
+	require.Equal(t, 3, reusedConns(t, c, 1, 3))
+
+	c = newTestTransportClient(t, &clientSettings{PerWorker: true})
+	require.NotEqual(t, c.httpClient(0), c.httpClient(1))
+	require.Equal(t, c.httpClient(0), c.httpClient(0))
+	require.Equal(t, 2, reusedConns(t, c, 0, 3))
+	require.Equal(t, 2, reusedConns(t, c, 1, 3))
+}
+
+func TestSourceAddrs(t *testing.T) {
+	addrs, err := (&clientSettings{}).newSourceAddrs()
+	require.NoError(t, err)
+	require.Nil(t, addrs)
+
+	addrs, err = (&clientSettings{SourceIPs: []string{"127.0.0.2", "127.0.0.3"}, SourcePorts: "40000-40001"}).newSourceAddrs()
+	require.NoError(t, err)
+	got := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		got = append(got, addrs.nextAddr().String())
+	}
+	require.Equal(t, []string{
+		"127.0.0.2:40000", "127.0.0.3:40000", "127.0.0.2:40001", "127.0.0.3:40001", "127.0.0.2:40000",
+	}, got)
+
+	addrs, err = (&clientSettings{SourcePorts: "40000-40000"}).newSourceAddrs()
+	require.NoError(t, err)
+	require.Equal(t, ":40000", addrs.nextAddr().String())
+
+	for _, settings := range []*clientSettings{
+		{SourceIPs: []string{"localhost"}},
+		{SourcePorts: "40000"},
+		{SourcePorts: "40001-40000"},
+		{SourcePorts: "0-10"},
+		{SourcePorts: "a-b"},
+		{SourceIPs: []string{"127.0.0.2"}, UnixSocket: "/tmp/server.sock"},
+	} {
+		_, err := settings.newSourceAddrs()
+		require.Error(t, err)
+	}
+}
+
+func TestClientSourceIPs(t *testing.T) {
+	var remoteAddrs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		require.NoError(t, err)
+		remoteAddrs = append(remoteAddrs, host)
+	}))
+	defer server.Close()
+
+	base, err := parseEndpoint(server.URL)
+	require.NoError(t, err)
+	operations, err := (&scenario{Target: &target{Path: "/"}}).compileRequests()
+	require.NoError(t, err)
+	c, err := newClient(base, &clientSettings{
+		DisableKeepAlives: true,
+		SourceIPs:         []string{"127.0.0.2", "127.0.0.3"},
+	}, newRequestMix(operations))
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		_, err := c.sendRequest(context.Background(), 0)
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"127.0.0.2", "127.0.0.3", "127.0.0.2", "127.0.0.3"}, remoteAddrs)
+}
+
+func TestClientSourcePortInUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// Hold a port so that binding to it fails.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	base, err := parseEndpoint(server.URL)
+	require.NoError(t, err)
+	operations, err := (&scenario{Target: &target{Path: "/"}}).compileRequests()
+	require.NoError(t, err)
+	c, err := newClient(base, &clientSettings{
+		SourceIPs:   []string{"127.0.0.1"},
+		SourcePorts: fmt.Sprintf("%d-%d", port, port),
+	}, newRequestMix(operations))
+	require.NoError(t, err)
+
+	_, err = c.sendRequest(context.Background(), 0)
+	require.Error(t, err)
+	require.True(t, stderrors.Is(errors.Cause(err), syscall.EADDRINUSE), err.Error())
+}
+
+func TestClientUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "server.sock")
+	l, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	var host string
+	server := &httptest.Server{
+		Listener: l,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host = r.Host
+		})},
+	}
+	server.Start()
+	defer server.Close()
+
+	// The endpoint only names the host; nothing listens on it.
+	base, err := parseEndpoint("http://benchmark.local")
+	require.NoError(t, err)
+	operations, err := (&scenario{Target: &target{Path: "/"}}).compileRequests()
+	require.NoError(t, err)
+	settings := &clientSettings{UnixSocket: socketPath}
+	c, err := newClient(base, settings, newRequestMix(operations))
+	require.NoError(t, err)
+	require.Equal(t, transportUnix, settings.transport())
+
+	result, err := c.sendRequest(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	require.Equal(t, "benchmark.local", host)
+	require.True(t, result.BytesReceived > 0)
+}
+
+func newTestProtocolClient(t *testing.T, server *httptest.Server, settings *clientSettings) *client {
+	base, err := parseEndpoint(server.URL)
+	require.NoError(t, err)
+	operations, err := (&scenario{Target: &target{Path: "/"}}).compileRequests()
+	require.NoError(t, err)
+	c, err := newClient(base, settings, newRequestMix(operations))
+	require.NoError(t, err)
+	return c
+}
+
+func TestClientTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	// The test server's certificate isn't trusted.
+	c := newTestProtocolClient(t, server, &clientSettings{})
+	_, err := c.sendRequest(context.Background(), 0)
+	require.Error(t, err)
+
+	c = newTestProtocolClient(t, server, &clientSettings{InsecureSkipVerify: true})
+	result, err := c.sendRequest(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/2.0", result.Protocol)
+	require.True(t, result.TLSHandshake > 0)
+	// The connection's counts would include the other requests on it.
+	require.Equal(t, int64(0), result.BytesSent)
+	require.Equal(t, int64(0), result.BytesReceived)
+
+	// Later requests are multiplexed over the same connection.
+	result, err = c.sendRequest(context.Background(), 0)
+	require.NoError(t, err)
+	require.True(t, result.ConnReused)
+	require.Equal(t, time.Duration(0), result.TLSHandshake)
+
+	c = newTestProtocolClient(t, server, &clientSettings{InsecureSkipVerify: true, DisableHTTP2: true})
+	result, err = c.sendRequest(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/1.1", result.Protocol)
+	require.True(t, result.BytesSent > 0)
+	require.True(t, result.BytesReceived > 0)
+}
+
+func TestClientH2C(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.Protocols = &http.Protocols{}
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	c := newTestProtocolClient(t, server, &clientSettings{})
+	result, err := c.sendRequest(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/1.1", result.Protocol)
+
+	c = newTestProtocolClient(t, server, &clientSettings{H2C: true})
+	result, err = c.sendRequest(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/2.0", result.Protocol)
+	require.Equal(t, int64(0), result.BytesSent)
+
+	base, err := parseEndpoint(server.URL)
+	require.NoError(t, err)
+	_, err = newClient(base, &clientSettings{H2C: true, DisableHTTP2: true}, newRequestMix(nil))
+	require.Error(t, err)
+}
@@ -44,6 +44,10 @@ func main() {
 			Usage: "The amount of time the monitor waits after the target processes exited.",
 			Value: time.Minute * 2,
 		},
+		cli.BoolTFlag{
+			Name:  "conn-status",
+			Usage: "Record every connection of the processes at each poll. Set to false for tests that hold tens of thousands of connections; the counts per state are recorded either way.",
+		},
 		cli.DurationFlag{
 			Name:  "polling-interval",
 			Usage: "The amount of time monitor waits in between getting information on the processes.",
@@ -70,6 +74,7 @@ type config struct {
 	startupWait         time.Duration
 	shutdownWait        time.Duration
 	pollingInterval     time.Duration
+	connStatus          bool
 }
 
 func getConfig(c *cli.Context) *config {
@@ -86,11 +91,13 @@ func getConfig(c *cli.Context) *config {
 		startupWait:         c.Duration("startup-wait"),
 		shutdownWait:        c.Duration("shutdown-wait"),
 		pollingInterval:     c.Duration("polling-interval"),
+		connStatus:          c.BoolT("conn-status"),
 	}
 }
 
 func run(conf *config) error {
-	ctx := context.Background()
+	ctx, stop := util.SignalContext(context.Background())
+	defer stop()
 
 	log.Println(fmt.Sprintf("runID: %v", conf.runID))
 	log.Println(fmt.Sprintf("dbFilePath: %v", conf.dbFilePath))
@@ -99,13 +106,14 @@ func run(conf *config) error {
 	log.Println(fmt.Sprintf("startupWait: %v", conf.startupWait))
 	log.Println(fmt.Sprintf("shutdownWait: %v", conf.shutdownWait))
 	log.Println(fmt.Sprintf("pollingInterval: %v", conf.pollingInterval))
+	log.Println(fmt.Sprintf("connStatus: %v", conf.connStatus))
 
 	db, err := sqlite.NewDataStore(conf.dbFilePath)
 	if err != nil {
 		return err
 	}
 
-	err = db.CreateTables(ctx)
+	err = db.CreateTables(context.Background())
 	if err != nil {
 		return err
 	}
@@ -116,5 +124,5 @@ func run(conf *config) error {
 		_ = db.Close()
 	}()
 
-	return monitor(conf, db)
+	return monitor(ctx, conf, db)
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strings"
@@ -12,7 +13,8 @@ import (
 	"github.com/shirou/gopsutil/process"
 )
 
-func monitor(conf *config, db *sqlite.DataStore) error {
+// monitor records the target processes until they have exited or ctx is cancelled.
+func monitor(ctx context.Context, conf *config, db *sqlite.DataStore) error {
 	testStarted := false
 	startupThreshold := time.Now().Add(conf.startupWait)
 	log.Println(fmt.Sprintf("monitor will wait till %v for processes to start", startupThreshold))
@@ -20,8 +22,16 @@ func monitor(conf *config, db *sqlite.DataStore) error {
 	var shuttingDown bool
 	var shutdownThreshold time.Time
 
+	ticker := time.NewTicker(conf.pollingInterval)
+	defer ticker.Stop()
+
 	for {
-		time.Sleep(conf.pollingInterval)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Println(fmt.Sprintf("monitor stopping: %v", context.Cause(ctx)))
+			return nil
+		}
 
 		processInfos, err := getProcessInfo(conf)
 		if err != nil {
@@ -86,8 +96,10 @@ func monitorProcess(conf *config, processInfo *processInfo, db *sqlite.DataStore
 	}
 
 	tcpConnParams := &sqlite.AddTCPConnParams{
-		RunID: conf.runID,
-		Time:  now,
+		RunID:       conf.runID,
+		Time:        now,
+		ProcessID:   uint32(pid),
+		ProcessName: processInfo.name,
 	}
 	for _, connStat := range connStats {
 		switch connStat.Status {
@@ -119,6 +131,16 @@ func monitorProcess(conf *config, processInfo *processInfo, db *sqlite.DataStore
 	}
 	db.QueueTCPConn(tcpConnParams)
 
+	fdParams, err := getProcessFDs(conf, processInfo, now)
+	if err != nil {
+		return err
+	}
+	db.QueueProcessFDs(fdParams)
+
+	if !conf.connStatus {
+		return nil
+	}
+
 	for _, connStat := range connStats {
 		db.QueueConnStatus(&sqlite.AddConnStatusParams{
 			Time:        now,
@@ -137,6 +159,40 @@ func monitorProcess(conf *config, processInfo *processInfo, db *sqlite.DataStore
 	return nil
 }
 
+// getProcessFDs returns how many file descriptors the process has open.
+func getProcessFDs(conf *config, processInfo *processInfo, now time.Time) (*sqlite.AddProcessFDsParams, error) {
+	p, err := process.NewProcess(processInfo.id)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching process failed")
+	}
+
+	numFDs, err := p.NumFDs()
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching number of file descriptors failed")
+	}
+
+	params := &sqlite.AddProcessFDsParams{
+		RunID:       conf.runID,
+		Time:        now,
+		ProcessID:   uint32(processInfo.id),
+		ProcessName: processInfo.name,
+		NumFDs:      int(numFDs),
+	}
+
+	// The limit is only informational, so a process whose limits can't be
+	// read is still recorded.
+	limits, err := p.Rlimit()
+	if err == nil {
+		for _, limit := range limits {
+			if limit.Resource == process.RLIMIT_NOFILE {
+				params.SoftLimit = int(limit.Soft)
+			}
+		}
+	}
+
+	return params, nil
+}
+
 type processInfo struct {
 	id   int32
 	name string
@@ -0,0 +1,421 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+// controlStatsWindow is the rolling window the control API's stats are computed on.
+const controlStatsWindow = time.Second * 10
+
+// maxControlWorkers is the most workers the control API can set.
+const maxControlWorkers = 10000
+
+// controlShutdownTimeout is how long closing the control API waits for its requests.
+const controlShutdownTimeout = time.Second * 5
+
+// runControl is what the control API can change about a run while it is going.
+type runControl struct {
+	openLoop bool
+	// scheduled runs follow a fixed schedule, which can't be changed.
+	scheduled bool
+
+	mu sync.Mutex
+	// level is the load the profile asks for, and workers and rate replace
+	// it once they are set through the API.
+	level   loadLevel
+	workers *int
+	rate    *float64
+	paused  bool
+}
+
+// apply returns the load the run should have when the profile asks for level.
+func (c *runControl) apply(level loadLevel) loadLevel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.level = level
+	return c.effectiveLevel()
+}
+
+func (c *runControl) effectiveLevel() loadLevel {
+	level := c.level
+	if c.workers != nil {
+		level.workers = *c.workers
+	}
+	if c.rate != nil {
+		level.rate = *c.rate
+	}
+	// Paused closed-loop workers wait at the pause gate instead, so they
+	// keep what they hold, like open connections.
+	if c.paused && c.openLoop {
+		level.rate = 0
+	}
+	return level
+}
+
+// load returns the run's workers, or rate if it is open-loop, and whether it is paused.
+func (c *runControl) load() (load float64, paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	level := c.effectiveLevel()
+	if c.openLoop {
+		return level.rate, c.paused
+	}
+	return float64(level.workers), c.paused
+}
+
+// setLoad replaces the load the profile asks for with load.
+func (c *runControl) setLoad(load float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.openLoop {
+		c.rate = &load
+		return
+	}
+	workers := int(load)
+	c.workers = &workers
+}
+
+// pauseGate holds workers back while a run is paused.
+type pauseGate struct {
+	mu      sync.Mutex
+	resumed chan struct{}
+}
+
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed == nil {
+		g.resumed = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.resumed != nil {
+		close(g.resumed)
+		g.resumed = nil
+	}
+}
+
+// wait blocks while the gate is paused, returning false if the worker was told to stop.
+func (g *pauseGate) wait(stopReciever *util.StopReciever) (waited bool, ok bool) {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	if resumed == nil {
+		return false, true
+	}
+
+	select {
+	case <-resumed:
+		return true, true
+	case <-stopReciever.ShouldStopC:
+		return true, false
+	}
+}
+
+// controlServer serves the control API of a run.
+type controlServer struct {
+	control *runControl
+	sender  *requestSender
+	window  *rollingWindow
+	db      *sqlite.DataStore
+	run     *sqlite.Run
+	abort   context.CancelCauseFunc
+	server  *http.Server
+}
+
+// controlStats is what every control endpoint returns.
+type controlStats struct {
+	RunID          string  `json:"run_id"`
+	ElapsedSeconds float64 `json:"elapsed_s"`
+	Paused         bool    `json:"paused"`
+	Workers        int64   `json:"workers"`
+	InFlight       int64   `json:"in_flight"`
+	TargetWorkers  int     `json:"target_workers,omitempty"`
+	TargetRate     float64 `json:"target_rate,omitempty"`
+
+	// The rest is over the last WindowSeconds.
+	WindowSeconds   float64        `json:"window_s"`
+	Requests        int            `json:"requests"`
+	Rate            float64        `json:"rate"`
+	ErrorRate       float64        `json:"error_rate"`
+	P50Ms           float64        `json:"p50_ms"`
+	P90Ms           float64        `json:"p90_ms"`
+	P99Ms           float64        `json:"p99_ms"`
+	ErrorCategories map[string]int `json:"error_categories"`
+	QueueDepth      int            `json:"queue_depth"`
+}
+
+type controlError struct {
+	Error string `json:"error"`
+}
+
+// listenControl listens on addr for the control API before the run starts.
+func listenControl(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listening for the control api on %s failed", addr)
+	}
+	return l, nil
+}
+
+func (c *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", allowMethod(http.MethodGet, c.handleStats))
+	mux.HandleFunc("/workers", allowMethod(http.MethodPost, c.handleWorkers))
+	mux.HandleFunc("/rate", allowMethod(http.MethodPost, c.handleRate))
+	mux.HandleFunc("/pause", allowMethod(http.MethodPost, c.handlePause))
+	mux.HandleFunc("/resume", allowMethod(http.MethodPost, c.handleResume))
+	mux.HandleFunc("/annotations", allowMethod(http.MethodPost, c.handleAnnotation))
+	mux.HandleFunc("/stop", allowMethod(http.MethodPost, c.handleStop))
+	return mux
+}
+
+func allowMethod(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeControlError(w, http.StatusMethodNotAllowed, r.URL.Path+" only allows "+method)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (c *controlServer) serve(l net.Listener) {
+	c.server = &http.Server{Handler: c.handler()}
+	log.Println(fmt.Sprintf("control api listening on %s", l.Addr()))
+	go func() {
+		err := c.server.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			log.Println(errors.Wrap(err, "serving the control api failed"))
+		}
+	}()
+}
+
+// close waits for the control API's requests so their events are queued before the DataStore stops.
+func (c *controlServer) close() {
+	if c.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controlShutdownTimeout)
+	defer cancel()
+	err := c.server.Shutdown(ctx)
+	if err != nil {
+		log.Println(errors.Wrap(err, "closing the control api failed"))
+		c.server.Close()
+	}
+}
+
+func (c *controlServer) stats() *controlStats {
+	now := time.Now().UTC()
+	window := c.window.stats(now)
+
+	c.control.mu.Lock()
+	level := c.control.effectiveLevel()
+	paused := c.control.paused
+	c.control.mu.Unlock()
+
+	stats := &controlStats{
+		RunID:           c.run.ID,
+		ElapsedSeconds:  now.Sub(c.run.StartTime).Seconds(),
+		Paused:          paused,
+		Workers:         atomic.LoadInt64(&c.sender.workers),
+		InFlight:        atomic.LoadInt64(&c.sender.inFlight),
+		WindowSeconds:   c.window.window.Seconds(),
+		Requests:        window.Requests,
+		Rate:            window.Rate,
+		ErrorRate:       window.ErrorRate,
+		P50Ms:           durationMs(window.P50),
+		P90Ms:           durationMs(window.P90),
+		P99Ms:           durationMs(window.P99),
+		ErrorCategories: window.ErrorCategories,
+		QueueDepth:      c.db.QueueDepth(),
+	}
+	if c.control.openLoop {
+		stats.TargetRate = level.rate
+	} else if !c.control.scheduled {
+		stats.TargetWorkers = level.workers
+	}
+	return stats
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (c *controlServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeControlJSON(w, http.StatusOK, c.stats())
+}
+
+func (c *controlServer) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Workers *int `json:"workers"`
+	}
+	if !readControlJSON(w, r, &body) {
+		return
+	}
+	if body.Workers == nil || *body.Workers < 0 {
+		writeControlError(w, http.StatusBadRequest, "expected a body like {\"workers\": 50}")
+		return
+	}
+	if *body.Workers > maxControlWorkers {
+		writeControlError(w, http.StatusBadRequest, fmt.Sprintf("workers should be at most %d", maxControlWorkers))
+		return
+	}
+	if c.control.openLoop || c.control.scheduled {
+		writeControlError(w, http.StatusConflict, "the run sends at a rate or on a schedule, so its number of workers can't be changed")
+		return
+	}
+
+	c.control.mu.Lock()
+	before := c.control.effectiveLevel().workers
+	c.control.workers = body.Workers
+	c.control.mu.Unlock()
+
+	c.event(r, sqlite.RunEventWorkers, float64(*body.Workers), fmt.Sprintf("workers %d -> %d", before, *body.Workers))
+	writeControlJSON(w, http.StatusOK, c.stats())
+}
+
+func (c *controlServer) handleRate(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Rate *float64 `json:"rate"`
+	}
+	if !readControlJSON(w, r, &body) {
+		return
+	}
+	if body.Rate == nil || *body.Rate < 0 {
+		writeControlError(w, http.StatusBadRequest, "expected a body like {\"rate\": 200}")
+		return
+	}
+	if !c.control.openLoop {
+		writeControlError(w, http.StatusConflict, "the run doesn't send at a rate, so its rate can't be changed")
+		return
+	}
+
+	c.control.mu.Lock()
+	before := c.control.effectiveLevel().rate
+	c.control.rate = body.Rate
+	c.control.mu.Unlock()
+
+	c.event(r, sqlite.RunEventRate, *body.Rate, fmt.Sprintf("rate %v/s -> %v/s", before, *body.Rate))
+	writeControlJSON(w, http.StatusOK, c.stats())
+}
+
+func (c *controlServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	c.setPaused(w, r, true)
+}
+
+func (c *controlServer) handleResume(w http.ResponseWriter, r *http.Request) {
+	c.setPaused(w, r, false)
+}
+
+func (c *controlServer) setPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if c.control.scheduled {
+		writeControlError(w, http.StatusConflict, "the run follows a fixed schedule, so it can't be paused")
+		return
+	}
+
+	c.control.mu.Lock()
+	changed := c.control.paused != paused
+	c.control.paused = paused
+	c.control.mu.Unlock()
+
+	if changed && paused {
+		c.sender.pause.pause()
+		c.event(r, sqlite.RunEventPause, 0, "paused")
+	} else if changed {
+		c.sender.pause.resume()
+		c.event(r, sqlite.RunEventResume, 0, "resumed")
+	}
+	writeControlJSON(w, http.StatusOK, c.stats())
+}
+
+func (c *controlServer) handleAnnotation(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Message string `json:"message"`
+	}
+	if !readControlJSON(w, r, &body) {
+		return
+	}
+	if body.Message == "" {
+		writeControlError(w, http.StatusBadRequest, "expected a body like {\"message\": \"deployed the fix\"}")
+		return
+	}
+
+	c.event(r, sqlite.RunEventAnnotation, 0, body.Message)
+	writeControlJSON(w, http.StatusOK, c.stats())
+}
+
+func (c *controlServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 && !readControlJSON(w, r, &body) {
+		return
+	}
+
+	reason := "stopped through the control api"
+	if body.Reason != "" {
+		reason += ": " + body.Reason
+	}
+
+	c.event(r, sqlite.RunEventStop, 0, reason)
+	stats := c.stats()
+	c.abort(errors.New(reason))
+	writeControlJSON(w, http.StatusOK, stats)
+}
+
+// event records a control action in the run's timeline.
+func (c *controlServer) event(r *http.Request, event string, value float64, message string) {
+	log.Println(fmt.Sprintf("control api: %s (from %s)", message, r.RemoteAddr))
+	c.db.QueueRunEvent(c.run, &sqlite.AddRunEventParams{
+		Time:    time.Now().UTC(),
+		Event:   event,
+		Value:   value,
+		Message: message,
+		Source:  r.RemoteAddr,
+	})
+}
+
+func readControlJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		writeControlError(w, http.StatusBadRequest, "invalid json body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeControlError(w http.ResponseWriter, statusCode int, message string) {
+	writeControlJSON(w, statusCode, &controlError{Error: message})
+}
+
+func writeControlJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println(errors.Wrap(err, "writing control api response failed"))
+	}
+}
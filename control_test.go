@@ -0,0 +1,167 @@
+package webservice_benchmarks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunControlApply(t *testing.T) {
+	closedLoop := &runControl{}
+	require.Equal(t, loadLevel{workers: 2}, closedLoop.apply(loadLevel{workers: 2}))
+
+	workers := 5
+	closedLoop.workers = &workers
+	require.Equal(t, loadLevel{workers: 5}, closedLoop.apply(loadLevel{workers: 10}))
+
+	openLoop := &runControl{openLoop: true}
+	require.Equal(t, loadLevel{rate: 100}, openLoop.apply(loadLevel{rate: 100}))
+
+	openLoop.paused = true
+	require.Equal(t, loadLevel{rate: 0}, openLoop.apply(loadLevel{rate: 100}))
+
+	rate := 50.0
+	openLoop.rate = &rate
+	openLoop.paused = false
+	require.Equal(t, loadLevel{rate: 50}, openLoop.apply(loadLevel{rate: 100}))
+}
+
+func TestPauseGate(t *testing.T) {
+	stopSender := util.NewStopSender()
+	stopReciever := stopSender.NewReciever()
+
+	var g pauseGate
+	waited, ok := g.wait(stopReciever)
+	require.False(t, waited)
+	require.True(t, ok)
+
+	g.pause()
+	time.AfterFunc(time.Millisecond*50, g.resume)
+	start := time.Now()
+	waited, ok = g.wait(stopReciever)
+	require.True(t, waited)
+	require.True(t, ok)
+	require.True(t, time.Since(start) >= time.Millisecond*50)
+
+	g.pause()
+	time.AfterFunc(time.Millisecond*50, stopSender.Stop)
+	waited, ok = g.wait(stopReciever)
+	require.True(t, waited)
+	require.False(t, ok)
+
+	stopReciever.Done()
+	stopSender.Wait()
+}
+
+func postControl(t *testing.T, url string, body interface{}) (int, *controlStats) {
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	stats := &controlStats{}
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(stats))
+	}
+	return resp.StatusCode, stats
+}
+
+func getControlStats(url string) (*controlStats, error) {
+	resp, err := http.Get(url + "/stats")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	stats := &controlStats{}
+	err = json.NewDecoder(resp.Body).Decode(stats)
+	return stats, err
+}
+
+func TestGenerateLoadControl(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	url := "http://" + addr
+
+	config := &TestConfig{
+		DBFilePath:   filepath.Join(t.TempDir(), "test.db"),
+		RunID:        util.NewID(),
+		NumWorkers:   2,
+		TestDuration: time.Second * 30,
+		ControlAddr:  addr,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- GenerateLoad(context.Background(), config, func(ctx context.Context, _ int) (*RequestResult, error) {
+			time.Sleep(time.Millisecond)
+			return nil, nil
+		})
+	}()
+
+	var stats *controlStats
+	require.Eventually(t, func() bool {
+		stats, err = getControlStats(url)
+		return err == nil
+	}, time.Second*5, time.Millisecond*10)
+	require.Equal(t, config.RunID, stats.RunID)
+	require.Equal(t, 2, stats.TargetWorkers)
+
+	code, stats := postControl(t, url+"/workers", map[string]int{"workers": 3})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 3, stats.TargetWorkers)
+	require.Eventually(t, func() bool {
+		stats, err := getControlStats(url)
+		return err == nil && stats.Workers == 3
+	}, time.Second*5, time.Millisecond*10)
+
+	code, _ = postControl(t, url+"/workers", map[string]int{"workers": 5000000})
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = postControl(t, url+"/rate", map[string]float64{"rate": 10})
+	require.Equal(t, http.StatusConflict, code)
+
+	code, stats = postControl(t, url+"/pause", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, stats.Paused)
+	require.Eventually(t, func() bool {
+		stats, err := getControlStats(url)
+		return err == nil && stats.InFlight == 0
+	}, time.Second*5, time.Millisecond*10)
+
+	code, stats = postControl(t, url+"/resume", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.False(t, stats.Paused)
+
+	code, _ = postControl(t, url+"/annotations", map[string]string{"message": "deployed the fix"})
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = postControl(t, url+"/stop", map[string]string{"reason": "done"})
+	require.Equal(t, http.StatusOK, code)
+
+	select {
+	case err = <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("the run didn't stop")
+	}
+	abortErr, ok := errors.Cause(err).(*AbortError)
+	require.True(t, ok, "%v", err)
+	require.Equal(t, "stopped through the control api: done", abortErr.Reason)
+
+	status := getTestRunStatus(t, config)
+	require.Equal(t, sqlite.RunStatusAborted, status.Status)
+	require.Equal(t, "stopped through the control api: done", status.AbortReason)
+}
@@ -0,0 +1,253 @@
+package webservice_benchmarks
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+// Algorithms the adaptive controller can adjust the load with.
+const (
+	ControllerAIMD = "aimd"
+	ControllerPID  = "pid"
+)
+
+const defaultControllerInterval = time.Second * 5
+
+const (
+	aimdDecrease = 0.75
+	// aimdRateStep is the fraction of the highest rate AIMD adds; closed-loop runs get a worker.
+	aimdRateStep = 0.05
+
+	pidKp        = 0.5
+	pidKi        = 0.1
+	pidKd        = 0.1
+	pidMaxChange = 0.5
+	// pidMaxIntegral bounds the accumulated error.
+	pidMaxIntegral = 5
+)
+
+// Controller adjusts the workers or rate of a run to hold its p99 at TargetP99.
+type Controller struct {
+	Algorithm    string
+	TargetP99    time.Duration
+	MaxErrorRate float64
+	Interval     time.Duration
+	// Min and Max bound the load; a Max of 0 doesn't bound it.
+	Min float64
+	Max float64
+}
+
+func (c *Controller) validate() error {
+	if c.Algorithm != ControllerAIMD && c.Algorithm != ControllerPID {
+		return errors.Errorf("unknown controller algorithm %q, expected %s or %s", c.Algorithm, ControllerAIMD, ControllerPID)
+	}
+	if c.TargetP99 <= 0 {
+		return errors.New("the controller needs a p99 latency target")
+	}
+	if c.Max > 0 && c.Max < c.min() {
+		return errors.Errorf("the controller's max load %v is below its min load %v", c.Max, c.min())
+	}
+	return nil
+}
+
+func (c *Controller) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultControllerInterval
+	}
+	return c.Interval
+}
+
+func (c *Controller) min() float64 {
+	return math.Max(c.Min, 1)
+}
+
+type adaptiveController struct {
+	config  *Controller
+	control *runControl
+	window  *rollingWindow
+	db      *sqlite.DataStore
+	run     *sqlite.Run
+
+	step      float64
+	integral  float64
+	lastError float64
+	adjusted  bool
+
+	// best is the decision with the most throughput within the target.
+	best *sqlite.AddControllerDecisionParams
+}
+
+func newAdaptiveController(
+	config *Controller,
+	control *runControl,
+	maxLevel loadLevel,
+	db *sqlite.DataStore,
+	run *sqlite.Run) *adaptiveController {
+
+	c := &adaptiveController{
+		config:  config,
+		control: control,
+		window:  newRollingWindow(config.interval()),
+		db:      db,
+		run:     run,
+		step:    1,
+	}
+	if control.openLoop {
+		c.step = math.Max(maxLevel.rate*aimdRateStep, 1)
+	}
+	return c
+}
+
+// adjust adjusts the load every interval, starting from the current load.
+func (c *adaptiveController) adjust(stopReciever *util.StopReciever) {
+	defer stopReciever.Done()
+
+	ticker := time.NewTicker(c.config.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopReciever.ShouldStopC:
+			return
+		}
+
+		now := time.Now().UTC()
+		stats := c.window.stats(now)
+		load, paused := c.control.load()
+		if paused {
+			continue
+		}
+
+		decision := c.decide(now, stats, load)
+		if decision.LoadAfter != decision.LoadBefore {
+			c.control.setLoad(decision.LoadAfter)
+		}
+		log.Println(fmt.Sprintf("controller: %s load %v -> %v, %s",
+			decision.Action, decision.LoadBefore, decision.LoadAfter, decision.Reason))
+		c.db.QueueControllerDecision(c.run, decision)
+
+		if c.withinTarget(stats) && (c.best == nil || decision.Throughput > c.best.Throughput) {
+			c.best = decision
+		}
+	}
+}
+
+func (c *adaptiveController) withinTarget(stats *windowStats) bool {
+	return stats.Requests > 0 && stats.P99 <= c.config.TargetP99 && !c.tooManyErrors(stats)
+}
+
+func (c *adaptiveController) tooManyErrors(stats *windowStats) bool {
+	return c.config.MaxErrorRate > 0 && stats.ErrorRate > c.config.MaxErrorRate
+}
+
+// decide returns the load that should follow load given the last interval.
+func (c *adaptiveController) decide(now time.Time, stats *windowStats, load float64) *sqlite.AddControllerDecisionParams {
+	decision := &sqlite.AddControllerDecisionParams{
+		Time:       now,
+		Algorithm:  c.config.Algorithm,
+		Requests:   stats.Requests,
+		ErrorRate:  stats.ErrorRate,
+		P99:        stats.P99,
+		Throughput: stats.Throughput,
+		LoadBefore: load,
+		LoadAfter:  load,
+		Action:     sqlite.ControllerHold,
+	}
+	if stats.Requests == 0 {
+		decision.Reason = "no requests ended in the interval"
+		return decision
+	}
+
+	target := c.config.TargetP99
+	switch {
+	case c.tooManyErrors(stats):
+		decision.Reason = fmt.Sprintf("error rate %.2f%% is above %.2f%%", stats.ErrorRate*100, c.config.MaxErrorRate*100)
+	case stats.P99 > target:
+		decision.Reason = fmt.Sprintf("p99 %v is above the %v target", stats.P99.Round(time.Millisecond), target)
+	default:
+		decision.Reason = fmt.Sprintf("p99 %v is within the %v target", stats.P99.Round(time.Millisecond), target)
+	}
+
+	var next float64
+	if c.config.Algorithm == ControllerPID {
+		next = c.pid(stats, load)
+	} else if c.withinTarget(stats) {
+		next = c.bound(c.round(load, load+c.step))
+	} else {
+		next = c.bound(c.round(load, load*aimdDecrease))
+	}
+
+	decision.LoadAfter = next
+	if next > load {
+		decision.Action = sqlite.ControllerIncrease
+	} else if next < load {
+		decision.Action = sqlite.ControllerDecrease
+	}
+	return decision
+}
+
+func (c *adaptiveController) pid(stats *windowStats, load float64) float64 {
+	target := c.config.TargetP99
+	e := float64(target-stats.P99) / float64(target)
+	if c.tooManyErrors(stats) {
+		e = -1
+	}
+	e = clamp(e, -1, 1)
+
+	dt := c.config.interval().Seconds()
+	integral := clamp(c.integral+e*dt, -pidMaxIntegral, pidMaxIntegral)
+	derivative := 0.0
+	if c.adjusted {
+		derivative = (e - c.lastError) / dt
+	}
+	c.lastError = e
+	c.adjusted = true
+
+	change := clamp(pidKp*e+pidKi*integral+pidKd*derivative, -pidMaxChange, pidMaxChange)
+	next := c.round(load, load*(1+change))
+	bounded := c.bound(next)
+	// The error stops accumulating while the load is held at a bound.
+	if bounded == next {
+		c.integral = integral
+	}
+	return bounded
+}
+
+// round rounds next away from load to whole workers, or rates to hundredths.
+func (c *adaptiveController) round(load, next float64) float64 {
+	if c.control.openLoop {
+		return math.Round(next*100) / 100
+	}
+	if next > load {
+		return math.Ceil(next)
+	}
+	return math.Floor(next)
+}
+
+func (c *adaptiveController) bound(load float64) float64 {
+	load = math.Max(load, c.config.min())
+	if c.config.Max > 0 {
+		load = math.Min(load, c.config.Max)
+	}
+	return load
+}
+
+func (c *adaptiveController) logResult() {
+	if c.best == nil {
+		log.Println(fmt.Sprintf("controller: the p99 was never within the %v target", c.config.TargetP99))
+		return
+	}
+	log.Println(fmt.Sprintf("controller: the most throughput within the %v p99 target was %.1f req/s, at a load of %v with a p99 of %v",
+		c.config.TargetP99, c.best.Throughput, c.best.LoadBefore, c.best.P99.Round(time.Millisecond)))
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(v, max))
+}
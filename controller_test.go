@@ -0,0 +1,144 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControllerValidate(t *testing.T) {
+	require.NoError(t, (&Controller{Algorithm: ControllerAIMD, TargetP99: time.Millisecond * 200}).validate())
+	require.NoError(t, (&Controller{Algorithm: ControllerPID, TargetP99: time.Second, Min: 5, Max: 50}).validate())
+
+	require.EqualError(t, (&Controller{Algorithm: "bbr", TargetP99: time.Second}).validate(),
+		`unknown controller algorithm "bbr", expected aimd or pid`)
+	require.EqualError(t, (&Controller{Algorithm: ControllerAIMD}).validate(),
+		"the controller needs a p99 latency target")
+	require.EqualError(t, (&Controller{Algorithm: ControllerAIMD, TargetP99: time.Second, Min: 10, Max: 5}).validate(),
+		"the controller's max load 5 is below its min load 10")
+}
+
+func controllerStats(requests int, errorRate float64, p99 time.Duration) *windowStats {
+	return &windowStats{
+		Requests:   requests,
+		ErrorRate:  errorRate,
+		P99:        p99,
+		Throughput: float64(requests) * (1 - errorRate) / 5,
+	}
+}
+
+func TestAdaptiveControllerAIMD(t *testing.T) {
+	config := &Controller{
+		Algorithm:    ControllerAIMD,
+		TargetP99:    time.Millisecond * 100,
+		MaxErrorRate: 0.01,
+		Max:          12,
+	}
+	c := newAdaptiveController(config, &runControl{}, loadLevel{workers: 10}, nil, nil)
+	now := time.Now().UTC()
+
+	d := c.decide(now, controllerStats(500, 0, time.Millisecond*80), 10)
+	require.Equal(t, sqlite.ControllerIncrease, d.Action)
+	require.Equal(t, 11.0, d.LoadAfter)
+	require.Equal(t, "p99 80ms is within the 100ms target", d.Reason)
+	require.Equal(t, ControllerAIMD, d.Algorithm)
+	require.Equal(t, now, d.Time)
+
+	d = c.decide(now, controllerStats(500, 0, time.Millisecond*80), 12)
+	require.Equal(t, sqlite.ControllerHold, d.Action)
+	require.Equal(t, 12.0, d.LoadAfter)
+
+	d = c.decide(now, controllerStats(500, 0, time.Millisecond*150), 10)
+	require.Equal(t, sqlite.ControllerDecrease, d.Action)
+	require.Equal(t, 7.0, d.LoadAfter)
+	require.Equal(t, "p99 150ms is above the 100ms target", d.Reason)
+
+	d = c.decide(now, controllerStats(500, 0.05, time.Millisecond*20), 10)
+	require.Equal(t, sqlite.ControllerDecrease, d.Action)
+	require.Equal(t, 7.0, d.LoadAfter)
+	require.Equal(t, "error rate 5.00% is above 1.00%", d.Reason)
+
+	d = c.decide(now, controllerStats(500, 0, time.Millisecond*150), 1)
+	require.Equal(t, sqlite.ControllerHold, d.Action)
+	require.Equal(t, 1.0, d.LoadAfter)
+
+	d = c.decide(now, controllerStats(0, 0, 0), 10)
+	require.Equal(t, sqlite.ControllerHold, d.Action)
+	require.Equal(t, 10.0, d.LoadAfter)
+	require.Equal(t, "no requests ended in the interval", d.Reason)
+}
+
+func TestAdaptiveControllerAIMDRate(t *testing.T) {
+	config := &Controller{
+		Algorithm: ControllerAIMD,
+		TargetP99: time.Millisecond * 100,
+	}
+	c := newAdaptiveController(config, &runControl{openLoop: true}, loadLevel{rate: 200}, nil, nil)
+	now := time.Now().UTC()
+
+	d := c.decide(now, controllerStats(500, 0, time.Millisecond*80), 200)
+	require.Equal(t, 210.0, d.LoadAfter)
+
+	d = c.decide(now, controllerStats(500, 0, time.Millisecond*150), 210)
+	require.Equal(t, 157.5, d.LoadAfter)
+}
+
+func TestAdaptiveControllerPID(t *testing.T) {
+	config := &Controller{
+		Algorithm: ControllerPID,
+		TargetP99: time.Millisecond * 100,
+	}
+	c := newAdaptiveController(config, &runControl{}, loadLevel{workers: 10}, nil, nil)
+	now := time.Now().UTC()
+
+	// Half the target: 0.5*0.5 + 0.1*2.5 = +50%.
+	d := c.decide(now, controllerStats(500, 0, time.Millisecond*50), 10)
+	require.Equal(t, sqlite.ControllerIncrease, d.Action)
+	require.Equal(t, 15.0, d.LoadAfter)
+
+	// On target, the integral keeps growing it: 0.1*2.5 + 0.1*-0.1 = +24%.
+	d = c.decide(now, controllerStats(500, 0, time.Millisecond*100), 15)
+	require.Equal(t, sqlite.ControllerIncrease, d.Action)
+	require.Equal(t, 19.0, d.LoadAfter)
+
+	// Twice the target is cut by at most half.
+	d = c.decide(now, controllerStats(500, 0, time.Millisecond*200), 19)
+	require.Equal(t, sqlite.ControllerDecrease, d.Action)
+	require.Equal(t, 9.0, d.LoadAfter)
+}
+
+func TestGenerateLoadController(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:   filepath.Join(t.TempDir(), "test.db"),
+		RunID:        util.NewID(),
+		NumWorkers:   1,
+		TestDuration: time.Second,
+		Controller: &Controller{
+			Algorithm: ControllerAIMD,
+			TargetP99: time.Second,
+			Interval:  time.Millisecond * 50,
+			Max:       4,
+		},
+	}
+
+	var mu sync.Mutex
+	workers := make(map[int]bool)
+	err := GenerateLoad(context.Background(), config, func(ctx context.Context, workerID int) (*RequestResult, error) {
+		mu.Lock()
+		workers[workerID] = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	// The p99 stays well within the target, so the controller adds workers
+	// up to its max.
+	require.Len(t, workers, 4)
+}
@@ -0,0 +1,113 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	stderrors "errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/jlym/webservice-benchmarks/grpcwire"
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/pkg/errors"
+)
+
+// classifyError returns the category of a failed request, preferring the SendRequestFunc's.
+func classifyError(outcome string, result *RequestResult, err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case result.ErrorCategory != "":
+		return result.ErrorCategory
+	case outcome == sqlite.OutcomeTimeout:
+		return sqlite.ErrorCategoryTimeout
+	case outcome == sqlite.OutcomeCancelled:
+		return sqlite.ErrorCategoryCancelled
+	case result.GRPCStatus != "" && result.GRPCStatus != grpcwire.OK.String():
+		return grpcErrorCategory(result.GRPCStatus)
+	case outcome == sqlite.OutcomeAssertionFailed:
+		switch {
+		case result.StatusCode >= 500:
+			return sqlite.ErrorCategoryHTTP5xx
+		case result.StatusCode >= 400:
+			return sqlite.ErrorCategoryHTTP4xx
+		default:
+			return sqlite.ErrorCategoryAssertionFailed
+		}
+	}
+
+	// pkg/errors wrappers can't be unwrapped by the standard library, but
+	// the errors of the net and http packages below them can.
+	cause := errors.Cause(err)
+
+	var dnsErr *net.DNSError
+	if stderrors.As(cause, &dnsErr) {
+		return sqlite.ErrorCategoryDNS
+	}
+	if isTimeout(cause) {
+		return sqlite.ErrorCategoryTimeout
+	}
+	if isTLSError(cause) {
+		return sqlite.ErrorCategoryTLS
+	}
+	if stderrors.Is(cause, syscall.EADDRNOTAVAIL) || stderrors.Is(cause, syscall.EADDRINUSE) {
+		return sqlite.ErrorCategoryAddressExhausted
+	}
+	if stderrors.Is(cause, syscall.ECONNREFUSED) {
+		return sqlite.ErrorCategoryConnectionRefused
+	}
+
+	// Once the status has been received, whatever went wrong happened
+	// while reading the body.
+	if result.StatusCode > 0 {
+		return sqlite.ErrorCategoryBodyRead
+	}
+
+	switch {
+	case stderrors.Is(cause, syscall.ECONNRESET),
+		stderrors.Is(cause, syscall.ECONNABORTED),
+		stderrors.Is(cause, syscall.EPIPE):
+		return sqlite.ErrorCategoryConnectionReset
+	case stderrors.Is(cause, io.EOF), stderrors.Is(cause, io.ErrUnexpectedEOF):
+		return sqlite.ErrorCategoryEOF
+	default:
+		return sqlite.ErrorCategoryOther
+	}
+}
+
+// grpcErrorCategory returns the category of a gRPC call that ended with status.
+func grpcErrorCategory(status string) string {
+	switch status {
+	case grpcwire.DeadlineExceeded.String():
+		return sqlite.ErrorCategoryTimeout
+	case grpcwire.Unavailable.String():
+		return sqlite.ErrorCategoryConnectionRefused
+	default:
+		return sqlite.ErrorCategoryOther
+	}
+}
+
+func isTimeout(err error) bool {
+	if stderrors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return stderrors.As(err, &netErr) && netErr.Timeout()
+}
+
+func isTLSError(err error) bool {
+	var recordHeaderErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var verificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return stderrors.As(err, &recordHeaderErr) ||
+		stderrors.As(err, &alertErr) ||
+		stderrors.As(err, &verificationErr) ||
+		stderrors.As(err, &unknownAuthorityErr) ||
+		stderrors.As(err, &hostnameErr) ||
+		stderrors.As(err, &invalidErr)
+}
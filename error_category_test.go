@@ -0,0 +1,73 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// wrapLikeClient wraps err the way net/http and the load generator's
+// client do.
+func wrapLikeClient(err error) error {
+	return errors.Wrap(&url.Error{Op: "Get", URL: "http://localhost:8080/time", Err: err}, "sending request failed")
+}
+
+func opError(errno syscall.Errno) error {
+	return &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", errno)}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcome  string
+		result   *RequestResult
+		err      error
+		category string
+	}{
+		{"success", sqlite.OutcomeSuccess, &RequestResult{}, nil, ""},
+		{"override", sqlite.OutcomeError, &RequestResult{ErrorCategory: "custom"}, errors.New("x"), "custom"},
+		{"timeout", sqlite.OutcomeTimeout, &RequestResult{}, context.DeadlineExceeded, sqlite.ErrorCategoryTimeout},
+		{"cancelled", sqlite.OutcomeCancelled, &RequestResult{}, context.Canceled, sqlite.ErrorCategoryCancelled},
+		{"4xx", sqlite.OutcomeAssertionFailed, &RequestResult{StatusCode: http.StatusNotFound}, errors.New("x"), sqlite.ErrorCategoryHTTP4xx},
+		{"5xx", sqlite.OutcomeAssertionFailed, &RequestResult{StatusCode: http.StatusServiceUnavailable}, errors.New("x"), sqlite.ErrorCategoryHTTP5xx},
+		{"assertion", sqlite.OutcomeAssertionFailed, &RequestResult{StatusCode: http.StatusOK}, errors.New("x"), sqlite.ErrorCategoryAssertionFailed},
+		{"dns", sqlite.OutcomeError, &RequestResult{}, wrapLikeClient(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nope"}}), sqlite.ErrorCategoryDNS},
+		{"refused", sqlite.OutcomeError, &RequestResult{}, wrapLikeClient(opError(syscall.ECONNREFUSED)), sqlite.ErrorCategoryConnectionRefused},
+		{"ports exhausted", sqlite.OutcomeError, &RequestResult{}, wrapLikeClient(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.EADDRNOTAVAIL)}), sqlite.ErrorCategoryAddressExhausted},
+		{"port in use", sqlite.OutcomeError, &RequestResult{}, wrapLikeClient(&net.OpError{Op: "dial", Err: os.NewSyscallError("bind", syscall.EADDRINUSE)}), sqlite.ErrorCategoryAddressExhausted},
+		{"reset", sqlite.OutcomeError, &RequestResult{}, wrapLikeClient(opError(syscall.ECONNRESET)), sqlite.ErrorCategoryConnectionReset},
+		{"eof", sqlite.OutcomeError, &RequestResult{}, wrapLikeClient(io.EOF), sqlite.ErrorCategoryEOF},
+		{"tls", sqlite.OutcomeError, &RequestResult{}, wrapLikeClient(x509.UnknownAuthorityError{}), sqlite.ErrorCategoryTLS},
+		{"dial timeout", sqlite.OutcomeError, &RequestResult{}, wrapLikeClient(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ETIMEDOUT)}), sqlite.ErrorCategoryTimeout},
+		{"body read", sqlite.OutcomeError, &RequestResult{StatusCode: http.StatusOK}, errors.Wrap(io.ErrUnexpectedEOF, "reading response body failed"), sqlite.ErrorCategoryBodyRead},
+		{"grpc deadline", sqlite.OutcomeError, &RequestResult{StatusCode: http.StatusOK, GRPCStatus: "DEADLINE_EXCEEDED"}, errors.New("grpc status DEADLINE_EXCEEDED: "), sqlite.ErrorCategoryTimeout},
+		{"grpc unavailable", sqlite.OutcomeError, &RequestResult{StatusCode: http.StatusOK, GRPCStatus: "UNAVAILABLE"}, errors.New("grpc status UNAVAILABLE: "), sqlite.ErrorCategoryConnectionRefused},
+		{"grpc other", sqlite.OutcomeError, &RequestResult{StatusCode: http.StatusOK, GRPCStatus: "INVALID_ARGUMENT"}, errors.New("grpc status INVALID_ARGUMENT: "), sqlite.ErrorCategoryOther},
+		{"other", sqlite.OutcomeError, &RequestResult{}, errors.New("something else"), sqlite.ErrorCategoryOther},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.category, classifyError(test.outcome, test.result, test.err), test.name)
+	}
+}
+
+func TestClassifyConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	_, err = http.Get("http://" + addr)
+	require.Error(t, err)
+	require.Equal(t, sqlite.ErrorCategoryConnectionRefused, classifyError(sqlite.OutcomeError, &RequestResult{}, errors.Wrap(err, "sending request failed")))
+}
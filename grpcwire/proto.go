@@ -0,0 +1,69 @@
+package grpcwire
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// Protobuf wire types.
+const (
+	WireVarint = 0
+	WireBytes  = 2
+)
+
+// Field is a varint or length-delimited field of a protobuf message.
+type Field struct {
+	Number   int
+	WireType int
+	Varint   uint64
+	Bytes    []byte
+}
+
+// AppendVarint appends a varint field, e.g. an int64, to msg.
+func AppendVarint(msg []byte, number int, v uint64) []byte {
+	msg = binary.AppendUvarint(msg, uint64(number)<<3|WireVarint)
+	return binary.AppendUvarint(msg, v)
+}
+
+// AppendBytes appends a length-delimited field, e.g. a string, to msg.
+func AppendBytes(msg []byte, number int, v []byte) []byte {
+	msg = binary.AppendUvarint(msg, uint64(number)<<3|WireBytes)
+	msg = binary.AppendUvarint(msg, uint64(len(v)))
+	return append(msg, v...)
+}
+
+// ParseFields returns the varint and length-delimited fields of msg in order.
+func ParseFields(msg []byte) ([]*Field, error) {
+	var fields []*Field
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errors.New("invalid protobuf field key")
+		}
+		msg = msg[n:]
+
+		field := &Field{Number: int(key >> 3), WireType: int(key & 7)}
+		switch field.WireType {
+		case WireVarint:
+			field.Varint, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, errors.Errorf("invalid varint in protobuf field %d", field.Number)
+			}
+			msg = msg[n:]
+
+		case WireBytes:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return nil, errors.Errorf("invalid length of protobuf field %d", field.Number)
+			}
+			field.Bytes = msg[n : n+int(size)]
+			msg = msg[n+int(size):]
+
+		default:
+			return nil, errors.Errorf("protobuf field %d has unsupported wire type %d", field.Number, field.WireType)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,132 @@
+// Package grpcwire reads and writes the parts of the gRPC wire format the benchmarks need.
+package grpcwire
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ContentType is the content type of gRPC requests and responses.
+const ContentType = "application/grpc"
+
+// MaxMessageSize is the largest message that is read.
+const MaxMessageSize = 4 << 20
+
+// Headers and trailers of gRPC responses.
+const (
+	StatusHeader  = "Grpc-Status"
+	MessageHeader = "Grpc-Message"
+)
+
+// Code is a gRPC status code.
+type Code int
+
+// The gRPC status codes.
+const (
+	OK Code = iota
+	Canceled
+	Unknown
+	InvalidArgument
+	DeadlineExceeded
+	NotFound
+	AlreadyExists
+	PermissionDenied
+	ResourceExhausted
+	FailedPrecondition
+	Aborted
+	OutOfRange
+	Unimplemented
+	Internal
+	Unavailable
+	DataLoss
+	Unauthenticated
+)
+
+var codeNames = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// String returns the code's name, e.g. INVALID_ARGUMENT.
+func (c Code) String() string {
+	if c >= 0 && int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return "CODE(" + strconv.Itoa(int(c)) + ")"
+}
+
+// ResponseStatus returns the status of a response whose body has been read to the end.
+func ResponseStatus(resp *http.Response) (Code, string, error) {
+	value := resp.Trailer.Get(StatusHeader)
+	message := resp.Trailer.Get(MessageHeader)
+	if value == "" {
+		value = resp.Header.Get(StatusHeader)
+		message = resp.Header.Get(MessageHeader)
+	}
+	if value == "" {
+		return Unknown, "", errors.New("response has no grpc status")
+	}
+
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return Unknown, "", errors.Wrapf(err, "invalid grpc status %q", value)
+	}
+	return Code(code), message, nil
+}
+
+// WriteMessage writes msg as an uncompressed, length-prefixed message.
+func WriteMessage(w io.Writer, msg []byte) error {
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	_, err := w.Write(append(prefix, msg...))
+	if err != nil {
+		return errors.Wrap(err, "writing grpc message failed")
+	}
+	return nil
+}
+
+// ReadMessage reads the next length-prefixed message, or returns io.EOF.
+func ReadMessage(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, 5)
+	_, err := io.ReadFull(r, prefix)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading grpc message prefix failed")
+	}
+
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed grpc messages aren't supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > MaxMessageSize {
+		return nil, errors.Errorf("grpc message of %d bytes is larger than %d", size, MaxMessageSize)
+	}
+
+	msg := make([]byte, size)
+	_, err = io.ReadFull(r, msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading grpc message failed")
+	}
+	return msg, nil
+}
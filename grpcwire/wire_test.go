@@ -0,0 +1,74 @@
+package grpcwire
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessages(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteMessage(buf, []byte("first")))
+	require.NoError(t, WriteMessage(buf, nil))
+	require.Equal(t, 5+5+5, buf.Len())
+
+	msg, err := ReadMessage(buf)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(msg))
+	msg, err = ReadMessage(buf)
+	require.NoError(t, err)
+	require.Empty(t, msg)
+	_, err = ReadMessage(buf)
+	require.Equal(t, io.EOF, err)
+
+	// A message cut short is an error, not the end of the messages.
+	_, err = ReadMessage(bytes.NewReader([]byte{0, 0, 0, 0, 4, 'a'}))
+	require.Error(t, err)
+	_, err = ReadMessage(bytes.NewReader([]byte{1, 0, 0, 0, 0}))
+	require.Error(t, err)
+}
+
+func TestFields(t *testing.T) {
+	var msg []byte
+	msg = AppendVarint(msg, 1, 1000)
+	msg = AppendBytes(msg, 2, []byte("time"))
+	msg = AppendVarint(msg, 300, 0)
+
+	fields, err := ParseFields(msg)
+	require.NoError(t, err)
+	require.Equal(t, []*Field{
+		{Number: 1, WireType: WireVarint, Varint: 1000},
+		{Number: 2, WireType: WireBytes, Bytes: []byte("time")},
+		{Number: 300, WireType: WireVarint},
+	}, fields)
+
+	_, err = ParseFields(msg[:len(msg)-1])
+	require.Error(t, err)
+	_, err = ParseFields([]byte{0x0d, 0, 0, 0, 0})
+	require.Error(t, err)
+}
+
+func TestResponseStatus(t *testing.T) {
+	resp := &http.Response{
+		Header:  http.Header{},
+		Trailer: http.Header{StatusHeader: {"3"}, MessageHeader: {"n should be positive"}},
+	}
+	code, message, err := ResponseStatus(resp)
+	require.NoError(t, err)
+	require.Equal(t, InvalidArgument, code)
+	require.Equal(t, "INVALID_ARGUMENT", code.String())
+	require.Equal(t, "n should be positive", message)
+
+	// Responses without messages can put the status in the headers.
+	resp = &http.Response{Header: http.Header{StatusHeader: {"0"}}}
+	code, _, err = ResponseStatus(resp)
+	require.NoError(t, err)
+	require.Equal(t, OK, code)
+
+	_, _, err = ResponseStatus(&http.Response{Header: http.Header{}})
+	require.Error(t, err)
+	require.Equal(t, "CODE(42)", Code(42).String())
+}
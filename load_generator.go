@@ -2,14 +2,95 @@ package webservice_benchmarks
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jlym/webservice-benchmarks/sqlite"
 	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/process"
 )
 
-type SendRequestFunc func(workerID int) error
+// profileTick is how often the load is adjusted to follow the load profile.
+const profileTick = time.Millisecond * 100
+
+// SendRequestFunc sends one request, returning soon after ctx is cancelled.
+type SendRequestFunc func(ctx context.Context, workerID int) (*RequestResult, error)
+
+// ErrNoMoreRequests is returned by a SendRequestFunc that has run out of requests.
+var ErrNoMoreRequests = errors.New("no more requests")
+
+// AbortError is returned when a run was stopped before it was over.
+type AbortError struct {
+	RunID  string
+	Reason string
+	// Rule is the abort rule that stopped the run, or empty if it was
+	// stopped some other way, like by a signal.
+	Rule string
+	// Time is when the run was told to stop.
+	Time time.Time
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("run %s aborted: %s", e.RunID, e.Reason)
+}
+
+// RequestResult is what a SendRequestFunc learned about a request.
+type RequestResult struct {
+	StatusCode    int
+	BytesSent     int64
+	BytesReceived int64
+	// Validation is sqlite.ValidationPassed or sqlite.ValidationFailed if
+	// the response was checked, and empty otherwise.
+	Validation string
+	Label      string
+	// Name identifies the kind of request, so latency can be broken down
+	// per operation.
+	Name string
+	// FailedAssertion names the check the response failed, when the
+	// request failed because the server responded with the wrong thing
+	// rather than not responding.
+	FailedAssertion string
+	// ErrorCategory overrides the sqlite.ErrorCategory the error would be
+	// classified as.
+	ErrorCategory string
+
+	// Durations of the phases of an HTTP request. Phases that didn't happen,
+	// like connecting on a reused connection, are 0.
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// TimeToFirstByte is from the request being written to the first byte
+	// of the response.
+	TimeToFirstByte time.Duration
+	BodyRead        time.Duration
+	ConnReused      bool
+	LocalPort       int
+	// Protocol is the protocol the response came back over, e.g. HTTP/1.1
+	// or HTTP/2.0.
+	Protocol string
+	// GRPCStatus is the name of the status a gRPC call ended with, e.g. OK
+	// or UNAVAILABLE. It is empty for plain HTTP requests.
+	GRPCStatus string
+
+	// ConnEvents are what happened to a long-lived connection since the
+	// worker's previous request, like it being opened or dropped.
+	ConnEvents []*ConnEvent
+}
+
+// ConnEvent is an event in the life of a long-lived connection.
+type ConnEvent struct {
+	Time time.Time
+	// Event is one of the sqlite.ConnEvent constants.
+	Event     string
+	Error     string
+	LocalPort int
+}
 
 type TestConfig struct {
 	DBFilePath     string
@@ -17,87 +98,608 @@ type TestConfig struct {
 	RampUpDuration time.Duration
 	TestDuration   time.Duration
 	RunID          string
+	Desc           string
+	// ExperimentID groups this run with the other runs of a search or sweep.
+	ExperimentID string
+
+	// ArrivalRate is the number of requests per second to send. When it is
+	// set, requests are scheduled independently of how long the server takes
+	// to respond (open-loop), NumWorkers is the maximum number of requests in
+	// flight and RampUpDuration is ignored. When it is 0, each worker sends
+	// its next request as soon as the previous one returns (closed-loop).
+	ArrivalRate float64
+
+	// RequestTimeout is the deadline given to each call of SendRequestFunc.
+	// 0 means no deadline.
+	RequestTimeout time.Duration
+	// ShutdownTimeout is how long to wait for in-flight requests once the
+	// run is over before cancelling them. 0 means waiting for as long as
+	// they take.
+	ShutdownTimeout time.Duration
+
+	// Stages is the load profile of the run. When it is set, it replaces
+	// RampUpDuration, TestDuration and ArrivalRate. Stages that set Rate run
+	// open-loop with NumWorkers senders.
+	Stages []Stage
+
+	// Pacing, when set, is the interval at which each closed-loop worker
+	// starts its requests, instead of starting the next one as soon as the
+	// previous one returns. A worker that falls behind starts its next
+	// request right away, and it is recorded as late.
+	Pacing time.Duration
+	// CloseWorker, when set, is called when a closed-loop worker stops, to
+	// release what it holds, like an open connection. Its result is
+	// recorded like a request's, unless both the result and the error are
+	// nil because the worker held nothing.
+	CloseWorker SendRequestFunc
+
+	// ControlAddr, when set, is the address the control API of the run
+	// listens on while it is going. It serves the run's live stats and
+	// changes its load, pauses, annotates or stops it, recording each
+	// change as a run event.
+	ControlAddr string
+
+	// Controller, when set, keeps adjusting the run's load to hold its p99
+	// latency at a target. It can't be used with Schedule.
+	Controller *Controller
+
+	// ProgressInterval, when set, is how often a summary of the requests of
+	// the last interval is logged while the run is going.
+	ProgressInterval time.Duration
+
+	// AbortRules stop the run early when one of them fires, each evaluated
+	// every second on the requests that ended in the last AbortWindow, or
+	// 30s if it isn't set.
+	AbortRules  []*AbortRule
+	AbortWindow time.Duration
+
+	// Schedule, when set, replaces the load profile. NumWorkers senders
+	// start a request at each of its offsets from the start of the run,
+	// which must be in ascending order, and the run ends after the last one.
+	Schedule []time.Duration
+
+	// Scenario is the serialized scenario the run was started from. It is
+	// stored with the run so it can be reproduced.
+	Scenario string
+	// ClientSettings are the serialized connection settings of the client
+	// that sends the requests, stored with the run to compare runs by them.
+	ClientSettings string
+	// Transport is what the client connects over, tcp or unix, so results
+	// of the same scenario over both can be compared.
+	Transport string
 }
 
-func GenerateLoad(config *TestConfig, f SendRequestFunc) error {
-	ctx := context.Background()
+// GenerateLoad sends requests with f following config and records them.
+func GenerateLoad(ctx context.Context, config *TestConfig, f SendRequestFunc) error {
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	// Stopping the run shouldn't stop it from being saved.
+	writeCtx := context.WithoutCancel(ctx)
+
+	profile, err := newLoadProfile(config)
+	if err != nil {
+		return err
+	}
+	err = validateSchedule(config.Schedule)
+	if err != nil {
+		return err
+	}
+	if config.Controller != nil {
+		if len(config.Schedule) > 0 {
+			return errors.New("the controller can't adjust the load of a run that follows a schedule")
+		}
+		err = config.Controller.validate()
+		if err != nil {
+			return err
+		}
+	}
 
 	data, err := sqlite.NewDataStore(config.DBFilePath)
 	if err != nil {
 		return err
 	}
+	defer data.Close()
+
+	err = data.CreateTables(writeCtx)
+	if err != nil {
+		return err
+	}
 
-	err = data.CreateTables(ctx)
+	host, err := os.Hostname()
+	if err != nil {
+		return errors.Wrap(err, "getting host name failed")
+	}
+	staleRunIDs, err := data.MarkStaleRuns(writeCtx, host, processExists)
 	if err != nil {
 		return err
 	}
+	for _, runID := range staleRunIDs {
+		log.Println(fmt.Sprintf("marked run %s as failed, its process exited without finishing it", runID))
+	}
+
+	var controlListener net.Listener
+	if config.ControlAddr != "" {
+		controlListener, err = listenControl(config.ControlAddr)
+		if err != nil {
+			return err
+		}
+		defer controlListener.Close()
+	}
 
 	data.Start()
-	defer func() {
-		data.Stop()
-		_ = data.Close()
-	}()
+	defer data.Stop()
+
+	maxLevel := profile.maxLevel()
+	numWorkers := maxLevel.workers
+	arrivalRate := maxLevel.rate
+	if profile.openLoop {
+		numWorkers = config.NumWorkers
+	}
+	if len(config.Schedule) > 0 {
+		numWorkers = config.NumWorkers
+		arrivalRate = scheduleRate(config.Schedule)
+	}
 
 	run := &sqlite.Run{
 		ID:        config.RunID,
 		StartTime: time.Now().UTC(),
 	}
-	err = data.WriteRunStart(ctx, &sqlite.AddRunParams{
-		ID:         run.ID,
-		StartTime:  run.StartTime,
-		NumWorkers: config.NumWorkers,
+	err = data.WriteRunStart(writeCtx, &sqlite.AddRunParams{
+		ID:             run.ID,
+		StartTime:      run.StartTime,
+		Desc:           config.Desc,
+		NumWorkers:     numWorkers,
+		ArrivalRate:    arrivalRate,
+		ExperimentID:   config.ExperimentID,
+		Scenario:       config.Scenario,
+		ClientSettings: config.ClientSettings,
+		Transport:      config.Transport,
+		ProcessID:      os.Getpid(),
+		Host:           host,
 	})
 	if err != nil {
 		return err
 	}
 
-	stopSender := util.NewStopSender()
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+
+	sender := &requestSender{
+		ctx:             runCtx,
+		db:              data,
+		run:             run,
+		requestTimeout:  config.RequestTimeout,
+		f:               f,
+		closeWorkerFunc: config.CloseWorker,
+		exhausted:       make(chan struct{}),
+	}
+
+	abortStopSender := util.NewStopSender()
+	if len(config.AbortRules) > 0 {
+		window := config.AbortWindow
+		if window <= 0 {
+			window = defaultAbortWindow
+		}
+		watcher := &abortWatcher{
+			rules:  config.AbortRules,
+			window: newRollingWindow(window),
+			db:     data,
+			run:    run,
+		}
+		sender.windows = append(sender.windows, watcher.window)
+		go watcher.watch(abortStopSender.NewReciever(), abort)
+	}
+
+	control := &runControl{
+		openLoop:  profile.openLoop,
+		scheduled: len(config.Schedule) > 0,
+	}
+	controlServer := &controlServer{
+		control: control,
+		sender:  sender,
+		window:  newRollingWindow(controlStatsWindow),
+		db:      data,
+		run:     run,
+		abort:   abort,
+	}
+	if controlListener != nil {
+		sender.windows = append(sender.windows, controlServer.window)
+		controlServer.serve(controlListener)
+	}
+
+	controllerStopSender := util.NewStopSender()
+	var controller *adaptiveController
+	if config.Controller != nil {
+		controller = newAdaptiveController(config.Controller, control, maxLevel, data, run)
+		sender.windows = append(sender.windows, controller.window)
+		go controller.adjust(controllerStopSender.NewReciever())
+	}
+
+	progressStopSender := util.NewStopSender()
+	if config.ProgressInterval > 0 {
+		reporter := &progressReporter{
+			interval: config.ProgressInterval,
+			window:   newRollingWindow(config.ProgressInterval),
+			sender:   sender,
+			db:       data,
+			run:      run,
+		}
+		sender.windows = append(sender.windows, reporter.window)
+		go reporter.report(progressStopSender.NewReciever())
+	}
 
-	for workerID := 0; workerID < config.NumWorkers; workerID++ {
-		log.Println("start: ", workerID)
-		go doActionRepeatedly(
-			stopSender.NewReciever(),
-			data,
-			run,
-			workerID,
-			f)
+	var pool *workerPool
+	switch {
+	case len(config.Schedule) > 0:
+		scheduler := newFixedScheduler(config.Schedule)
+		pool = newWorkerPool(func(stopReciever *util.StopReciever, workerID int) {
+			sendScheduledRequests(stopReciever, sender, workerID, scheduler.intendedStarts)
+		})
+		pool.resize(config.NumWorkers)
+		scheduler.start(run.StartTime)
 
-		if workerID < config.NumWorkers-1 {
-			time.Sleep(config.RampUpDuration)
+		select {
+		case <-scheduler.done:
+		case <-sender.exhausted:
+		case <-ctx.Done():
 		}
+
+		scheduler.stopAndWait()
+	case profile.openLoop:
+		scheduler := newRateScheduler()
+		pool = newWorkerPool(func(stopReciever *util.StopReciever, workerID int) {
+			sendScheduledRequests(stopReciever, sender, workerID, scheduler.intendedStarts)
+		})
+		pool.resize(config.NumWorkers)
+		scheduler.start()
+
+		followProfile(ctx, data, run, profile, sender.exhausted, func(level loadLevel) {
+			scheduler.setRate(control.apply(level).rate)
+		})
+
+		scheduler.stopAndWait()
+	default:
+		pool = newWorkerPool(func(stopReciever *util.StopReciever, workerID int) {
+			doActionRepeatedly(stopReciever, sender, workerID, config.Pacing)
+		})
+
+		followProfile(ctx, data, run, profile, sender.exhausted, func(level loadLevel) {
+			pool.resize(control.apply(level).workers)
+		})
+	}
+
+	stopTime := time.Now().UTC()
+	controlServer.close()
+	abortStopSender.StopAndWait()
+	controllerStopSender.StopAndWait()
+	progressStopSender.StopAndWait()
+	pool.stop()
+	waitOrCancel(pool.wait, config.ShutdownTimeout, cancelRun)
+	if controller != nil {
+		controller.logResult()
+	}
+
+	if ctx.Err() == nil {
+		return data.WriteRunEnd(writeCtx, &sqlite.RunEndParams{
+			RunID:   run.ID,
+			EndTime: time.Now().UTC(),
+			Status:  sqlite.RunStatusCompleted,
+		})
+	}
+
+	abortErr := &AbortError{
+		RunID:  run.ID,
+		Reason: context.Cause(ctx).Error(),
+		Time:   stopTime,
+	}
+	if violation, ok := context.Cause(ctx).(*ruleViolation); ok {
+		abortErr.Rule = violation.rule.String()
+		abortErr.Time = violation.time
+	}
+	err = data.WriteRunEnd(writeCtx, &sqlite.RunEndParams{
+		RunID:       run.ID,
+		EndTime:     time.Now().UTC(),
+		Status:      sqlite.RunStatusAborted,
+		AbortReason: abortErr.Reason,
+		AbortRule:   abortErr.Rule,
+		AbortTime:   abortErr.Time,
+	})
+	if err != nil {
+		return err
 	}
+	return abortErr
+}
 
-	time.Sleep(config.TestDuration)
-	stopSender.StopAndWait()
+// processExists tells whether a process is alive, assuming it is when it can't tell.
+func processExists(pid int) bool {
+	exists, err := process.PidExists(int32(pid))
+	if err != nil {
+		return true
+	}
+	return exists
+}
+
+// waitOrCancel calls wait, and cancel if it hasn't returned after timeout.
+func waitOrCancel(wait func(), timeout time.Duration, cancel context.CancelFunc) {
+	if timeout <= 0 {
+		wait()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
 
-	return data.WriteRunEnd(ctx, run.ID, time.Now().UTC())
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Println(fmt.Sprintf("requests still in flight after %v, cancelling them", timeout))
+		cancel()
+		<-done
+	}
 }
 
-func doActionRepeatedly(
-	stopReciever *util.StopReciever,
+// followProfile calls setLevel with the profile's load every profileTick until it is over.
+func followProfile(
+	ctx context.Context,
 	db *sqlite.DataStore,
 	run *sqlite.Run,
+	profile *loadProfile,
+	done <-chan struct{},
+	setLevel func(level loadLevel)) {
+
+	ticker := time.NewTicker(profileTick)
+	defer ticker.Stop()
+
+	nextStage := 0
+	for {
+		level, ok := profile.levelAt(time.Since(run.StartTime))
+		if !ok {
+			level.stageIndex = len(profile.stages) - 1
+		}
+
+		for ; nextStage <= level.stageIndex; nextStage++ {
+			stage := profile.stages[nextStage]
+			db.QueueRunStage(run, &sqlite.AddRunStageParams{
+				StageIndex: nextStage,
+				Name:       stage.Name,
+				StartTime:  run.StartTime.Add(profile.stageStart(nextStage)),
+				Duration:   stage.Duration,
+				Workers:    stage.Workers,
+				Rate:       stage.Rate,
+				Ramp:       stage.Ramp,
+			})
+		}
+
+		if !ok {
+			return
+		}
+
+		setLevel(level)
+
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func doActionRepeatedly(
+	stopReciever *util.StopReciever,
+	sender *requestSender,
 	workerID int,
-	f SendRequestFunc) {
+	pacing time.Duration) {
 
 	defer stopReciever.Done()
+	defer sender.closeWorker(workerID)
+	atomic.AddInt64(&sender.workers, 1)
+	defer atomic.AddInt64(&sender.workers, -1)
 
+	next := time.Now().UTC()
 	for stopReciever.ShouldContinue() {
-		start := time.Now().UTC()
-		err := f(workerID)
-		end := time.Now().UTC()
+		resumed, ok := sender.pause.wait(stopReciever)
+		if !ok {
+			return
+		}
+		if resumed {
+			// The requests that weren't sent while paused aren't made up
+			// for.
+			next = time.Now().UTC()
+		}
 
-		errorMessage := ""
-		if err != nil {
-			errorMessage = err.Error()
+		intendedStart := time.Now().UTC()
+		if pacing > 0 {
+			if !sleepUntil(stopReciever, next) {
+				return
+			}
+			intendedStart = next
+			next = next.Add(pacing)
 		}
 
-		db.QueueClientRequest(run, &sqlite.AddRequestParams{
+		if !sender.send(workerID, intendedStart) {
+			return
+		}
+	}
+}
+
+// sleepUntil waits until t, returning false if the worker was told to stop first.
+func sleepUntil(stopReciever *util.StopReciever, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-stopReciever.ShouldStopC:
+		return false
+	}
+}
+
+// requestSender calls SendRequestFunc and queues the outcome of each call.
+type requestSender struct {
+	// ctx is cancelled when in-flight requests should be abandoned.
+	ctx            context.Context
+	db             *sqlite.DataStore
+	run            *sqlite.Run
+	requestTimeout time.Duration
+	f              SendRequestFunc
+	// closeWorkerFunc is called when a closed-loop worker stops, if set.
+	closeWorkerFunc SendRequestFunc
+	// pause holds back closed-loop workers while the run is paused.
+	pause pauseGate
+
+	// windows get the outcome of every request too.
+	windows []*rollingWindow
+
+	// workers is the number of workers running, and inFlight the number of
+	// requests they are waiting for.
+	workers  int64
+	inFlight int64
+
+	// exhausted is closed when f returns ErrNoMoreRequests.
+	exhausted   chan struct{}
+	exhaustOnce sync.Once
+}
+
+// send sends one request, returning false when there are no more to send.
+func (s *requestSender) send(workerID int, intendedStart time.Time) bool {
+	if s.ctx.Err() != nil {
+		return false
+	}
+
+	ctx, cancel := s.requestContext()
+	defer cancel()
+
+	atomic.AddInt64(&s.inFlight, 1)
+	start := time.Now().UTC()
+	result, err := s.f(ctx, workerID)
+	end := time.Now().UTC()
+	atomic.AddInt64(&s.inFlight, -1)
+
+	if errors.Cause(err) == ErrNoMoreRequests {
+		s.exhaustOnce.Do(func() {
+			log.Println("no more requests to send")
+			close(s.exhausted)
+		})
+		return false
+	}
+
+	s.record(ctx, workerID, intendedStart, start, end, result, err)
+	return true
+}
+
+// closeWorker releases what workerID holds and records the outcome.
+func (s *requestSender) closeWorker(workerID int) {
+	if s.closeWorkerFunc == nil {
+		return
+	}
+
+	ctx, cancel := s.requestContext()
+	defer cancel()
+
+	start := time.Now().UTC()
+	result, err := s.closeWorkerFunc(ctx, workerID)
+	end := time.Now().UTC()
+	if result == nil && err == nil {
+		return
+	}
+
+	s.record(ctx, workerID, start, start, end, result, err)
+}
+
+// record queues the outcome of a SendRequestFunc call and its connection events.
+func (s *requestSender) record(
+	ctx context.Context,
+	workerID int,
+	intendedStart, start, end time.Time,
+	result *RequestResult,
+	err error) {
+
+	if result == nil {
+		result = &RequestResult{}
+	}
+
+	errorMessage := ""
+	if err != nil {
+		errorMessage = err.Error()
+	}
+	outcome := s.outcome(ctx, result, err)
+
+	errorCategory := classifyError(outcome, result, err)
+	for _, window := range s.windows {
+		window.add(intendedStart, end, err == nil, errorCategory)
+	}
+
+	s.db.QueueClientRequest(s.run, &sqlite.AddRequestParams{
+		WorkerID:          workerID,
+		IntendedStartTime: intendedStart,
+		StartTime:         start,
+		EndTime:           end,
+		Success:           err == nil,
+		Outcome:           outcome,
+		Error:             errorMessage,
+		ErrorCategory:     errorCategory,
+		StatusCode:        result.StatusCode,
+		BytesSent:         result.BytesSent,
+		BytesReceived:     result.BytesReceived,
+		Validation:        result.Validation,
+		Label:             result.Label,
+		RequestName:       result.Name,
+		FailedAssertion:   result.FailedAssertion,
+		DNS:               result.DNS,
+		Connect:           result.Connect,
+		TLSHandshake:      result.TLSHandshake,
+		TimeToFirstByte:   result.TimeToFirstByte,
+		BodyRead:          result.BodyRead,
+		ConnReused:        result.ConnReused,
+		LocalPort:         result.LocalPort,
+		Protocol:          result.Protocol,
+		GRPCStatus:        result.GRPCStatus,
+	})
+
+	for _, event := range result.ConnEvents {
+		s.db.QueueConnEvent(s.run, &sqlite.AddConnEventParams{
 			WorkerID:  workerID,
-			StartTime: start,
-			EndTime:   end,
-			Success:   err == nil,
-			Error:     errorMessage,
+			Time:      event.Time,
+			Event:     event.Event,
+			Error:     event.Error,
+			LocalPort: event.LocalPort,
 		})
 	}
 }
+
+func (s *requestSender) requestContext() (context.Context, context.CancelFunc) {
+	if s.requestTimeout > 0 {
+		return context.WithTimeout(s.ctx, s.requestTimeout)
+	}
+	return context.WithCancel(s.ctx)
+}
+
+// outcome tells failed requests apart from ones cut short by their deadline or the shutdown.
+func (s *requestSender) outcome(ctx context.Context, result *RequestResult, err error) string {
+	switch {
+	case err == nil:
+		return sqlite.OutcomeSuccess
+	case result.FailedAssertion != "":
+		return sqlite.OutcomeAssertionFailed
+	case s.ctx.Err() != nil:
+		return sqlite.OutcomeCancelled
+	case ctx.Err() == context.DeadlineExceeded:
+		return sqlite.OutcomeTimeout
+	default:
+		return sqlite.OutcomeError
+	}
+}
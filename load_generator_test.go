@@ -0,0 +1,236 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func waitForCancel(ctx context.Context, _ int) (*RequestResult, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func getTestOutcomeCounts(t *testing.T, config *TestConfig) map[string]int {
+	data, err := sqlite.NewDataStore(config.DBFilePath)
+	require.NoError(t, err)
+	defer data.Close()
+
+	counts, err := data.GetOutcomeCounts(context.Background(), config.RunID)
+	require.NoError(t, err)
+	return counts
+}
+
+func TestGenerateLoadRequestTimeout(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:     filepath.Join(t.TempDir(), "test.db"),
+		RunID:          util.NewID(),
+		NumWorkers:     2,
+		TestDuration:   time.Millisecond * 300,
+		RequestTimeout: time.Millisecond * 50,
+	}
+
+	err := GenerateLoad(context.Background(), config, waitForCancel)
+	require.NoError(t, err)
+
+	counts := getTestOutcomeCounts(t, config)
+	require.True(t, counts[sqlite.OutcomeTimeout] > 0)
+	require.Equal(t, 0, counts[sqlite.OutcomeSuccess])
+	require.Equal(t, 0, counts[sqlite.OutcomeError])
+}
+
+func TestGenerateLoadShutdownTimeout(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:      filepath.Join(t.TempDir(), "test.db"),
+		RunID:           util.NewID(),
+		NumWorkers:      2,
+		TestDuration:    time.Millisecond * 100,
+		ShutdownTimeout: time.Millisecond * 100,
+	}
+
+	start := time.Now()
+	err := GenerateLoad(context.Background(), config, waitForCancel)
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < time.Second)
+
+	counts := getTestOutcomeCounts(t, config)
+	require.Equal(t, map[string]int{sqlite.OutcomeCancelled: 2}, counts)
+}
+
+// sendN returns a SendRequestFunc that succeeds n times and then runs out
+// of requests.
+func sendN(n int64) SendRequestFunc {
+	var sent int64
+	return func(ctx context.Context, _ int) (*RequestResult, error) {
+		if atomic.AddInt64(&sent, 1) > n {
+			return nil, ErrNoMoreRequests
+		}
+		return &RequestResult{}, nil
+	}
+}
+
+func TestGenerateLoadNoMoreRequests(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:   filepath.Join(t.TempDir(), "test.db"),
+		RunID:        util.NewID(),
+		NumWorkers:   3,
+		TestDuration: time.Second * 30,
+	}
+
+	start := time.Now()
+	err := GenerateLoad(context.Background(), config, sendN(20))
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < time.Second*5)
+
+	counts := getTestOutcomeCounts(t, config)
+	require.Equal(t, map[string]int{sqlite.OutcomeSuccess: 20}, counts)
+}
+
+func TestGenerateLoadSchedule(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:   filepath.Join(t.TempDir(), "test.db"),
+		RunID:        util.NewID(),
+		NumWorkers:   2,
+		TestDuration: time.Second * 30,
+		Schedule: []time.Duration{
+			0,
+			time.Millisecond * 100,
+			time.Millisecond * 100,
+			time.Millisecond * 300,
+		},
+	}
+
+	start := time.Now()
+	err := GenerateLoad(context.Background(), config, sendN(10))
+	require.NoError(t, err)
+	elapsed := time.Since(start)
+	require.True(t, elapsed >= time.Millisecond*300)
+	require.True(t, elapsed < time.Second*5)
+
+	counts := getTestOutcomeCounts(t, config)
+	require.Equal(t, map[string]int{sqlite.OutcomeSuccess: 4}, counts)
+
+	config.RunID = util.NewID()
+	config.Schedule = []time.Duration{time.Millisecond, 0}
+	err = GenerateLoad(context.Background(), config, sendN(10))
+	require.Error(t, err)
+}
+
+func TestGenerateLoadAssertionFailed(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:   filepath.Join(t.TempDir(), "test.db"),
+		RunID:        util.NewID(),
+		NumWorkers:   2,
+		TestDuration: time.Millisecond * 100,
+	}
+
+	err := GenerateLoad(context.Background(), config, func(ctx context.Context, workerID int) (*RequestResult, error) {
+		if workerID == 0 {
+			return &RequestResult{StatusCode: 200, FailedAssertion: "body_regex"}, errors.New("wrong body")
+		}
+		return nil, errors.New("connection refused")
+	})
+	require.NoError(t, err)
+
+	counts := getTestOutcomeCounts(t, config)
+	require.True(t, counts[sqlite.OutcomeAssertionFailed] > 0)
+	require.True(t, counts[sqlite.OutcomeError] > 0)
+	require.Equal(t, 0, counts[sqlite.OutcomeSuccess])
+}
+
+func TestGenerateLoadPacing(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:   filepath.Join(t.TempDir(), "test.db"),
+		RunID:        util.NewID(),
+		NumWorkers:   2,
+		TestDuration: time.Millisecond * 200,
+		Pacing:       time.Millisecond * 50,
+	}
+
+	var sent, closed int64
+	config.CloseWorker = func(ctx context.Context, workerID int) (*RequestResult, error) {
+		atomic.AddInt64(&closed, 1)
+		return &RequestResult{
+			Name:       "close",
+			ConnEvents: []*ConnEvent{{Time: time.Now().UTC(), Event: sqlite.ConnEventClose}},
+		}, nil
+	}
+	err := GenerateLoad(context.Background(), config, func(ctx context.Context, workerID int) (*RequestResult, error) {
+		atomic.AddInt64(&sent, 1)
+		return &RequestResult{}, nil
+	})
+	require.NoError(t, err)
+
+	// Each worker sends at most one request per 50ms instead of as many as
+	// it can, and is closed once when it stops.
+	require.True(t, sent >= 4 && sent <= 12, "sent %d", sent)
+	require.Equal(t, int64(2), closed)
+	counts := getTestOutcomeCounts(t, config)
+	require.Equal(t, int(sent+closed), counts[sqlite.OutcomeSuccess])
+}
+
+func getTestRunStatus(t *testing.T, config *TestConfig) *sqlite.RunStatus {
+	data, err := sqlite.NewDataStore(config.DBFilePath)
+	require.NoError(t, err)
+	defer data.Close()
+
+	status, err := data.GetRunStatus(context.Background(), config.RunID)
+	require.NoError(t, err)
+	return status
+}
+
+func TestGenerateLoadStatus(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:   filepath.Join(t.TempDir(), "test.db"),
+		RunID:        util.NewID(),
+		NumWorkers:   1,
+		TestDuration: time.Millisecond * 100,
+	}
+
+	err := GenerateLoad(context.Background(), config, sendN(10))
+	require.NoError(t, err)
+
+	status := getTestRunStatus(t, config)
+	require.Equal(t, sqlite.RunStatusCompleted, status.Status)
+	require.Empty(t, status.AbortReason)
+	require.NotNil(t, status.EndTime)
+}
+
+func TestGenerateLoadAborted(t *testing.T) {
+	config := &TestConfig{
+		DBFilePath:   filepath.Join(t.TempDir(), "test.db"),
+		RunID:        util.NewID(),
+		NumWorkers:   2,
+		TestDuration: time.Second * 30,
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(time.Millisecond*100, func() {
+		cancel(errors.New("received signal interrupt"))
+	})
+
+	start := time.Now()
+	err := GenerateLoad(ctx, config, waitForCancel)
+	require.True(t, time.Since(start) < time.Second*5)
+
+	abortErr, ok := errors.Cause(err).(*AbortError)
+	require.True(t, ok, "%v", err)
+	require.Equal(t, config.RunID, abortErr.RunID)
+	require.Equal(t, "received signal interrupt", abortErr.Reason)
+
+	// The requests in flight are cancelled and still recorded.
+	counts := getTestOutcomeCounts(t, config)
+	require.Equal(t, map[string]int{sqlite.OutcomeCancelled: 2}, counts)
+
+	status := getTestRunStatus(t, config)
+	require.Equal(t, sqlite.RunStatusAborted, status.Status)
+	require.Equal(t, "received signal interrupt", status.AbortReason)
+	require.NotNil(t, status.EndTime)
+}
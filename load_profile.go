@@ -0,0 +1,220 @@
+package webservice_benchmarks
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Stage is one segment of a load profile, with either workers or an arrival rate.
+type Stage struct {
+	Name     string
+	Duration time.Duration
+	Workers  int
+	Rate     float64
+	// Ramp changes the load linearly from the previous stage's level to this
+	// stage's level over Duration. Otherwise the load steps to this stage's
+	// level as soon as the stage starts.
+	Ramp bool
+}
+
+// ParseStage parses a stage like "1m:10", "warmup=5m:200:ramp" or "30s:500/s".
+func ParseStage(s string) (Stage, error) {
+	stage := Stage{}
+
+	spec := s
+	if i := strings.Index(spec, "="); i >= 0 {
+		stage.Name = spec[:i]
+		spec = spec[i+1:]
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Stage{}, errors.Errorf("stage %q should look like [name=]duration:target[:ramp]", s)
+	}
+
+	duration, err := time.ParseDuration(parts[0])
+	if err != nil {
+		return Stage{}, errors.Wrapf(err, "stage %q has an invalid duration", s)
+	}
+	stage.Duration = duration
+
+	target := parts[1]
+	if strings.HasSuffix(target, "/s") {
+		rate, err := strconv.ParseFloat(strings.TrimSuffix(target, "/s"), 64)
+		if err != nil {
+			return Stage{}, errors.Wrapf(err, "stage %q has an invalid rate", s)
+		}
+		stage.Rate = rate
+	} else {
+		workers, err := strconv.Atoi(target)
+		if err != nil {
+			return Stage{}, errors.Wrapf(err, "stage %q has an invalid number of workers", s)
+		}
+		stage.Workers = workers
+	}
+
+	if len(parts) == 3 {
+		if parts[2] != "ramp" {
+			return Stage{}, errors.Errorf("stage %q - expected \"ramp\", got %q", s, parts[2])
+		}
+		stage.Ramp = true
+	}
+
+	return stage, nil
+}
+
+// String writes the stage the way ParseStage reads it.
+func (s Stage) String() string {
+	spec := s.Duration.String() + ":" + strconv.Itoa(s.Workers)
+	if s.Rate > 0 {
+		spec = s.Duration.String() + ":" + strconv.FormatFloat(s.Rate, 'f', -1, 64) + "/s"
+	}
+	if s.Ramp {
+		spec += ":ramp"
+	}
+	if s.Name != "" {
+		spec = s.Name + "=" + spec
+	}
+	return spec
+}
+
+type loadProfile struct {
+	stages   []Stage
+	openLoop bool
+}
+
+type loadLevel struct {
+	stageIndex int
+	workers    int
+	rate       float64
+}
+
+// newLoadProfile returns config.Stages, or the stages equivalent to the older settings.
+func newLoadProfile(config *TestConfig) (*loadProfile, error) {
+	stages := config.Stages
+	if len(stages) == 0 {
+		stages = defaultStages(config)
+	}
+
+	openLoop := config.ArrivalRate > 0
+	for _, stage := range stages {
+		if stage.Rate > 0 {
+			openLoop = true
+		}
+	}
+
+	for i, stage := range stages {
+		if stage.Duration < 0 {
+			return nil, errors.Errorf("stage %d has a negative duration", i)
+		}
+		if stage.Workers < 0 || stage.Rate < 0 {
+			return nil, errors.Errorf("stage %d has a negative target", i)
+		}
+		if openLoop && stage.Workers > 0 {
+			return nil, errors.Errorf("stage %d sets workers but the profile uses an arrival rate", i)
+		}
+	}
+
+	if openLoop && config.NumWorkers <= 0 {
+		return nil, errors.New("an arrival rate needs at least one worker to send requests")
+	}
+
+	return &loadProfile{
+		stages:   stages,
+		openLoop: openLoop,
+	}, nil
+}
+
+func defaultStages(config *TestConfig) []Stage {
+	if config.ArrivalRate > 0 {
+		return []Stage{{
+			Name:     "steady",
+			Duration: config.TestDuration,
+			Rate:     config.ArrivalRate,
+		}}
+	}
+
+	stages := make([]Stage, 0, 3)
+	if config.RampUpDuration > 0 && config.NumWorkers > 1 {
+		stages = append(stages,
+			Stage{
+				Name:    "start",
+				Workers: 1,
+			},
+			Stage{
+				Name:     "ramp up",
+				Duration: config.RampUpDuration * time.Duration(config.NumWorkers-1),
+				Workers:  config.NumWorkers,
+				Ramp:     true,
+			})
+	}
+
+	return append(stages, Stage{
+		Name:     "steady",
+		Duration: config.TestDuration,
+		Workers:  config.NumWorkers,
+	})
+}
+
+func (p *loadProfile) duration() time.Duration {
+	var total time.Duration
+	for _, stage := range p.stages {
+		total += stage.Duration
+	}
+	return total
+}
+
+func (p *loadProfile) maxLevel() loadLevel {
+	max := loadLevel{}
+	for _, stage := range p.stages {
+		if stage.Workers > max.workers {
+			max.workers = stage.Workers
+		}
+		if stage.Rate > max.rate {
+			max.rate = stage.Rate
+		}
+	}
+	return max
+}
+
+// stageStart returns how long after the start of the profile stage i starts.
+func (p *loadProfile) stageStart(i int) time.Duration {
+	var start time.Duration
+	for _, stage := range p.stages[:i] {
+		start += stage.Duration
+	}
+	return start
+}
+
+// levelAt returns the load at elapsed, or false once every stage is over.
+func (p *loadProfile) levelAt(elapsed time.Duration) (loadLevel, bool) {
+	previous := loadLevel{}
+	var stageStart time.Duration
+
+	for i, stage := range p.stages {
+		stageEnd := stageStart + stage.Duration
+		if elapsed >= stageEnd {
+			previous = loadLevel{stageIndex: i, workers: stage.Workers, rate: stage.Rate}
+			stageStart = stageEnd
+			continue
+		}
+
+		level := loadLevel{
+			stageIndex: i,
+			workers:    stage.Workers,
+			rate:       stage.Rate,
+		}
+		if stage.Ramp {
+			fraction := float64(elapsed-stageStart) / float64(stage.Duration)
+			level.workers = previous.workers + int(math.Floor(float64(stage.Workers-previous.workers)*fraction))
+			level.rate = previous.rate + (stage.Rate-previous.rate)*fraction
+		}
+		return level, true
+	}
+
+	return loadLevel{}, false
+}
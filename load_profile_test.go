@@ -0,0 +1,131 @@
+package webservice_benchmarks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStage(t *testing.T) {
+	stage, err := ParseStage("1m:10")
+	require.NoError(t, err)
+	require.Equal(t, Stage{Duration: time.Minute, Workers: 10}, stage)
+
+	stage, err = ParseStage("warmup=5m:200:ramp")
+	require.NoError(t, err)
+	require.Equal(t, Stage{Name: "warmup", Duration: time.Minute * 5, Workers: 200, Ramp: true}, stage)
+
+	stage, err = ParseStage("30s:12.5/s")
+	require.NoError(t, err)
+	require.Equal(t, Stage{Duration: time.Second * 30, Rate: 12.5}, stage)
+
+	for _, s := range []string{"1m0s:10", "warmup=5m0s:200:ramp", "30s:12.5/s"} {
+		stage, err = ParseStage(s)
+		require.NoError(t, err)
+		require.Equal(t, s, stage.String())
+	}
+
+	for _, s := range []string{"", "1m", "1m:10:ramp:x", "x:10", "1m:x", "1m:x/s", "1m:10:slow"} {
+		_, err = ParseStage(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestLoadProfileLevelAt(t *testing.T) {
+	profile, err := newLoadProfile(&TestConfig{
+		Stages: []Stage{
+			{Duration: time.Minute, Workers: 10},
+			{Duration: time.Minute * 5, Workers: 200, Ramp: true},
+			{Duration: time.Minute, Workers: 200},
+			{Duration: time.Minute, Workers: 50},
+			{Duration: time.Second * 10, Workers: 500},
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, profile.openLoop)
+	require.Equal(t, time.Minute*8+time.Second*10, profile.duration())
+	require.Equal(t, 500, profile.maxLevel().workers)
+
+	cases := []struct {
+		elapsed    time.Duration
+		stageIndex int
+		workers    int
+	}{
+		{0, 0, 10},
+		{time.Second * 59, 0, 10},
+		{time.Minute, 1, 10},
+		{time.Minute + time.Second*150, 1, 105},
+		{time.Minute * 6, 2, 200},
+		{time.Minute * 7, 3, 50},
+		{time.Minute * 8, 4, 500},
+	}
+	for _, c := range cases {
+		level, ok := profile.levelAt(c.elapsed)
+		require.True(t, ok, c.elapsed)
+		require.Equal(t, c.stageIndex, level.stageIndex, c.elapsed)
+		require.Equal(t, c.workers, level.workers, c.elapsed)
+	}
+
+	_, ok := profile.levelAt(time.Minute*8 + time.Second*10)
+	require.False(t, ok)
+}
+
+func TestLoadProfileRampDown(t *testing.T) {
+	profile, err := newLoadProfile(&TestConfig{
+		NumWorkers: 20,
+		Stages: []Stage{
+			{Duration: time.Minute, Rate: 100},
+			{Duration: time.Minute, Rate: 0, Ramp: true},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, profile.openLoop)
+
+	level, ok := profile.levelAt(time.Minute + time.Second*15)
+	require.True(t, ok)
+	require.InDelta(t, 75, level.rate, 0.001)
+}
+
+func TestLoadProfileDefaultStages(t *testing.T) {
+	profile, err := newLoadProfile(&TestConfig{
+		NumWorkers:     4,
+		RampUpDuration: time.Second,
+		TestDuration:   time.Minute,
+	})
+	require.NoError(t, err)
+	require.Equal(t, time.Minute+time.Second*3, profile.duration())
+
+	for i := 0; i < 4; i++ {
+		level, ok := profile.levelAt(time.Second * time.Duration(i))
+		require.True(t, ok)
+		require.Equal(t, i+1, level.workers)
+	}
+
+	profile, err = newLoadProfile(&TestConfig{
+		NumWorkers:   4,
+		ArrivalRate:  50,
+		TestDuration: time.Minute,
+	})
+	require.NoError(t, err)
+	require.True(t, profile.openLoop)
+	level, ok := profile.levelAt(0)
+	require.True(t, ok)
+	require.Equal(t, 50.0, level.rate)
+}
+
+func TestLoadProfileInvalid(t *testing.T) {
+	_, err := newLoadProfile(&TestConfig{
+		NumWorkers: 4,
+		Stages: []Stage{
+			{Duration: time.Minute, Rate: 100},
+			{Duration: time.Minute, Workers: 10},
+		},
+	})
+	require.Error(t, err)
+
+	_, err = newLoadProfile(&TestConfig{
+		Stages: []Stage{{Duration: time.Minute, Rate: 100}},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,98 @@
+package webservice_benchmarks
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+)
+
+const progressTopErrors = 3
+
+// progressReporter logs a summary of the requests of the last interval during a run.
+type progressReporter struct {
+	interval time.Duration
+	window   *rollingWindow
+	sender   *requestSender
+	db       *sqlite.DataStore
+	run      *sqlite.Run
+}
+
+func (p *progressReporter) report(stopReciever *util.StopReciever) {
+	defer stopReciever.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopReciever.ShouldStopC:
+			return
+		}
+
+		now := time.Now().UTC()
+		log.Println(p.line(now, p.window.stats(now)))
+	}
+}
+
+// line formats a progress line like
+//
+//	progress 1m5s: 10 workers, 10 in flight | 1523.4 req/s, 99.87% success | p50 3ms, p90 7ms, p99 21ms | errors: timeout 3, eof 1 | queue 12
+func (p *progressReporter) line(now time.Time, stats *windowStats) string {
+	parts := []string{
+		fmt.Sprintf("progress %v: %d workers, %d in flight",
+			now.Sub(p.run.StartTime).Round(time.Second),
+			atomic.LoadInt64(&p.sender.workers),
+			atomic.LoadInt64(&p.sender.inFlight)),
+	}
+
+	if stats.Requests == 0 {
+		parts = append(parts, "no requests ended")
+	} else {
+		parts = append(parts,
+			fmt.Sprintf("%.1f req/s, %.2f%% success",
+				stats.Rate,
+				(1-stats.ErrorRate)*100),
+			fmt.Sprintf("p50 %v, p90 %v, p99 %v",
+				stats.P50.Round(time.Millisecond),
+				stats.P90.Round(time.Millisecond),
+				stats.P99.Round(time.Millisecond)))
+	}
+
+	if len(stats.ErrorCategories) > 0 {
+		parts = append(parts, "errors: "+topErrorCategories(stats.ErrorCategories, progressTopErrors))
+	}
+
+	parts = append(parts, fmt.Sprintf("queue %d", p.db.QueueDepth()))
+	return strings.Join(parts, " | ")
+}
+
+// topErrorCategories lists the n most common error categories with their counts.
+func topErrorCategories(counts map[string]int, n int) string {
+	categories := make([]string, 0, len(counts))
+	for category := range counts {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if counts[categories[i]] != counts[categories[j]] {
+			return counts[categories[i]] > counts[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+
+	top := make([]string, 0, n)
+	for i, category := range categories {
+		if i == n {
+			top = append(top, fmt.Sprintf("%d more", len(categories)-n))
+			break
+		}
+		top = append(top, fmt.Sprintf("%s %d", category, counts[category]))
+	}
+	return strings.Join(top, ", ")
+}
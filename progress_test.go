@@ -0,0 +1,51 @@
+package webservice_benchmarks
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressLine(t *testing.T) {
+	data, err := sqlite.NewDataStore(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer data.Close()
+
+	now := time.Unix(1000, 0)
+	p := &progressReporter{
+		interval: time.Second * 5,
+		window:   newRollingWindow(time.Second * 5),
+		sender:   &requestSender{workers: 4, inFlight: 3},
+		db:       data,
+		run:      &sqlite.Run{StartTime: now.Add(-time.Second * 65)},
+	}
+
+	require.Equal(t,
+		"progress 1m5s: 4 workers, 3 in flight | no requests ended | queue 0",
+		p.line(now, p.window.stats(now)))
+
+	for i := 0; i < 96; i++ {
+		p.window.add(now.Add(-time.Millisecond*20), now, true, "")
+	}
+	for i, category := range []string{"timeout", "timeout", "eof", "connection_refused"} {
+		p.window.add(now.Add(-time.Second-time.Duration(i)*time.Millisecond), now, false, category)
+	}
+
+	require.Equal(t,
+		"progress 1m5s: 4 workers, 3 in flight | 20.0 req/s, 96.00% success | p50 20ms, p90 20ms, p99 1.002s | errors: timeout 2, connection_refused 1, eof 1 | queue 0",
+		p.line(now, p.window.stats(now)))
+}
+
+func TestTopErrorCategories(t *testing.T) {
+	counts := map[string]int{
+		"timeout":            5,
+		"eof":                7,
+		"connection_refused": 5,
+		"other":              1,
+	}
+	require.Equal(t, "eof 7, connection_refused 5, timeout 5, 1 more", topErrorCategories(counts, 3))
+	require.Equal(t, "eof 7", topErrorCategories(map[string]int{"eof": 7}, 3))
+}
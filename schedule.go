@@ -0,0 +1,82 @@
+package webservice_benchmarks
+
+import (
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+// fixedScheduler produces intended send times at fixed offsets from the start of the run.
+type fixedScheduler struct {
+	offsets        []time.Duration
+	intendedStarts chan time.Time
+	done           chan struct{}
+	stopSender     *util.StopSender
+}
+
+func newFixedScheduler(offsets []time.Duration) *fixedScheduler {
+	return &fixedScheduler{
+		offsets:        offsets,
+		intendedStarts: make(chan time.Time),
+		done:           make(chan struct{}),
+		stopSender:     util.NewStopSender(),
+	}
+}
+
+func (s *fixedScheduler) start(runStart time.Time) {
+	go s.schedule(s.stopSender.NewReciever(), runStart)
+}
+
+func (s *fixedScheduler) stopAndWait() {
+	s.stopSender.StopAndWait()
+}
+
+func (s *fixedScheduler) schedule(stopReciever *util.StopReciever, runStart time.Time) {
+	defer stopReciever.Done()
+	defer close(s.done)
+
+	for _, offset := range s.offsets {
+		next := runStart.Add(offset)
+
+		wait := time.Until(next)
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-stopReciever.ShouldStopC:
+				timer.Stop()
+				return
+			}
+		}
+
+		select {
+		case s.intendedStarts <- next:
+		case <-stopReciever.ShouldStopC:
+			return
+		}
+	}
+}
+
+func scheduleRate(offsets []time.Duration) float64 {
+	if len(offsets) == 0 {
+		return 0
+	}
+	last := offsets[len(offsets)-1]
+	if last <= 0 {
+		return 0
+	}
+	return float64(len(offsets)) / last.Seconds()
+}
+
+func validateSchedule(offsets []time.Duration) error {
+	for i, offset := range offsets {
+		if offset < 0 {
+			return errors.Errorf("schedule offset %d is negative", i)
+		}
+		if i > 0 && offset < offsets[i-1] {
+			return errors.Errorf("schedule offset %d is before the one preceding it", i)
+		}
+	}
+	return nil
+}
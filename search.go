@@ -0,0 +1,343 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+// Search strategies.
+const (
+	// SearchStep raises the load by Step until a probe fails.
+	SearchStep = "step"
+	// SearchBisect probes Start and Max, then halves the range between the
+	// highest passing and lowest failing load until it is within Resolution.
+	SearchBisect = "bisect"
+)
+
+// SLO is what a probe has to meet; zero values disable a check.
+type SLO struct {
+	MaxP99       time.Duration
+	MaxErrorRate float64
+	// MinThroughputGain detects a throughput plateau. Compared to the highest
+	// passing load below it, a probe's throughput has to grow by at least
+	// this fraction of the growth in load, e.g. 0.5 fails a probe with 20%
+	// more load and less than 10% more throughput.
+	MinThroughputGain float64
+}
+
+type SearchConfig struct {
+	// Probe is the configuration every probe's run starts from. Each probe
+	// gets a new RunID and its load replaces NumWorkers, or ArrivalRate when
+	// ByRate is set.
+	Probe    TestConfig
+	SearchID string
+	Desc     string
+	ByRate   bool
+	Strategy string
+
+	Start      float64
+	Step       float64
+	Max        float64
+	Resolution float64
+
+	// Cooldown is how long to wait between probes.
+	Cooldown time.Duration
+	SLO      SLO
+}
+
+type SearchResult struct {
+	SearchID string
+	// Found is false when not even the first probe met the SLO.
+	Found              bool
+	MaxSustainableLoad float64
+	Probes             []*Probe
+}
+
+type Probe struct {
+	RunID  string
+	Load   float64
+	Passed bool
+	Reason string
+	Stats  *sqlite.RunStats
+}
+
+// SearchBreakingPoint runs probes of increasing load and returns the highest that passed the SLO.
+func SearchBreakingPoint(ctx context.Context, config *SearchConfig, f SendRequestFunc) (result *SearchResult, err error) {
+	err = validateSearchConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	// Stopping the search shouldn't stop how it ended from being saved.
+	writeCtx := context.WithoutCancel(ctx)
+
+	data, err := sqlite.NewDataStore(config.Probe.DBFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	err = data.CreateTables(writeCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = data.WriteExperimentStart(writeCtx, &sqlite.AddExperimentParams{
+		ID:        config.SearchID,
+		Kind:      sqlite.ExperimentKindSearch,
+		StartTime: time.Now().UTC(),
+		Desc:      config.Desc,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &search{
+		config: config,
+		data:   data,
+		f:      f,
+		result: &SearchResult{
+			SearchID: config.SearchID,
+		},
+	}
+
+	defer func() {
+		end := experimentEnd(ctx, config.SearchID, err)
+		if err == nil && s.result.Found {
+			end.ResultLoad = &s.result.MaxSustainableLoad
+		}
+		endErr := data.WriteExperimentEnd(writeCtx, end)
+		if err == nil && endErr != nil {
+			result, err = nil, endErr
+		}
+	}()
+
+	if config.Strategy == SearchBisect {
+		err = s.bisect(ctx)
+	} else {
+		err = s.step(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.result, nil
+}
+
+// experimentEnd is how the search or sweep experimentID ended, given its error.
+func experimentEnd(ctx context.Context, experimentID string, err error) *sqlite.ExperimentEndParams {
+	end := &sqlite.ExperimentEndParams{
+		ID:      experimentID,
+		EndTime: time.Now().UTC(),
+		Status:  sqlite.RunStatusCompleted,
+	}
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		end.Status = sqlite.RunStatusAborted
+		end.Error = context.Cause(ctx).Error()
+	default:
+		end.Status = sqlite.RunStatusFailed
+		end.Error = err.Error()
+	}
+	return end
+}
+
+func validateSearchConfig(config *SearchConfig) error {
+	switch {
+	case config.Strategy != SearchStep && config.Strategy != SearchBisect:
+		return errors.Errorf("unknown search strategy %q", config.Strategy)
+	case config.Start <= 0:
+		return errors.New("search start load should be positive")
+	case config.Max < config.Start:
+		return errors.New("search max load should be at least the start load")
+	case config.Strategy == SearchStep && config.Step <= 0:
+		return errors.New("search step should be positive")
+	case config.SLO.MaxP99 <= 0 && config.SLO.MaxErrorRate <= 0 && config.SLO.MinThroughputGain <= 0:
+		return errors.New("search needs at least one SLO")
+	case config.Probe.Controller != nil:
+		return errors.New("search probes fixed loads, so it can't use the controller")
+	case len(config.Probe.Schedule) > 0:
+		return errors.New("a replayed log is used up by the first probe, so a search can't replay one")
+	}
+	return nil
+}
+
+type search struct {
+	config *SearchConfig
+	data   *sqlite.DataStore
+	f      SendRequestFunc
+	result *SearchResult
+}
+
+func (s *search) step(ctx context.Context) error {
+	for load := s.config.Start; load <= s.config.Max; load += s.config.Step {
+		probe, err := s.probe(ctx, load)
+		if err != nil {
+			return err
+		}
+		if !probe.Passed {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *search) bisect(ctx context.Context) error {
+	lo, err := s.probe(ctx, s.config.Start)
+	if err != nil || !lo.Passed {
+		return err
+	}
+
+	hi, err := s.probe(ctx, s.config.Max)
+	if err != nil || hi.Passed {
+		return err
+	}
+
+	resolution := s.config.Resolution
+	if !s.config.ByRate && resolution < 1 {
+		resolution = 1
+	}
+
+	for hi.Load-lo.Load > resolution {
+		mid := s.roundLoad((lo.Load + hi.Load) / 2)
+		if mid <= lo.Load || mid >= hi.Load {
+			return nil
+		}
+
+		probe, err := s.probe(ctx, mid)
+		if err != nil {
+			return err
+		}
+
+		if probe.Passed {
+			lo = probe
+		} else {
+			hi = probe
+		}
+	}
+
+	return nil
+}
+
+func (s *search) roundLoad(load float64) float64 {
+	if s.config.ByRate {
+		return load
+	}
+	return math.Floor(load)
+}
+
+func (s *search) probe(ctx context.Context, load float64) (*Probe, error) {
+	load = s.roundLoad(load)
+	probeIndex := len(s.result.Probes)
+
+	if probeIndex > 0 {
+		err := cooldown(ctx, s.config.Cooldown)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config := s.config.Probe
+	config.RunID = util.NewID()
+	config.ExperimentID = s.config.SearchID
+	config.Stages = nil
+	if s.config.ByRate {
+		config.ArrivalRate = load
+		config.Desc = fmt.Sprintf("search probe %d: %v requests/s", probeIndex, load)
+	} else {
+		config.NumWorkers = int(load)
+		config.ArrivalRate = 0
+		config.Desc = fmt.Sprintf("search probe %d: %v workers", probeIndex, load)
+	}
+
+	log.Println(config.Desc)
+	// A probe stopped by an abort rule failed, and the search goes on.
+	err := GenerateLoad(ctx, &config, s.f)
+	abortErr, aborted := errors.Cause(err).(*AbortError)
+	if err != nil && (!aborted || abortErr.Rule == "") {
+		return nil, err
+	}
+
+	stats, err := s.data.GetRunStats(ctx, config.RunID)
+	if err != nil {
+		return nil, err
+	}
+
+	probe := &Probe{
+		RunID: config.RunID,
+		Load:  load,
+		Stats: stats,
+	}
+	if aborted {
+		probe.Reason = "aborted: " + abortErr.Reason
+	} else {
+		probe.Passed, probe.Reason = s.config.SLO.check(probe, s.highestPassingProbeBelow(load))
+	}
+	log.Println(fmt.Sprintf("search probe %d: load %v, passed %v, %s", probeIndex, load, probe.Passed, probe.Reason))
+
+	err = s.data.WriteSearchProbe(ctx, &sqlite.AddSearchProbeParams{
+		ExperimentID: s.config.SearchID,
+		RunID:        probe.RunID,
+		ProbeIndex:   probeIndex,
+		Load:         probe.Load,
+		Passed:       probe.Passed,
+		Reason:       probe.Reason,
+		Stats:        probe.Stats,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.result.Probes = append(s.result.Probes, probe)
+	if probe.Passed && (!s.result.Found || load > s.result.MaxSustainableLoad) {
+		s.result.Found = true
+		s.result.MaxSustainableLoad = load
+	}
+
+	return probe, nil
+}
+
+func (s *search) highestPassingProbeBelow(load float64) *Probe {
+	var highest *Probe
+	for _, probe := range s.result.Probes {
+		if probe.Passed && probe.Load < load && (highest == nil || probe.Load > highest.Load) {
+			highest = probe
+		}
+	}
+	return highest
+}
+
+// check returns whether the probe met the SLO, compared to baseline, and why.
+func (slo *SLO) check(probe *Probe, baseline *Probe) (bool, string) {
+	stats := probe.Stats
+	if stats.Requests == 0 {
+		return false, "no requests completed"
+	}
+
+	if slo.MaxErrorRate > 0 && stats.ErrorRate > slo.MaxErrorRate {
+		return false, fmt.Sprintf("error rate %.2f%% is above %.2f%%", stats.ErrorRate*100, slo.MaxErrorRate*100)
+	}
+
+	if slo.MaxP99 > 0 && stats.P99 > slo.MaxP99 {
+		return false, fmt.Sprintf("p99 latency %v is above %v", stats.P99, slo.MaxP99)
+	}
+
+	if slo.MinThroughputGain > 0 && baseline != nil && baseline.Stats.Throughput > 0 {
+		loadGain := probe.Load/baseline.Load - 1
+		throughputGain := stats.Throughput/baseline.Stats.Throughput - 1
+		if throughputGain < loadGain*slo.MinThroughputGain {
+			return false, fmt.Sprintf(
+				"throughput plateaued - %.1f/s is %.1f%% more than at load %v for %.1f%% more load",
+				stats.Throughput, throughputGain*100, baseline.Load, loadGain*100)
+		}
+	}
+
+	return true, fmt.Sprintf("p99 %v, error rate %.2f%%, throughput %.1f/s", stats.P99, stats.ErrorRate*100, stats.Throughput)
+}
@@ -0,0 +1,150 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func failFromWorker(n int) SendRequestFunc {
+	return func(_ context.Context, workerID int) (*RequestResult, error) {
+		time.Sleep(time.Millisecond)
+		if workerID >= n {
+			return &RequestResult{StatusCode: 503}, errors.New("overloaded")
+		}
+		return &RequestResult{StatusCode: 200}, nil
+	}
+}
+
+func newTestSearchConfig(t *testing.T, strategy string) *SearchConfig {
+	return &SearchConfig{
+		Probe: TestConfig{
+			DBFilePath:   filepath.Join(t.TempDir(), "search.db"),
+			TestDuration: time.Millisecond * 300,
+		},
+		SearchID: util.NewID(),
+		Strategy: strategy,
+		Start:    1,
+		Step:     1,
+		Max:      8,
+		SLO: SLO{
+			MaxErrorRate: 0.01,
+		},
+	}
+}
+
+func TestSearchBreakingPointStep(t *testing.T) {
+	config := newTestSearchConfig(t, SearchStep)
+
+	result, err := SearchBreakingPoint(context.Background(), config, failFromWorker(3))
+	require.NoError(t, err)
+	require.True(t, result.Found)
+	require.Equal(t, 3.0, result.MaxSustainableLoad)
+	require.Len(t, result.Probes, 4)
+	require.False(t, result.Probes[3].Passed)
+	require.Equal(t, 4.0, result.Probes[3].Load)
+
+	status := getTestExperimentStatus(t, config.Probe.DBFilePath, config.SearchID)
+	require.Equal(t, sqlite.RunStatusCompleted, status.Status)
+	require.Empty(t, status.Error)
+}
+
+func TestSearchBreakingPointBisect(t *testing.T) {
+	config := newTestSearchConfig(t, SearchBisect)
+
+	result, err := SearchBreakingPoint(context.Background(), config, failFromWorker(3))
+	require.NoError(t, err)
+	require.True(t, result.Found)
+	require.Equal(t, 3.0, result.MaxSustainableLoad)
+
+	loads := make([]float64, 0, len(result.Probes))
+	for _, probe := range result.Probes {
+		loads = append(loads, probe.Load)
+	}
+	require.Equal(t, []float64{1, 8, 4, 2, 3}, loads)
+}
+
+func TestSearchBreakingPointNothingPasses(t *testing.T) {
+	config := newTestSearchConfig(t, SearchStep)
+
+	result, err := SearchBreakingPoint(context.Background(), config, failFromWorker(0))
+	require.NoError(t, err)
+	require.False(t, result.Found)
+	require.Len(t, result.Probes, 1)
+}
+
+func TestSearchBreakingPointReplay(t *testing.T) {
+	config := newTestSearchConfig(t, SearchStep)
+	config.Probe.Schedule = []time.Duration{0, time.Second}
+
+	_, err := SearchBreakingPoint(context.Background(), config, failFromWorker(3))
+	require.EqualError(t, err, "a replayed log is used up by the first probe, so a search can't replay one")
+}
+
+func getTestExperimentStatus(t *testing.T, dbFilePath, experimentID string) *sqlite.ExperimentStatus {
+	data, err := sqlite.NewDataStore(dbFilePath)
+	require.NoError(t, err)
+	defer data.Close()
+
+	status, err := data.GetExperimentStatus(context.Background(), experimentID)
+	require.NoError(t, err)
+	return status
+}
+
+func TestSearchBreakingPointCancelled(t *testing.T) {
+	config := newTestSearchConfig(t, SearchStep)
+	config.Probe.TestDuration = time.Second * 30
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(time.Millisecond*100, func() {
+		cancel(errors.New("received signal interrupt"))
+	})
+
+	_, err := SearchBreakingPoint(ctx, config, failFromWorker(3))
+	_, ok := errors.Cause(err).(*AbortError)
+	require.True(t, ok, "%v", err)
+
+	status := getTestExperimentStatus(t, config.Probe.DBFilePath, config.SearchID)
+	require.Equal(t, sqlite.RunStatusAborted, status.Status)
+	require.Equal(t, "received signal interrupt", status.Error)
+	require.NotNil(t, status.EndTime)
+}
+
+func TestSLOCheck(t *testing.T) {
+	slo := &SLO{
+		MaxP99:            time.Millisecond * 500,
+		MaxErrorRate:      0.05,
+		MinThroughputGain: 0.5,
+	}
+	baseline := &Probe{
+		Load:  100,
+		Stats: &sqlite.RunStats{Requests: 1000, Throughput: 100},
+	}
+
+	passed, _ := slo.check(&Probe{Load: 120, Stats: &sqlite.RunStats{Requests: 1000, P99: time.Millisecond * 100, Throughput: 115}}, baseline)
+	require.True(t, passed)
+
+	passed, reason := slo.check(&Probe{Load: 120, Stats: &sqlite.RunStats{Requests: 1000, P99: time.Second}}, baseline)
+	require.False(t, passed)
+	require.Contains(t, reason, "p99")
+
+	passed, reason = slo.check(&Probe{Load: 120, Stats: &sqlite.RunStats{Requests: 1000, ErrorRate: 0.1}}, baseline)
+	require.False(t, passed)
+	require.Contains(t, reason, "error rate")
+
+	passed, reason = slo.check(&Probe{Load: 120, Stats: &sqlite.RunStats{Requests: 1000, Throughput: 105}}, baseline)
+	require.False(t, passed)
+	require.Contains(t, reason, "plateau")
+
+	passed, _ = slo.check(&Probe{Load: 120, Stats: &sqlite.RunStats{Requests: 1000, Throughput: 105}}, nil)
+	require.True(t, passed)
+
+	passed, _ = slo.check(&Probe{Load: 120, Stats: &sqlite.RunStats{}}, nil)
+	require.False(t, passed)
+}
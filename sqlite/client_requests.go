@@ -9,12 +9,92 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Request outcomes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	// OutcomeTimeout is a request that hit its per-request deadline.
+	OutcomeTimeout = "timeout"
+	// OutcomeCancelled is a request that was still in flight when the run
+	// was shut down.
+	OutcomeCancelled = "cancelled"
+	// OutcomeAssertionFailed is a request whose response failed a check,
+	// as opposed to a request that got no response.
+	OutcomeAssertionFailed = "assertion_failed"
+)
+
+// Error categories of failed requests.
+const (
+	ErrorCategoryTimeout           = "timeout"
+	ErrorCategoryCancelled         = "cancelled"
+	ErrorCategoryConnectionRefused = "connection_refused"
+	ErrorCategoryConnectionReset   = "connection_reset"
+	// ErrorCategoryAddressExhausted is a dial that found no free local
+	// address or port to connect from.
+	ErrorCategoryAddressExhausted = "address_exhausted"
+	ErrorCategoryEOF              = "eof"
+	ErrorCategoryDNS              = "dns_failure"
+	ErrorCategoryTLS              = "tls_failure"
+	ErrorCategoryHTTP4xx          = "http_4xx"
+	ErrorCategoryHTTP5xx          = "http_5xx"
+	// ErrorCategoryBodyRead is a response whose body couldn't be read
+	// after its status was received.
+	ErrorCategoryBodyRead        = "body_read_failure"
+	ErrorCategoryAssertionFailed = "assertion_failed"
+	ErrorCategoryOther           = "other"
+)
+
+// Validation outcomes.
+const (
+	ValidationNone   = "none"
+	ValidationPassed = "passed"
+	ValidationFailed = "failed"
+)
+
 type AddRequestParams struct {
-	WorkerID  int
-	StartTime time.Time
-	EndTime   time.Time
-	Success   bool
-	Error     string
+	WorkerID int
+	// IntendedStartTime is when the request was scheduled to be sent. If it
+	// is not set, the request is treated as having been sent on time.
+	IntendedStartTime time.Time
+	StartTime         time.Time
+	EndTime           time.Time
+	Success           bool
+	// Outcome is one of the Outcome constants. If it is not set, it is
+	// OutcomeSuccess or OutcomeError depending on Success.
+	Outcome string
+	Error   string
+
+	// StatusCode is 0 when no response was received.
+	StatusCode    int
+	BytesSent     int64
+	BytesReceived int64
+	// Validation is one of the Validation constants. If it is not set, it is
+	// ValidationNone.
+	Validation string
+	Label      string
+	// RequestName is the name of the request or journey step in the request
+	// mix.
+	RequestName string
+	// FailedAssertion is the name of the check that the response failed,
+	// for requests with OutcomeAssertionFailed.
+	FailedAssertion string
+	// ErrorCategory is one of the ErrorCategory constants for failed
+	// requests.
+	ErrorCategory string
+
+	DNS             time.Duration
+	Connect         time.Duration
+	TLSHandshake    time.Duration
+	TimeToFirstByte time.Duration
+	BodyRead        time.Duration
+	ConnReused      bool
+	LocalPort       int
+	// Protocol is the protocol the response came back over, e.g. HTTP/1.1
+	// or HTTP/2.0. It is empty when no response was received.
+	Protocol string
+	// GRPCStatus is the name of the status of a gRPC call, e.g. OK. It is
+	// empty for plain HTTP requests and calls that got no status.
+	GRPCStatus string
 }
 
 func createClientRequestsTable(ctx context.Context, tx *sql.Tx) error {
@@ -23,6 +103,7 @@ func createClientRequestsTable(ctx context.Context, tx *sql.Tx) error {
 		id 				TEXT 		PRIMARY KEY,
 		run_id			TEXT		NOT NULL,
 		worker_id 		INTEGER		NOT NULL,
+		intended_start_time	DATETIME	NOT NULL,
 		start_time		DATETIME	NOT NULL,
 		end_time		DATETIME	NOT NULL,
 	
@@ -30,8 +111,29 @@ func createClientRequestsTable(ctx context.Context, tx *sql.Tx) error {
 		ms_since_start	INTEGER 	NOT NULL,
 	
 		duration_ms		INTEGER		NOT NULL,
+		queue_delay_ms	INTEGER		NOT NULL,
 		success			INTEGER		NOT NULL,
-		error			TEXT		NOT NULL
+		outcome			TEXT		NOT NULL,
+		error			TEXT		NOT NULL,
+		error_category	TEXT		NOT NULL,
+
+		status_code		INTEGER		NOT NULL,
+		bytes_sent		INTEGER		NOT NULL,
+		bytes_received	INTEGER		NOT NULL,
+		validation		TEXT		NOT NULL,
+		label			TEXT		NOT NULL,
+		request_name	TEXT		NOT NULL,
+		failed_assertion	TEXT	NOT NULL,
+
+		dns_ms			REAL		NOT NULL,
+		connect_ms		REAL		NOT NULL,
+		tls_ms			REAL		NOT NULL,
+		ttfb_ms			REAL		NOT NULL,
+		body_read_ms	REAL		NOT NULL,
+		conn_reused		INTEGER		NOT NULL,
+		local_port		INTEGER		NOT NULL,
+		protocol		TEXT		NOT NULL,
+		grpc_status		TEXT		NOT NULL
 	);`
 
 	_, err := tx.ExecContext(ctx, query)
@@ -39,29 +141,82 @@ func createClientRequestsTable(ctx context.Context, tx *sql.Tx) error {
 		return errors.Wrap(err, "creating client_requests table failed")
 	}
 
+	query = `
+		CREATE INDEX IF NOT EXISTS client_requests_error_category
+		ON client_requests (run_id, error_category);`
+
+	_, err = tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "creating client_requests error_category index failed")
+	}
+
 	return nil
 }
 
 func insertIntoClientRequests(ctx context.Context, tx *sql.Tx, run *Run, params *AddRequestParams) error {
 	query := `
 		INSERT INTO client_requests (
-			id, run_id, worker_id, start_time, end_time, s_since_start, ms_since_start,
-			duration_ms, success, error)		
+			id, run_id, worker_id, intended_start_time, start_time, end_time,
+			s_since_start, ms_since_start, duration_ms, queue_delay_ms, success, outcome, error, error_category,
+			status_code, bytes_sent, bytes_received, validation, label, request_name, failed_assertion,
+			dns_ms, connect_ms, tls_ms, ttfb_ms, body_read_ms, conn_reused, local_port, protocol, grpc_status)
 		VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14,
+			$15, $16, $17, $18, $19, $20, $21,
+			$22, $23, $24, $25, $26, $27, $28, $29, $30
 		);`
 
+	intendedStartTime := params.IntendedStartTime
+	if intendedStartTime.IsZero() {
+		intendedStartTime = params.StartTime
+	}
+
+	outcome := params.Outcome
+	if outcome == "" {
+		outcome = OutcomeError
+		if params.Success {
+			outcome = OutcomeSuccess
+		}
+	}
+
+	validation := params.Validation
+	if validation == "" {
+		validation = ValidationNone
+	}
+
 	args := []interface{}{
 		util.NewID(),
 		run.ID,
 		params.WorkerID,
+		intendedStartTime,
 		params.StartTime,
 		params.EndTime,
 		run.secondsSinceStart(params.StartTime),
 		run.millisecondsSinceStart(params.StartTime),
 		params.EndTime.Sub(params.StartTime) / time.Millisecond,
+		params.StartTime.Sub(intendedStartTime) / time.Millisecond,
 		params.Success,
+		outcome,
 		params.Error,
+		params.ErrorCategory,
+
+		params.StatusCode,
+		params.BytesSent,
+		params.BytesReceived,
+		validation,
+		params.Label,
+		params.RequestName,
+		params.FailedAssertion,
+
+		milliseconds(params.DNS),
+		milliseconds(params.Connect),
+		milliseconds(params.TLSHandshake),
+		milliseconds(params.TimeToFirstByte),
+		milliseconds(params.BodyRead),
+		params.ConnReused,
+		params.LocalPort,
+		params.Protocol,
+		params.GRPCStatus,
 	}
 
 	_, err := tx.ExecContext(ctx, query, args...)
@@ -76,20 +231,42 @@ type clientRequest struct {
 	id                     string
 	runID                  string
 	workerID               int
+	intendedStartTime      time.Time
 	startTime              time.Time
 	endTime                time.Time
 	secondsSinceStart      int
 	millisecondsSinceStart int
 	durationMs             int
+	queueDelayMs           int
 	success                bool
+	outcome                string
 	errMessage             string
+	errorCategory          string
+	statusCode             int
+	bytesSent              int64
+	bytesReceived          int64
+	validation             string
+	label                  string
+	requestName            string
+	failedAssertion        string
+	dnsMs                  float64
+	connectMs              float64
+	tlsMs                  float64
+	ttfbMs                 float64
+	bodyReadMs             float64
+	connReused             bool
+	localPort              int
+	protocol               string
+	grpcStatus             string
 }
 
 func getClientRequests(ctx context.Context, db *sql.DB) ([]*clientRequest, error) {
 	query := `
 		SELECT 
-			id, run_id, worker_id, start_time, end_time, s_since_start, 
-			ms_since_start, duration_ms, success, error
+			id, run_id, worker_id, intended_start_time, start_time, end_time,
+			s_since_start, ms_since_start, duration_ms, queue_delay_ms, success, outcome, error, error_category,
+			status_code, bytes_sent, bytes_received, validation, label, request_name, failed_assertion,
+			dns_ms, connect_ms, tls_ms, ttfb_ms, body_read_ms, conn_reused, local_port, protocol, grpc_status
 		FROM client_requests;`
 	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
@@ -105,13 +282,33 @@ func getClientRequests(ctx context.Context, db *sql.DB) ([]*clientRequest, error
 			&r.id,
 			&r.runID,
 			&r.workerID,
+			&r.intendedStartTime,
 			&r.startTime,
 			&r.endTime,
 			&r.secondsSinceStart,
 			&r.millisecondsSinceStart,
 			&r.durationMs,
+			&r.queueDelayMs,
 			&r.success,
-			&r.errMessage)
+			&r.outcome,
+			&r.errMessage,
+			&r.errorCategory,
+			&r.statusCode,
+			&r.bytesSent,
+			&r.bytesReceived,
+			&r.validation,
+			&r.label,
+			&r.requestName,
+			&r.failedAssertion,
+			&r.dnsMs,
+			&r.connectMs,
+			&r.tlsMs,
+			&r.ttfbMs,
+			&r.bodyReadMs,
+			&r.connReused,
+			&r.localPort,
+			&r.protocol,
+			&r.grpcStatus)
 		if err != nil {
 			return nil, errors.Wrap(err, "db - getting client requests - scanning failed")
 		}
@@ -124,3 +321,75 @@ func getClientRequests(ctx context.Context, db *sql.DB) ([]*clientRequest, error
 
 	return results, nil
 }
+
+// ErrorCategoryCount is the failed requests of a category in one second of a run.
+type ErrorCategoryCount struct {
+	Second   int
+	Category string
+	Count    int
+}
+
+func getErrorCategoryCounts(ctx context.Context, db *sql.DB, runID string) ([]*ErrorCategoryCount, error) {
+	query := `
+		SELECT s_since_start, error_category, COUNT(*)
+		FROM client_requests
+		WHERE run_id = $1 AND error_category != ''
+		GROUP BY s_since_start, error_category
+		ORDER BY s_since_start, error_category;`
+	rows, err := db.QueryContext(ctx, query, runID)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get error category counts failed")
+	}
+	defer rows.Close()
+
+	results := make([]*ErrorCategoryCount, 0)
+	for rows.Next() {
+		c := ErrorCategoryCount{}
+		err := rows.Scan(&c.Second, &c.Category, &c.Count)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - get error category counts failed - scanning failed")
+		}
+
+		results = append(results, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - get error category counts failed - scaning failed")
+	}
+
+	return results, nil
+}
+
+// milliseconds converts d to fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func getOutcomeCounts(ctx context.Context, db *sql.DB, runID string) (map[string]int, error) {
+	query := `
+		SELECT outcome, COUNT(*)
+		FROM client_requests
+		WHERE run_id = $1
+		GROUP BY outcome;`
+	rows, err := db.QueryContext(ctx, query, runID)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get outcome counts failed")
+	}
+	defer rows.Close()
+
+	results := make(map[string]int)
+	for rows.Next() {
+		var outcome string
+		var count int
+		err := rows.Scan(&outcome, &count)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - get outcome counts failed - scanning failed")
+		}
+
+		results[outcome] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - get outcome counts failed - scaning failed")
+	}
+
+	return results, nil
+}
@@ -18,12 +18,31 @@ func TestClientRequests(t *testing.T) {
 		return createClientRequestsTable(ctx, tx)
 	})
 
+	now := time.Now().UTC()
 	params := &AddRequestParams{
-		WorkerID:  1,
-		StartTime: time.Now(),
-		EndTime:   time.Now(),
-		Success:   true,
-		Error:     "err",
+		WorkerID:          1,
+		IntendedStartTime: now,
+		StartTime:         now.Add(time.Millisecond * 250),
+		EndTime:           now.Add(time.Second),
+		Success:           true,
+		Error:             "err",
+		StatusCode:        200,
+		BytesSent:         120,
+		BytesReceived:     4096,
+		Validation:        ValidationPassed,
+		Label:             "label",
+		RequestName:       "checkout/login",
+		FailedAssertion:   "json token",
+		ErrorCategory:     ErrorCategoryAssertionFailed,
+		DNS:               time.Microsecond * 1500,
+		Connect:           time.Millisecond * 2,
+		TLSHandshake:      time.Millisecond * 3,
+		TimeToFirstByte:   time.Millisecond * 500,
+		BodyRead:          time.Microsecond * 250,
+		ConnReused:        true,
+		LocalPort:         54321,
+		Protocol:          "HTTP/2.0",
+		GRPCStatus:        "OK",
 	}
 	run := &Run{
 		ID:        "runid",
@@ -39,6 +58,159 @@ func TestClientRequests(t *testing.T) {
 	c := clientRequests[0]
 
 	require.Equal(t, params.WorkerID, c.workerID)
+	require.Equal(t, params.IntendedStartTime, c.intendedStartTime)
+	require.Equal(t, params.StartTime, c.startTime)
+	require.Equal(t, 750, c.durationMs)
+	require.Equal(t, 250, c.queueDelayMs)
+	require.Equal(t, OutcomeSuccess, c.outcome)
+	require.Equal(t, params.StatusCode, c.statusCode)
+	require.Equal(t, params.BytesSent, c.bytesSent)
+	require.Equal(t, params.BytesReceived, c.bytesReceived)
+	require.Equal(t, params.Validation, c.validation)
+	require.Equal(t, params.Label, c.label)
+	require.Equal(t, params.RequestName, c.requestName)
+	require.Equal(t, params.FailedAssertion, c.failedAssertion)
+	require.Equal(t, params.ErrorCategory, c.errorCategory)
+	require.Equal(t, 1.5, c.dnsMs)
+	require.Equal(t, 2.0, c.connectMs)
+	require.Equal(t, 3.0, c.tlsMs)
+	require.Equal(t, 500.0, c.ttfbMs)
+	require.Equal(t, 0.25, c.bodyReadMs)
+	require.True(t, c.connReused)
+	require.Equal(t, params.LocalPort, c.localPort)
+	require.Equal(t, params.Protocol, c.protocol)
+	require.Equal(t, params.GRPCStatus, c.grpcStatus)
+}
+
+func TestOutcomeCounts(t *testing.T) {
+	ctx := context.Background()
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createClientRequestsTable(ctx, tx)
+	})
+
+	now := time.Now().UTC()
+	run := &Run{
+		ID:        "runid",
+		StartTime: now,
+	}
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		paramsList := []*AddRequestParams{
+			{Success: true},
+			{Success: true},
+			{Success: false},
+			{Success: false, Outcome: OutcomeTimeout},
+			{Success: false, Outcome: OutcomeCancelled},
+		}
+		for _, params := range paramsList {
+			params.StartTime = now
+			params.EndTime = now
+			err := insertIntoClientRequests(ctx, tx, run, params)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	counts, err := getOutcomeCounts(ctx, db, run.ID)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{
+		OutcomeSuccess:   2,
+		OutcomeError:     1,
+		OutcomeTimeout:   1,
+		OutcomeCancelled: 1,
+	}, counts)
+}
+
+func TestClientRequestsWithoutIntendedStartTime(t *testing.T) {
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createClientRequestsTable(ctx, tx)
+	})
+
+	now := time.Now().UTC()
+	params := &AddRequestParams{
+		WorkerID:  1,
+		StartTime: now,
+		EndTime:   now.Add(time.Second),
+		Success:   true,
+	}
+	run := &Run{
+		ID:        "runid",
+		StartTime: now,
+	}
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return insertIntoClientRequests(ctx, tx, run, params)
+	})
+
+	clientRequests, err := getClientRequests(context.Background(), db)
+	require.NoError(t, err)
+	require.Len(t, clientRequests, 1)
+	c := clientRequests[0]
+
+	require.Equal(t, params.StartTime, c.intendedStartTime)
+	require.Equal(t, 0, c.queueDelayMs)
+	require.Equal(t, ValidationNone, c.validation)
+}
+func TestErrorCategoryCounts(t *testing.T) {
+	ctx := context.Background()
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createClientRequestsTable(ctx, tx)
+	})
+
+	now := time.Now().UTC()
+	run := &Run{
+		ID:        "runid",
+		StartTime: now,
+	}
+	otherRun := &Run{
+		ID:        "otherrunid",
+		StartTime: now,
+	}
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		requests := []struct {
+			run      *Run
+			second   int
+			category string
+		}{
+			{run, 0, ""},
+			{run, 0, ErrorCategoryTimeout},
+			{run, 0, ErrorCategoryTimeout},
+			{run, 0, ErrorCategoryHTTP5xx},
+			{run, 2, ErrorCategoryConnectionRefused},
+			{run, 2, ""},
+			{otherRun, 0, ErrorCategoryTimeout},
+		}
+		for _, request := range requests {
+			startTime := now.Add(time.Duration(request.second) * time.Second)
+			err := insertIntoClientRequests(ctx, tx, request.run, &AddRequestParams{
+				StartTime:     startTime,
+				EndTime:       startTime,
+				Success:       request.category == "",
+				ErrorCategory: request.category,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	counts, err := getErrorCategoryCounts(ctx, db, run.ID)
+	require.NoError(t, err)
+	require.Equal(t, []*ErrorCategoryCount{
+		{Second: 0, Category: ErrorCategoryHTTP5xx, Count: 1},
+		{Second: 0, Category: ErrorCategoryTimeout, Count: 2},
+		{Second: 2, Category: ErrorCategoryConnectionRefused, Count: 1},
+	}, counts)
 }
 
 func newInMemoryDb(t *testing.T) *sql.DB {
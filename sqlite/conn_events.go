@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+// Events in the life of a long-lived connection.
+const (
+	ConnEventOpen  = "open"
+	ConnEventClose = "close"
+	// ConnEventDrop is a connection the server closed or that broke.
+	ConnEventDrop = "drop"
+)
+
+type AddConnEventParams struct {
+	WorkerID  int
+	Time      time.Time
+	Event     string
+	Error     string
+	LocalPort int
+}
+
+func createConnEventsTable(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS conn_events (
+			id 				TEXT 		PRIMARY KEY,
+			run_id 			TEXT 		NOT NULL,
+			worker_id 		INTEGER		NOT NULL,
+			time 			DATETIME 	NOT NULL,
+			s_since_start 	INTEGER		NOT NULL,
+			ms_since_start	INTEGER 	NOT NULL,
+			event 			TEXT 		NOT NULL,
+			error 			TEXT 		NOT NULL,
+			local_port		INTEGER		NOT NULL
+		);`
+
+	_, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "creating conn_events table failed")
+	}
+
+	return nil
+}
+
+func insertIntoConnEvents(ctx context.Context, tx *sql.Tx, run *Run, params *AddConnEventParams) error {
+	query := `
+		INSERT INTO conn_events (
+			id, run_id, worker_id, time, s_since_start, ms_since_start,
+			event, error, local_port)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9);`
+
+	args := []interface{}{
+		util.NewID(),
+		run.ID,
+		params.WorkerID,
+		params.Time,
+		run.secondsSinceStart(params.Time),
+		run.millisecondsSinceStart(params.Time),
+		params.Event,
+		params.Error,
+		params.LocalPort,
+	}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "insert into conn_events failed")
+	}
+
+	return nil
+}
+
+type connEvent struct {
+	id                     string
+	runID                  string
+	workerID               int
+	time                   time.Time
+	secondsSinceStart      int
+	millisecondsSinceStart int
+	event                  string
+	errMessage             string
+	localPort              int
+}
+
+func getConnEvents(ctx context.Context, db *sql.DB) ([]*connEvent, error) {
+	query := `
+		SELECT
+			id, run_id, worker_id, time, s_since_start, ms_since_start,
+			event, error, local_port
+		FROM conn_events
+		ORDER BY time;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get conn events failed")
+	}
+	defer rows.Close()
+
+	results := make([]*connEvent, 0)
+	for rows.Next() {
+		r := connEvent{}
+
+		err := rows.Scan(
+			&r.id,
+			&r.runID,
+			&r.workerID,
+			&r.time,
+			&r.secondsSinceStart,
+			&r.millisecondsSinceStart,
+			&r.event,
+			&r.errMessage,
+			&r.localPort)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - get conn events failed - scanning failed")
+		}
+
+		results = append(results, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - get conn events failed - scaning failed")
+	}
+
+	return results, nil
+}
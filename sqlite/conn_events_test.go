@@ -0,0 +1,68 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnEvents(t *testing.T) {
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createConnEventsTable(ctx, tx)
+	})
+
+	run := &Run{
+		ID:        "runid",
+		StartTime: time.Now().UTC(),
+	}
+	params := []*AddConnEventParams{
+		{
+			WorkerID:  4,
+			Time:      run.StartTime.Add(time.Millisecond * 1500),
+			Event:     ConnEventOpen,
+			LocalPort: 50123,
+		},
+		{
+			WorkerID:  4,
+			Time:      run.StartTime.Add(time.Second * 3),
+			Event:     ConnEventDrop,
+			Error:     "connection reset by peer",
+			LocalPort: 50123,
+		},
+	}
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		for _, p := range params {
+			err := insertIntoConnEvents(ctx, tx, run, p)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	events, err := getConnEvents(context.Background(), db)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	e := events[0]
+	require.Equal(t, run.ID, e.runID)
+	require.Equal(t, 4, e.workerID)
+	require.Equal(t, params[0].Time, e.time)
+	require.Equal(t, 1, e.secondsSinceStart)
+	require.Equal(t, 1500, e.millisecondsSinceStart)
+	require.Equal(t, ConnEventOpen, e.event)
+	require.Equal(t, "", e.errMessage)
+	require.Equal(t, 50123, e.localPort)
+
+	e = events[1]
+	require.Equal(t, ConnEventDrop, e.event)
+	require.Equal(t, params[1].Error, e.errMessage)
+	require.Equal(t, 3, e.secondsSinceStart)
+}
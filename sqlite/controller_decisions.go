@@ -0,0 +1,161 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+// What the adaptive controller did to the load.
+const (
+	ControllerIncrease = "increase"
+	ControllerDecrease = "decrease"
+	ControllerHold     = "hold"
+)
+
+// AddControllerDecisionParams is one adjustment of the adaptive controller.
+type AddControllerDecisionParams struct {
+	Time       time.Time
+	Algorithm  string
+	Requests   int
+	ErrorRate  float64
+	P99        time.Duration
+	Throughput float64
+	// LoadBefore and LoadAfter are workers for closed-loop runs and requests per second for open-loop ones.
+	LoadBefore float64
+	LoadAfter  float64
+	Action     string
+	Reason     string
+}
+
+func createControllerDecisionsTable(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS controller_decisions (
+			id 				TEXT 		PRIMARY KEY,
+			run_id 			TEXT 		NOT NULL,
+			time 			DATETIME 	NOT NULL,
+			s_since_start 	INTEGER		NOT NULL,
+			ms_since_start	INTEGER 	NOT NULL,
+			algorithm		TEXT		NOT NULL,
+
+			requests 		INTEGER 	NOT NULL,
+			error_rate 		REAL 		NOT NULL,
+			p99_ms 			INTEGER 	NOT NULL,
+			throughput 		REAL 		NOT NULL,
+
+			load_before		REAL		NOT NULL,
+			load_after		REAL		NOT NULL,
+			action			TEXT		NOT NULL,
+			reason			TEXT		NOT NULL
+		);`
+
+	_, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "creating controller_decisions table failed")
+	}
+
+	return nil
+}
+
+func insertIntoControllerDecisions(ctx context.Context, tx *sql.Tx, run *Run, params *AddControllerDecisionParams) error {
+	query := `
+		INSERT INTO controller_decisions (
+			id, run_id, time, s_since_start, ms_since_start, algorithm,
+			requests, error_rate, p99_ms, throughput,
+			load_before, load_after, action, reason)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14);`
+
+	args := []interface{}{
+		util.NewID(),
+		run.ID,
+		params.Time,
+		run.secondsSinceStart(params.Time),
+		run.millisecondsSinceStart(params.Time),
+		params.Algorithm,
+
+		params.Requests,
+		params.ErrorRate,
+		params.P99 / time.Millisecond,
+		params.Throughput,
+
+		params.LoadBefore,
+		params.LoadAfter,
+		params.Action,
+		params.Reason,
+	}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "insert into controller_decisions failed")
+	}
+
+	return nil
+}
+
+type controllerDecision struct {
+	id                     string
+	runID                  string
+	time                   time.Time
+	secondsSinceStart      int
+	millisecondsSinceStart int
+	algorithm              string
+	requests               int
+	errorRate              float64
+	p99Ms                  int
+	throughput             float64
+	loadBefore             float64
+	loadAfter              float64
+	action                 string
+	reason                 string
+}
+
+func getControllerDecisions(ctx context.Context, db *sql.DB) ([]*controllerDecision, error) {
+	query := `
+		SELECT
+			id, run_id, time, s_since_start, ms_since_start, algorithm,
+			requests, error_rate, p99_ms, throughput,
+			load_before, load_after, action, reason
+		FROM controller_decisions
+		ORDER BY time;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get controller decisions failed")
+	}
+	defer rows.Close()
+
+	results := make([]*controllerDecision, 0)
+	for rows.Next() {
+		d := controllerDecision{}
+
+		err := rows.Scan(
+			&d.id,
+			&d.runID,
+			&d.time,
+			&d.secondsSinceStart,
+			&d.millisecondsSinceStart,
+			&d.algorithm,
+			&d.requests,
+			&d.errorRate,
+			&d.p99Ms,
+			&d.throughput,
+			&d.loadBefore,
+			&d.loadAfter,
+			&d.action,
+			&d.reason,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - getting controller decisions - scanning failed")
+		}
+
+		results = append(results, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - getting controller decisions - scaning failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControllerDecisions(t *testing.T) {
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createControllerDecisionsTable(ctx, tx)
+	})
+
+	run := &Run{
+		ID:        "runid",
+		StartTime: time.Now().UTC(),
+	}
+	params := &AddControllerDecisionParams{
+		Time:       run.StartTime.Add(time.Second * 15),
+		Algorithm:  "aimd",
+		Requests:   1200,
+		ErrorRate:  0.001,
+		P99:        time.Millisecond * 180,
+		Throughput: 239.8,
+		LoadBefore: 20,
+		LoadAfter:  21,
+		Action:     ControllerIncrease,
+		Reason:     "p99 180ms is within the 200ms target",
+	}
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return insertIntoControllerDecisions(ctx, tx, run, params)
+	})
+
+	decisions, err := getControllerDecisions(context.Background(), db)
+	require.NoError(t, err)
+	require.Len(t, decisions, 1)
+	d := decisions[0]
+
+	require.Equal(t, run.ID, d.runID)
+	require.Equal(t, params.Time, d.time)
+	require.Equal(t, 15, d.secondsSinceStart)
+	require.Equal(t, 15000, d.millisecondsSinceStart)
+	require.Equal(t, params.Algorithm, d.algorithm)
+	require.Equal(t, params.Requests, d.requests)
+	require.Equal(t, params.ErrorRate, d.errorRate)
+	require.Equal(t, 180, d.p99Ms)
+	require.Equal(t, params.Throughput, d.throughput)
+	require.Equal(t, params.LoadBefore, d.loadBefore)
+	require.Equal(t, params.LoadAfter, d.loadAfter)
+	require.Equal(t, params.Action, d.action)
+	require.Equal(t, params.Reason, d.reason)
+}
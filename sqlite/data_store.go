@@ -32,8 +32,17 @@ func NewDataStore(filePath string) (*DataStore, error) {
 	}, nil
 }
 
+// CreateTables creates missing tables and adds missing columns to older ones.
 func (d *DataStore) CreateTables(ctx context.Context) error {
-	tx, err := d.db.Begin()
+	err := migrateTables(ctx, d.db)
+	if err != nil {
+		return err
+	}
+	return createTables(ctx, d.db)
+}
+
+func createTables(ctx context.Context, db *sql.DB) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return errors.Wrap(err, "db - starting transaction failed")
 	}
@@ -62,6 +71,48 @@ func (d *DataStore) CreateTables(ctx context.Context) error {
 		return err
 	}
 
+	err = createConnEventsTable(ctx, tx)
+	err = rollbackTransaction(tx, err)
+	if err != nil {
+		return err
+	}
+
+	err = createProcessFDsTable(ctx, tx)
+	err = rollbackTransaction(tx, err)
+	if err != nil {
+		return err
+	}
+
+	err = createRunStagesTable(ctx, tx)
+	err = rollbackTransaction(tx, err)
+	if err != nil {
+		return err
+	}
+
+	err = createRunEventsTable(ctx, tx)
+	err = rollbackTransaction(tx, err)
+	if err != nil {
+		return err
+	}
+
+	err = createControllerDecisionsTable(ctx, tx)
+	err = rollbackTransaction(tx, err)
+	if err != nil {
+		return err
+	}
+
+	err = createExperimentsTable(ctx, tx)
+	err = rollbackTransaction(tx, err)
+	if err != nil {
+		return err
+	}
+
+	err = createSearchProbesTable(ctx, tx)
+	err = rollbackTransaction(tx, err)
+	if err != nil {
+		return err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return errors.Wrap(err, "create tables - commit transaction failed")
@@ -95,14 +146,114 @@ func (d *DataStore) WriteRunStart(ctx context.Context, params *AddRunParams) err
 	return nil
 }
 
-func (d *DataStore) WriteRunEnd(ctx context.Context, runID string, endTime time.Time) error {
-	err := updateRunEndTime(ctx, d.db, runID, endTime)
+func (d *DataStore) WriteRunEnd(ctx context.Context, params *RunEndParams) error {
+	err := updateRunEnd(ctx, d.db, params)
 	if err != nil {
 		return errors.Wrap(err, "write run end failed")
 	}
 	return nil
 }
 
+// MarkStaleRuns marks the runs left running on host by a dead process as failed.
+func (d *DataStore) MarkStaleRuns(ctx context.Context, host string, processExists func(pid int) bool) ([]string, error) {
+	runIDs, err := markStaleRuns(ctx, d.db, host, processExists)
+	if err != nil {
+		return nil, errors.Wrap(err, "mark stale runs failed")
+	}
+	return runIDs, nil
+}
+
+// GetRunStatus returns whether a run is still running, and how it ended if it isn't.
+func (d *DataStore) GetRunStatus(ctx context.Context, runID string) (*RunStatus, error) {
+	status, err := getRunStatus(ctx, d.db, runID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get run status failed")
+	}
+	return status, nil
+}
+
+func (d *DataStore) WriteExperimentStart(ctx context.Context, params *AddExperimentParams) error {
+	err := insertIntoExperiments(ctx, d.db, params)
+	if err != nil {
+		return errors.Wrap(err, "write experiment start failed")
+	}
+	return nil
+}
+
+func (d *DataStore) WriteExperimentEnd(ctx context.Context, params *ExperimentEndParams) error {
+	err := updateExperimentEnd(ctx, d.db, params)
+	if err != nil {
+		return errors.Wrap(err, "write experiment end failed")
+	}
+	return nil
+}
+
+func (d *DataStore) GetExperimentStatus(ctx context.Context, experimentID string) (*ExperimentStatus, error) {
+	status, err := getExperimentStatus(ctx, d.db, experimentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get experiment status failed")
+	}
+	return status, nil
+}
+
+func (d *DataStore) WriteSearchProbe(ctx context.Context, params *AddSearchProbeParams) error {
+	err := insertIntoSearchProbes(ctx, d.db, params)
+	if err != nil {
+		return errors.Wrap(err, "write search probe failed")
+	}
+	return nil
+}
+
+// GetExperimentRunIDs returns the IDs of the runs of a search or sweep in order.
+func (d *DataStore) GetExperimentRunIDs(ctx context.Context, experimentID string) ([]string, error) {
+	runIDs, err := getExperimentRunIDs(ctx, d.db, experimentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get experiment run ids failed")
+	}
+	return runIDs, nil
+}
+
+// GetOutcomeCounts returns the number of client requests of a run with each outcome.
+func (d *DataStore) GetOutcomeCounts(ctx context.Context, runID string) (map[string]int, error) {
+	counts, err := getOutcomeCounts(ctx, d.db, runID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get outcome counts failed")
+	}
+	return counts, nil
+}
+
+// GetErrorCategoryCounts returns the failed requests of each category per second of a run.
+func (d *DataStore) GetErrorCategoryCounts(ctx context.Context, runID string) ([]*ErrorCategoryCount, error) {
+	counts, err := getErrorCategoryCounts(ctx, d.db, runID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get error category counts failed")
+	}
+	return counts, nil
+}
+
+// GetRunStats summarizes the client requests of a finished run.
+func (d *DataStore) GetRunStats(ctx context.Context, runID string) (*RunStats, error) {
+	stats, err := getRunStats(ctx, d.db, runID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get run stats failed")
+	}
+	return stats, nil
+}
+
+// GetMonitorMetric returns the highest value of a monitor metric since the given time.
+func (d *DataStore) GetMonitorMetric(ctx context.Context, metric string, since time.Time) (value float64, ok bool, err error) {
+	value, ok, err = getMonitorMetric(ctx, d.db, metric, since)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "get monitor metric failed")
+	}
+	return value, ok, nil
+}
+
+// QueueDepth is the number of rows waiting to be written.
+func (d *DataStore) QueueDepth() int {
+	return len(d.writeQueue)
+}
+
 func (d *DataStore) QueueTCPConn(params *AddTCPConnParams) {
 	if params == nil {
 		return
@@ -134,11 +285,70 @@ func (d *DataStore) QueueConnStatus(params *AddConnStatusParams) {
 	}
 }
 
+func (d *DataStore) QueueConnEvent(run *Run, params *AddConnEventParams) {
+	if params == nil {
+		return
+	}
+
+	d.writeQueue <- &writeQueueParams{
+		run:       run,
+		connEvent: params,
+	}
+}
+
+func (d *DataStore) QueueProcessFDs(params *AddProcessFDsParams) {
+	if params == nil {
+		return
+	}
+
+	d.writeQueue <- &writeQueueParams{
+		processFDs: params,
+	}
+}
+
+func (d *DataStore) QueueRunStage(run *Run, params *AddRunStageParams) {
+	if params == nil {
+		return
+	}
+
+	d.writeQueue <- &writeQueueParams{
+		run:      run,
+		runStage: params,
+	}
+}
+
+func (d *DataStore) QueueRunEvent(run *Run, params *AddRunEventParams) {
+	if params == nil {
+		return
+	}
+
+	d.writeQueue <- &writeQueueParams{
+		run:      run,
+		runEvent: params,
+	}
+}
+
+func (d *DataStore) QueueControllerDecision(run *Run, params *AddControllerDecisionParams) {
+	if params == nil {
+		return
+	}
+
+	d.writeQueue <- &writeQueueParams{
+		run:                run,
+		controllerDecision: params,
+	}
+}
+
 type writeQueueParams struct {
-	clientRequest *AddRequestParams
-	tcpConn       *AddTCPConnParams
-	connStatus    *AddConnStatusParams
-	run           *Run
+	clientRequest      *AddRequestParams
+	tcpConn            *AddTCPConnParams
+	connStatus         *AddConnStatusParams
+	runStage           *AddRunStageParams
+	runEvent           *AddRunEventParams
+	controllerDecision *AddControllerDecisionParams
+	connEvent          *AddConnEventParams
+	processFDs         *AddProcessFDsParams
+	run                *Run
 }
 
 func (d *DataStore) writeFromQueue(stopReiever *util.StopReciever) {
@@ -217,6 +427,46 @@ func (d *DataStore) writeToDB(params []*writeQueueParams) error {
 				return err
 			}
 		}
+
+		if param.runStage != nil {
+			err = insertIntoRunStages(ctx, tx, param.run, param.runStage)
+			err = rollbackTransaction(tx, err)
+			if err != nil {
+				return err
+			}
+		}
+
+		if param.runEvent != nil {
+			err = insertIntoRunEvents(ctx, tx, param.run, param.runEvent)
+			err = rollbackTransaction(tx, err)
+			if err != nil {
+				return err
+			}
+		}
+
+		if param.controllerDecision != nil {
+			err = insertIntoControllerDecisions(ctx, tx, param.run, param.controllerDecision)
+			err = rollbackTransaction(tx, err)
+			if err != nil {
+				return err
+			}
+		}
+
+		if param.connEvent != nil {
+			err = insertIntoConnEvents(ctx, tx, param.run, param.connEvent)
+			err = rollbackTransaction(tx, err)
+			if err != nil {
+				return err
+			}
+		}
+
+		if param.processFDs != nil {
+			err = insertIntoProcessFDs(ctx, tx, param.processFDs)
+			err = rollbackTransaction(tx, err)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return tx.Commit()
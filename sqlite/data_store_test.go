@@ -61,8 +61,36 @@ func TestDataStore(t *testing.T) {
 	}
 	ds.QueueConnStatus(addConnStatusParams)
 
+	addRunStageParams := &AddRunStageParams{
+		StageIndex: 1,
+		Name:       "steady",
+		StartTime:  now,
+		Workers:    2,
+	}
+	ds.QueueRunStage(run, addRunStageParams)
+
+	addRunEventParams := &AddRunEventParams{
+		Time:    now,
+		Event:   RunEventAnnotation,
+		Message: "deployed the fix",
+	}
+	ds.QueueRunEvent(run, addRunEventParams)
+
+	addControllerDecisionParams := &AddControllerDecisionParams{
+		Time:       now,
+		Algorithm:  "aimd",
+		LoadBefore: 2,
+		LoadAfter:  3,
+		Action:     ControllerIncrease,
+	}
+	ds.QueueControllerDecision(run, addControllerDecisionParams)
+
 	endTime := startTime.Add(time.Minute)
-	err = ds.WriteRunEnd(ctx, runID, endTime)
+	err = ds.WriteRunEnd(ctx, &RunEndParams{
+		RunID:   runID,
+		EndTime: endTime,
+		Status:  RunStatusCompleted,
+	})
 	require.NoError(t, err)
 
 	ds.Stop()
@@ -91,6 +119,30 @@ func TestDataStore(t *testing.T) {
 	require.Equal(t, connStatus.runID, runID)
 	require.Equal(t, connStatus.fd, uint32(23434))
 
+	runStages, err := getRunStages(ctx, ds.db)
+	require.NoError(t, err)
+	require.Len(t, runStages, 1)
+	runStage := runStages[0]
+	require.NotNil(t, runStage)
+	require.Equal(t, runStage.runID, runID)
+	require.Equal(t, runStage.name, "steady")
+
+	runEvents, err := getRunEvents(ctx, ds.db)
+	require.NoError(t, err)
+	require.Len(t, runEvents, 1)
+	runEvent := runEvents[0]
+	require.NotNil(t, runEvent)
+	require.Equal(t, runEvent.runID, runID)
+	require.Equal(t, runEvent.message, "deployed the fix")
+
+	controllerDecisions, err := getControllerDecisions(ctx, ds.db)
+	require.NoError(t, err)
+	require.Len(t, controllerDecisions, 1)
+	controllerDecision := controllerDecisions[0]
+	require.NotNil(t, controllerDecision)
+	require.Equal(t, controllerDecision.runID, runID)
+	require.Equal(t, controllerDecision.loadAfter, float64(3))
+
 	err = ds.Close()
 	require.NoError(t, err)
 }
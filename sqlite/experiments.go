@@ -0,0 +1,173 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Experiment kinds.
+const (
+	ExperimentKindSearch = "search"
+	ExperimentKindSweep  = "sweep"
+)
+
+type AddExperimentParams struct {
+	ID        string
+	Kind      string
+	StartTime time.Time
+	Desc      string
+}
+
+// ExperimentEndParams is how a search or sweep ended.
+type ExperimentEndParams struct {
+	ID      string
+	EndTime time.Time
+	// Status is one of the RunStatus constants.
+	Status string
+	// Error is why the experiment was aborted or failed.
+	Error string
+	// ResultLoad is nil when the experiment has no single result.
+	ResultLoad *float64
+}
+
+// ExperimentStatus is how a search or sweep ended, or that it hasn't.
+type ExperimentStatus struct {
+	Status  string
+	Error   string
+	EndTime *time.Time
+}
+
+func createExperimentsTable(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS experiments (
+			id 				TEXT 		PRIMARY KEY,
+			kind 			TEXT 		NOT NULL,
+			start_time 		DATETIME 	NOT NULL,
+			end_time 		DATETIME,
+			desc 			TEXT,
+			result_load 	REAL,
+			status 			TEXT,
+			error 			TEXT
+		);`
+
+	_, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "creating experiments table failed")
+	}
+
+	return nil
+}
+
+func insertIntoExperiments(ctx context.Context, db *sql.DB, params *AddExperimentParams) error {
+	query := `
+		INSERT INTO experiments (id, kind, start_time, desc, status)
+		VALUES ($1, $2, $3, $4, $5);`
+
+	args := []interface{}{
+		params.ID,
+		params.Kind,
+		params.StartTime,
+		params.Desc,
+		RunStatusRunning,
+	}
+
+	_, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "insert into experiments failed")
+	}
+
+	return nil
+}
+
+// updateExperimentEnd sets the end time and status of an experiment.
+func updateExperimentEnd(ctx context.Context, db *sql.DB, params *ExperimentEndParams) error {
+	query := `
+		UPDATE experiments
+		SET end_time = $1, result_load = $2, status = $3, error = $4
+		WHERE id = $5;`
+
+	var experimentErr *string
+	if params.Error != "" {
+		experimentErr = &params.Error
+	}
+	args := []interface{}{params.EndTime, params.ResultLoad, params.Status, experimentErr, params.ID}
+
+	_, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "update experiment end failed")
+	}
+
+	return nil
+}
+
+func getExperimentStatus(ctx context.Context, db *sql.DB, experimentID string) (*ExperimentStatus, error) {
+	query := `
+		SELECT status, error, end_time
+		FROM experiments
+		WHERE id = $1;`
+
+	var status, experimentErr *string
+	result := &ExperimentStatus{}
+	err := db.QueryRowContext(ctx, query, experimentID).Scan(&status, &experimentErr, &result.EndTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get experiment status failed")
+	}
+	if status != nil {
+		result.Status = *status
+	}
+	if experimentErr != nil {
+		result.Error = *experimentErr
+	}
+
+	return result, nil
+}
+
+type experiment struct {
+	id         string
+	kind       string
+	startTime  time.Time
+	endTime    *time.Time
+	desc       *string
+	resultLoad *float64
+	status     *string
+	err        *string
+}
+
+func getExperiments(ctx context.Context, db *sql.DB) ([]*experiment, error) {
+	query := `
+		SELECT id, kind, start_time, end_time, desc, result_load, status, error
+		FROM experiments;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get experiments failed")
+	}
+	defer rows.Close()
+
+	results := make([]*experiment, 0)
+	for rows.Next() {
+		r := experiment{}
+
+		err := rows.Scan(
+			&r.id,
+			&r.kind,
+			&r.startTime,
+			&r.endTime,
+			&r.desc,
+			&r.resultLoad,
+			&r.status,
+			&r.err)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - get experiments failed - scanning failed")
+		}
+
+		results = append(results, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - get experiments failed - scaning failed")
+	}
+
+	return results, nil
+}
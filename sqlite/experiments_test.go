@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExperiments(t *testing.T) {
+	ctx := context.Background()
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createExperimentsTable(ctx, tx)
+	})
+
+	startTime := time.Now().UTC()
+	params := &AddExperimentParams{
+		ID:        "experimentid",
+		Kind:      ExperimentKindSearch,
+		StartTime: startTime,
+		Desc:      "test desc",
+	}
+
+	err := insertIntoExperiments(ctx, db, params)
+	require.NoError(t, err)
+
+	experiments, err := getExperiments(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, experiments, 1)
+	e := experiments[0]
+
+	require.Equal(t, params.ID, e.id)
+	require.Equal(t, params.Kind, e.kind)
+	require.Equal(t, params.StartTime, e.startTime)
+	require.NotNil(t, e.desc)
+	require.Equal(t, params.Desc, *e.desc)
+	require.Nil(t, e.endTime)
+	require.Nil(t, e.resultLoad)
+	require.NotNil(t, e.status)
+	require.Equal(t, RunStatusRunning, *e.status)
+
+	endTime := startTime.Add(time.Minute * 10)
+	resultLoad := 120.0
+	err = updateExperimentEnd(ctx, db, &ExperimentEndParams{
+		ID:         params.ID,
+		EndTime:    endTime,
+		Status:     RunStatusCompleted,
+		ResultLoad: &resultLoad,
+	})
+	require.NoError(t, err)
+
+	experiments, err = getExperiments(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, experiments, 1)
+	e = experiments[0]
+
+	require.NotNil(t, e.endTime)
+	require.Equal(t, endTime, *e.endTime)
+	require.NotNil(t, e.resultLoad)
+	require.Equal(t, resultLoad, *e.resultLoad)
+	require.Equal(t, RunStatusCompleted, *e.status)
+	require.Nil(t, e.err)
+
+	err = updateExperimentEnd(ctx, db, &ExperimentEndParams{
+		ID:      params.ID,
+		EndTime: endTime,
+		Status:  RunStatusAborted,
+		Error:   "received signal interrupt",
+	})
+	require.NoError(t, err)
+
+	experiments, err = getExperiments(ctx, db)
+	require.NoError(t, err)
+	e = experiments[0]
+	require.Equal(t, RunStatusAborted, *e.status)
+	require.NotNil(t, e.err)
+	require.Equal(t, "received signal interrupt", *e.err)
+	require.Nil(t, e.resultLoad)
+
+	status, err := getExperimentStatus(ctx, db, params.ID)
+	require.NoError(t, err)
+	require.Equal(t, RunStatusAborted, status.Status)
+	require.Equal(t, "received signal interrupt", status.Error)
+	require.NotNil(t, status.EndTime)
+}
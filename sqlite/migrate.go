@@ -0,0 +1,152 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type tableColumn struct {
+	name       string
+	columnType string
+	notNull    bool
+	dfltValue  sql.NullString
+}
+
+// migrateTables adds the columns that tables created by an older version are missing.
+func migrateTables(ctx context.Context, db *sql.DB) error {
+	ref, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return errors.Wrap(err, "migrate tables - opening reference db failed")
+	}
+	defer ref.Close()
+	// Every connection to :memory: is a database of its own.
+	ref.SetMaxOpenConns(1)
+
+	err = createTables(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	tables, err := getTableNames(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		existing, err := getTableColumns(ctx, db, table)
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			// The table doesn't exist yet.
+			continue
+		}
+		existingNames := make(map[string]bool)
+		for _, column := range existing {
+			existingNames[column.name] = true
+		}
+
+		columns, err := getTableColumns(ctx, ref, table)
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if existingNames[column.name] {
+				continue
+			}
+
+			query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", table, column.definition())
+			_, err = db.ExecContext(ctx, query)
+			if err != nil {
+				return errors.Wrapf(err, "adding column %s to %s failed", column.name, table)
+			}
+		}
+	}
+
+	return nil
+}
+
+// definition is the column's definition for ALTER TABLE ADD COLUMN, defaulting NOT NULL columns.
+func (c *tableColumn) definition() string {
+	definition := c.name + " " + c.columnType
+	if !c.notNull {
+		return definition
+	}
+	if c.dfltValue.Valid {
+		return definition + " NOT NULL DEFAULT " + c.dfltValue.String
+	}
+	switch strings.ToUpper(c.columnType) {
+	case "TEXT":
+		return definition + " NOT NULL DEFAULT ''"
+	case "INTEGER", "REAL":
+		return definition + " NOT NULL DEFAULT 0"
+	default:
+		// There is no zero time, so the old rows are left NULL.
+		return definition
+	}
+}
+
+func getTableNames(ctx context.Context, db *sql.DB) ([]string, error) {
+	query := `
+		SELECT name
+		FROM sqlite_master
+		WHERE type = 'table'
+		ORDER BY name;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get table names failed")
+	}
+	defer rows.Close()
+
+	results := make([]string, 0)
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - getting table names - scanning failed")
+		}
+		results = append(results, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - getting table names - scaning failed")
+	}
+
+	return results, nil
+}
+
+func getTableColumns(ctx context.Context, db *sql.DB, table string) ([]*tableColumn, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s);", table))
+	if err != nil {
+		return nil, errors.Wrapf(err, "db - get columns of %s failed", table)
+	}
+	defer rows.Close()
+
+	results := make([]*tableColumn, 0)
+	for rows.Next() {
+		c := tableColumn{}
+		var cid, pk int
+
+		err := rows.Scan(
+			&cid,
+			&c.name,
+			&c.columnType,
+			&c.notNull,
+			&c.dfltValue,
+			&pk,
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "db - getting columns of %s - scanning failed", table)
+		}
+
+		results = append(results, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "db - getting columns of %s - scaning failed", table)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,134 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+// baselineSchema is the schema of the first version of the results
+// database.
+const baselineSchema = `
+	CREATE TABLE runs (
+		id 				TEXT 		PRIMARY KEY,
+		start_time 		DATETIME 	NOT NULL,
+		end_time 		DATETIME,
+		desc 			TEXT,
+		num_workers 	INTEGER
+	);
+	CREATE TABLE client_requests (
+		id 				TEXT 		PRIMARY KEY,
+		run_id			TEXT		NOT NULL,
+		worker_id 		INTEGER		NOT NULL,
+		start_time		DATETIME	NOT NULL,
+		end_time		DATETIME	NOT NULL,
+		s_since_start 	INTEGER		NOT NULL,
+		ms_since_start	INTEGER 	NOT NULL,
+		duration_ms		INTEGER		NOT NULL,
+		success			INTEGER		NOT NULL,
+		error			TEXT		NOT NULL
+	);
+	CREATE TABLE tcp_conns (
+		id 				TEXT 		PRIMARY KEY,
+		run_id 			TEXT 		NOT NULL,
+		time 			DATETIME 	NOT NULL,
+		established 	INTEGER 	NOT NULL,
+		syn_sent		INTEGER		NOT NULL,
+		syn_recv		INTEGER		NOT NULL,
+		fin_wait_1 		INTEGER 	NOT NULL,
+		fin_wait_2 		INTEGER 	NOT NULL,
+		time_wait 		INTEGER 	NOT NULL,
+		close			INTEGER		NOT NULL,
+		close_wait 		INTEGER 	NOT NULL,
+		last_ack 		INTEGER 	NOT NULL,
+		listen			INTEGER		NOT NULL,
+		closing			INTEGER		NOT NULL
+	);
+	CREATE TABLE conn_status (
+		id 				TEXT 		PRIMARY KEY,
+		run_id 			TEXT 		NOT NULL,
+		time 			DATETIME 	NOT NULL,
+		fd 				INTEGER 	NOT NULL,
+		type			TEXT 		NOT NULL,
+		local_ip 		TEXT 		NOT NULL,
+		local_port 		INTEGER 	NOT NULL,
+		remote_ip 		TEXT 		NOT NULL,
+		remote_port 	INTEGER 	NOT NULL,
+		status 			TEXT 		NOT NULL,
+		process_id		INTEGER		NOT NULL,
+		process_name	TEXT		NOT NULL
+	);
+	INSERT INTO runs (id, start_time, end_time, desc, num_workers)
+	VALUES ('oldrun', '2020-01-01 00:00:00', '2020-01-01 00:01:00', 'old', 2);
+	INSERT INTO client_requests (
+		id, run_id, worker_id, start_time, end_time, s_since_start, ms_since_start,
+		duration_ms, success, error)
+	VALUES (
+		'oldrequest', 'oldrun', 0, '2020-01-01 00:00:01', '2020-01-01 00:00:02', 1, 1000,
+		1000, 1, '');`
+
+func TestMigrateBaselineSchema(t *testing.T) {
+	ctx := context.Background()
+	filePath := filepath.Join(t.TempDir(), "old.db")
+
+	db, err := sql.Open("sqlite3", filePath)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, baselineSchema)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	ds, err := NewDataStore(filePath)
+	require.NoError(t, err)
+	err = ds.CreateTables(ctx)
+	require.NoError(t, err)
+
+	// Every column of the current schema is there.
+	for _, table := range []string{"runs", "client_requests", "tcp_conns", "conn_status"} {
+		columns, err := getTableColumns(ctx, ds.db, table)
+		require.NoError(t, err)
+
+		ref := newInMemoryDb(t)
+		ref.SetMaxOpenConns(1)
+		require.NoError(t, createTables(ctx, ref))
+		want, err := getTableColumns(ctx, ref, table)
+		require.NoError(t, err)
+		require.NoError(t, ref.Close())
+
+		require.Len(t, columns, len(want), table)
+	}
+
+	// Migrating again changes nothing.
+	err = ds.CreateTables(ctx)
+	require.NoError(t, err)
+
+	ds.Start()
+	now := time.Now().UTC()
+	err = ds.WriteRunStart(ctx, &AddRunParams{
+		ID:         "newrun",
+		StartTime:  now,
+		NumWorkers: 1,
+	})
+	require.NoError(t, err)
+	ds.QueueClientRequest(&Run{ID: "newrun", StartTime: now}, &AddRequestParams{
+		StartTime: now,
+		EndTime:   now.Add(time.Millisecond),
+		Success:   true,
+	})
+	ds.Stop()
+
+	counts, err := ds.GetOutcomeCounts(ctx, "newrun")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{OutcomeSuccess: 1}, counts)
+
+	// The old rows are still there.
+	counts, err = ds.GetOutcomeCounts(ctx, "oldrun")
+	require.NoError(t, err)
+	require.Len(t, counts, 1)
+
+	require.NoError(t, ds.Close())
+}
@@ -0,0 +1,55 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// monitorMetrics are the cmd/monitor values abort rules can read, and where they are stored.
+var monitorMetrics = map[string]struct {
+	table  string
+	column string
+}{
+	"num_fds":     {"process_fds", "num_fds"},
+	"established": {"tcp_conns", "established"},
+	"syn_sent":    {"tcp_conns", "syn_sent"},
+	"syn_recv":    {"tcp_conns", "syn_recv"},
+	"time_wait":   {"tcp_conns", "time_wait"},
+	"close_wait":  {"tcp_conns", "close_wait"},
+	"fin_wait1":   {"tcp_conns", "fin_wait_1"},
+	"fin_wait2":   {"tcp_conns", "fin_wait_2"},
+}
+
+// IsMonitorMetric tells whether GetMonitorMetric can read metric.
+func IsMonitorMetric(metric string) bool {
+	_, ok := monitorMetrics[metric]
+	return ok
+}
+
+// getMonitorMetric returns the highest value of metric any monitored process had since then.
+func getMonitorMetric(ctx context.Context, db *sql.DB, metric string, since time.Time) (value float64, ok bool, err error) {
+	m, found := monitorMetrics[metric]
+	if !found {
+		return 0, false, errors.Errorf("unknown monitor metric %q", metric)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT MAX(%s)
+		FROM %s
+		WHERE time >= $1;`, m.column, m.table)
+
+	var max *float64
+	err = db.QueryRowContext(ctx, query, since).Scan(&max)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "db - get monitor metric %s failed", metric)
+	}
+	if max == nil {
+		return 0, false, nil
+	}
+
+	return *max, true, nil
+}
@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorMetric(t *testing.T) {
+	ctx := context.Background()
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		err := createTCPConnsTable(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return createProcessFDsTable(ctx, tx)
+	})
+
+	now := time.Now().UTC()
+	samples := []*AddTCPConnParams{
+		{RunID: "monitor", Time: now.Add(-time.Minute), ProcessName: "server", CloseWait: 900},
+		{RunID: "monitor", Time: now.Add(-time.Second * 2), ProcessName: "server", CloseWait: 300},
+		{RunID: "monitor", Time: now.Add(-time.Second), ProcessName: "load_generator", CloseWait: 20},
+	}
+	for _, params := range samples {
+		testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+			return insertIntoTCPConns(ctx, tx, params)
+		})
+	}
+
+	value, ok, err := getMonitorMetric(ctx, db, "close_wait", now.Add(-time.Second*10))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 300.0, value)
+
+	_, ok, err = getMonitorMetric(ctx, db, "num_fds", now.Add(-time.Second*10))
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Every metric can be read.
+	for metric := range monitorMetrics {
+		_, _, err = getMonitorMetric(ctx, db, metric, now.Add(-time.Second*10))
+		require.NoError(t, err, metric)
+	}
+
+	require.True(t, IsMonitorMetric("num_fds"))
+	require.False(t, IsMonitorMetric("id"))
+	_, _, err = getMonitorMetric(ctx, db, "id", now)
+	require.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+type AddProcessFDsParams struct {
+	RunID       string
+	Time        time.Time
+	ProcessID   uint32
+	ProcessName string
+	NumFDs      int
+	// SoftLimit is the process's RLIMIT_NOFILE, or 0 if it couldn't be read.
+	SoftLimit int
+}
+
+func createProcessFDsTable(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS process_fds (
+			id 				TEXT 		PRIMARY KEY,
+			run_id 			TEXT 		NOT NULL,
+			time 			DATETIME 	NOT NULL,
+			process_id		INTEGER		NOT NULL,
+			process_name	TEXT		NOT NULL,
+			num_fds			INTEGER		NOT NULL,
+			soft_limit		INTEGER		NOT NULL
+		);`
+
+	_, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "creating process_fds table failed")
+	}
+
+	return nil
+}
+
+func insertIntoProcessFDs(ctx context.Context, tx *sql.Tx, params *AddProcessFDsParams) error {
+	query := `
+		INSERT INTO process_fds (
+			id, run_id, time, process_id, process_name, num_fds, soft_limit)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7);`
+
+	args := []interface{}{
+		util.NewID(),
+		params.RunID,
+		params.Time,
+		params.ProcessID,
+		params.ProcessName,
+		params.NumFDs,
+		params.SoftLimit,
+	}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "insert into process_fds failed")
+	}
+
+	return nil
+}
+
+type processFDs struct {
+	id          string
+	runID       string
+	time        time.Time
+	processID   uint32
+	processName string
+	numFDs      int
+	softLimit   int
+}
+
+func getProcessFDs(ctx context.Context, db *sql.DB) ([]*processFDs, error) {
+	query := `
+		SELECT id, run_id, time, process_id, process_name, num_fds, soft_limit
+		FROM process_fds;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get process fds failed")
+	}
+	defer rows.Close()
+
+	results := make([]*processFDs, 0)
+	for rows.Next() {
+		r := processFDs{}
+
+		err := rows.Scan(
+			&r.id,
+			&r.runID,
+			&r.time,
+			&r.processID,
+			&r.processName,
+			&r.numFDs,
+			&r.softLimit)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - get process fds failed - scanning failed")
+		}
+
+		results = append(results, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - get process fds failed - scaning failed")
+	}
+
+	return results, nil
+}
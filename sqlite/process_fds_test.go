@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessFDs(t *testing.T) {
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createProcessFDsTable(ctx, tx)
+	})
+
+	params := &AddProcessFDsParams{
+		RunID:       "runid",
+		Time:        time.Now().UTC(),
+		ProcessID:   1234,
+		ProcessName: "server",
+		NumFDs:      20011,
+		SoftLimit:   65536,
+	}
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return insertIntoProcessFDs(ctx, tx, params)
+	})
+
+	rows, err := getProcessFDs(context.Background(), db)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	r := rows[0]
+
+	require.Equal(t, params.RunID, r.runID)
+	require.Equal(t, params.Time, r.time)
+	require.Equal(t, params.ProcessID, r.processID)
+	require.Equal(t, params.ProcessName, r.processName)
+	require.Equal(t, params.NumFDs, r.numFDs)
+	require.Equal(t, params.SoftLimit, r.softLimit)
+}
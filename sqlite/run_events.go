@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+// Kinds of run events.
+const (
+	RunEventWorkers    = "workers"
+	RunEventRate       = "rate"
+	RunEventPause      = "pause"
+	RunEventResume     = "resume"
+	RunEventAnnotation = "annotation"
+	RunEventStop       = "stop"
+)
+
+// AddRunEventParams is something done to a run while it was going, like a load change.
+type AddRunEventParams struct {
+	Time time.Time
+	// Event is one of the RunEvent constants.
+	Event string
+	// Value is the new number of workers or rate of workers and rate
+	// events, and 0 for the others.
+	Value float64
+	// Message is the text of an annotation, or what the event changed.
+	Message string
+	// Source is who or what caused the event, e.g. the address of the
+	// control API's client.
+	Source string
+}
+
+func createRunEventsTable(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS run_events (
+			id 				TEXT 		PRIMARY KEY,
+			run_id 			TEXT 		NOT NULL,
+			time 			DATETIME 	NOT NULL,
+			s_since_start 	INTEGER		NOT NULL,
+			ms_since_start	INTEGER 	NOT NULL,
+			event			TEXT		NOT NULL,
+			value			REAL		NOT NULL,
+			message			TEXT		NOT NULL,
+			source			TEXT		NOT NULL
+		);`
+
+	_, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "creating run_events table failed")
+	}
+
+	return nil
+}
+
+func insertIntoRunEvents(ctx context.Context, tx *sql.Tx, run *Run, params *AddRunEventParams) error {
+	query := `
+		INSERT INTO run_events (
+			id, run_id, time, s_since_start, ms_since_start, event, value, message, source)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9);`
+
+	args := []interface{}{
+		util.NewID(),
+		run.ID,
+		params.Time,
+		run.secondsSinceStart(params.Time),
+		run.millisecondsSinceStart(params.Time),
+		params.Event,
+		params.Value,
+		params.Message,
+		params.Source,
+	}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "insert into run_events failed")
+	}
+
+	return nil
+}
+
+type runEvent struct {
+	id                     string
+	runID                  string
+	time                   time.Time
+	secondsSinceStart      int
+	millisecondsSinceStart int
+	event                  string
+	value                  float64
+	message                string
+	source                 string
+}
+
+func getRunEvents(ctx context.Context, db *sql.DB) ([]*runEvent, error) {
+	query := `
+		SELECT
+			id, run_id, time, s_since_start, ms_since_start, event, value, message, source
+		FROM run_events
+		ORDER BY time;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get run events failed")
+	}
+	defer rows.Close()
+
+	results := make([]*runEvent, 0)
+	for rows.Next() {
+		r := runEvent{}
+
+		err := rows.Scan(
+			&r.id,
+			&r.runID,
+			&r.time,
+			&r.secondsSinceStart,
+			&r.millisecondsSinceStart,
+			&r.event,
+			&r.value,
+			&r.message,
+			&r.source,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - getting run events - scanning failed")
+		}
+
+		results = append(results, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - getting run events - scaning failed")
+	}
+
+	return results, nil
+}
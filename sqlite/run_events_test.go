@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunEvents(t *testing.T) {
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createRunEventsTable(ctx, tx)
+	})
+
+	run := &Run{
+		ID:        "runid",
+		StartTime: time.Now().UTC(),
+	}
+	params := &AddRunEventParams{
+		Time:    run.StartTime.Add(time.Second * 90),
+		Event:   RunEventWorkers,
+		Value:   50,
+		Message: "workers 20 -> 50",
+		Source:  "127.0.0.1:51234",
+	}
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return insertIntoRunEvents(ctx, tx, run, params)
+	})
+
+	runEvents, err := getRunEvents(context.Background(), db)
+	require.NoError(t, err)
+	require.Len(t, runEvents, 1)
+	e := runEvents[0]
+
+	require.Equal(t, run.ID, e.runID)
+	require.Equal(t, params.Time, e.time)
+	require.Equal(t, 90, e.secondsSinceStart)
+	require.Equal(t, 90000, e.millisecondsSinceStart)
+	require.Equal(t, params.Event, e.event)
+	require.Equal(t, params.Value, e.value)
+	require.Equal(t, params.Message, e.message)
+	require.Equal(t, params.Source, e.source)
+}
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+type AddRunStageParams struct {
+	StageIndex int
+	Name       string
+	StartTime  time.Time
+	Duration   time.Duration
+	Workers    int
+	Rate       float64
+	Ramp       bool
+}
+
+func createRunStagesTable(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS run_stages (
+			id 				TEXT 		PRIMARY KEY,
+			run_id 			TEXT 		NOT NULL,
+			stage_index		INTEGER		NOT NULL,
+			name 			TEXT 		NOT NULL,
+			start_time 		DATETIME 	NOT NULL,
+			s_since_start 	INTEGER		NOT NULL,
+			ms_since_start	INTEGER 	NOT NULL,
+			duration_ms		INTEGER		NOT NULL,
+			workers			INTEGER		NOT NULL,
+			rate			REAL		NOT NULL,
+			ramp			INTEGER		NOT NULL
+		);`
+
+	_, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "creating run_stages table failed")
+	}
+
+	return nil
+}
+
+func insertIntoRunStages(ctx context.Context, tx *sql.Tx, run *Run, params *AddRunStageParams) error {
+	query := `
+		INSERT INTO run_stages (
+			id, run_id, stage_index, name, start_time, s_since_start, ms_since_start,
+			duration_ms, workers, rate, ramp)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`
+
+	args := []interface{}{
+		util.NewID(),
+		run.ID,
+		params.StageIndex,
+		params.Name,
+		params.StartTime,
+		run.secondsSinceStart(params.StartTime),
+		run.millisecondsSinceStart(params.StartTime),
+		params.Duration / time.Millisecond,
+		params.Workers,
+		params.Rate,
+		params.Ramp,
+	}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "insert into run_stages failed")
+	}
+
+	return nil
+}
+
+type runStage struct {
+	id                     string
+	runID                  string
+	stageIndex             int
+	name                   string
+	startTime              time.Time
+	secondsSinceStart      int
+	millisecondsSinceStart int
+	durationMs             int
+	workers                int
+	rate                   float64
+	ramp                   bool
+}
+
+func getRunStages(ctx context.Context, db *sql.DB) ([]*runStage, error) {
+	query := `
+		SELECT
+			id, run_id, stage_index, name, start_time, s_since_start, ms_since_start,
+			duration_ms, workers, rate, ramp
+		FROM run_stages;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get run stages failed")
+	}
+	defer rows.Close()
+
+	results := make([]*runStage, 0)
+	for rows.Next() {
+		r := runStage{}
+
+		err := rows.Scan(
+			&r.id,
+			&r.runID,
+			&r.stageIndex,
+			&r.name,
+			&r.startTime,
+			&r.secondsSinceStart,
+			&r.millisecondsSinceStart,
+			&r.durationMs,
+			&r.workers,
+			&r.rate,
+			&r.ramp,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - getting run stages - scanning failed")
+		}
+
+		results = append(results, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - getting run stages - scaning failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunStages(t *testing.T) {
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createRunStagesTable(ctx, tx)
+	})
+
+	run := &Run{
+		ID:        "runid",
+		StartTime: time.Now().UTC(),
+	}
+	params := &AddRunStageParams{
+		StageIndex: 2,
+		Name:       "ramp up",
+		StartTime:  run.StartTime.Add(time.Minute),
+		Duration:   time.Minute * 5,
+		Workers:    200,
+		Ramp:       true,
+	}
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return insertIntoRunStages(ctx, tx, run, params)
+	})
+
+	runStages, err := getRunStages(context.Background(), db)
+	require.NoError(t, err)
+	require.Len(t, runStages, 1)
+	s := runStages[0]
+
+	require.Equal(t, run.ID, s.runID)
+	require.Equal(t, params.StageIndex, s.stageIndex)
+	require.Equal(t, params.Name, s.name)
+	require.Equal(t, params.StartTime, s.startTime)
+	require.Equal(t, 60, s.secondsSinceStart)
+	require.Equal(t, 60000, s.millisecondsSinceStart)
+	require.Equal(t, 300000, s.durationMs)
+	require.Equal(t, params.Workers, s.workers)
+	require.Equal(t, params.Rate, s.rate)
+	require.True(t, s.ramp)
+}
@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RunStats summarizes the client requests of a run, from their intended start times.
+type RunStats struct {
+	Requests  int
+	Failures  int
+	ErrorRate float64
+	P50       time.Duration
+	P99       time.Duration
+	// Throughput is the number of successful requests per second between the
+	// run's start and end time.
+	Throughput float64
+}
+
+func getRunStats(ctx context.Context, db *sql.DB, runID string) (*RunStats, error) {
+	var startTime time.Time
+	var endTime *time.Time
+	err := db.QueryRowContext(ctx, `
+		SELECT start_time, end_time
+		FROM runs
+		WHERE id = $1;`, runID).Scan(&startTime, &endTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get run stats failed - getting run failed")
+	}
+
+	query := `
+		SELECT duration_ms + queue_delay_ms, success
+		FROM client_requests
+		WHERE run_id = $1
+		ORDER BY 1;`
+	rows, err := db.QueryContext(ctx, query, runID)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get run stats failed")
+	}
+	defer rows.Close()
+
+	latenciesMs := make([]int, 0)
+	stats := &RunStats{}
+	for rows.Next() {
+		var latencyMs int
+		var success bool
+		err := rows.Scan(&latencyMs, &success)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - get run stats failed - scanning failed")
+		}
+
+		latenciesMs = append(latenciesMs, latencyMs)
+		if !success {
+			stats.Failures++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - get run stats failed - scaning failed")
+	}
+
+	stats.Requests = len(latenciesMs)
+	if stats.Requests == 0 {
+		return stats, nil
+	}
+
+	stats.ErrorRate = float64(stats.Failures) / float64(stats.Requests)
+	stats.P50 = time.Duration(percentile(latenciesMs, 0.5)) * time.Millisecond
+	stats.P99 = time.Duration(percentile(latenciesMs, 0.99)) * time.Millisecond
+
+	if endTime != nil && endTime.After(startTime) {
+		successes := stats.Requests - stats.Failures
+		stats.Throughput = float64(successes) / endTime.Sub(startTime).Seconds()
+	}
+
+	return stats, nil
+}
+
+// percentile returns the value at percentile p (0 to 1) of sorted values.
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(float64(len(sorted))*p)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
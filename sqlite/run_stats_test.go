@@ -0,0 +1,96 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunStats(t *testing.T) {
+	ctx := context.Background()
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		err := createRunsTable(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return createClientRequestsTable(ctx, tx)
+	})
+
+	startTime := time.Now().UTC()
+	run := &Run{
+		ID:        "runid",
+		StartTime: startTime,
+	}
+	err := insertIntoRuns(ctx, db, &AddRunParams{
+		ID:        run.ID,
+		StartTime: startTime,
+	})
+	require.NoError(t, err)
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		for i := 1; i <= 100; i++ {
+			intendedStartTime := startTime.Add(time.Duration(i) * time.Millisecond * 10)
+			err := insertIntoClientRequests(ctx, tx, run, &AddRequestParams{
+				IntendedStartTime: intendedStartTime,
+				StartTime:         intendedStartTime.Add(time.Millisecond),
+				EndTime:           intendedStartTime.Add(time.Duration(i) * time.Millisecond),
+				Success:           i%10 != 0,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	err = updateRunEnd(ctx, db, &RunEndParams{
+		RunID:   run.ID,
+		EndTime: startTime.Add(time.Second * 10),
+		Status:  RunStatusCompleted,
+	})
+	require.NoError(t, err)
+
+	stats, err := getRunStats(ctx, db, run.ID)
+	require.NoError(t, err)
+	require.Equal(t, 100, stats.Requests)
+	require.Equal(t, 10, stats.Failures)
+	require.Equal(t, 0.1, stats.ErrorRate)
+	require.Equal(t, time.Millisecond*50, stats.P50)
+	require.Equal(t, time.Millisecond*99, stats.P99)
+	require.Equal(t, 9.0, stats.Throughput)
+}
+
+func TestRunStatsWithoutRequests(t *testing.T) {
+	ctx := context.Background()
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		err := createRunsTable(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return createClientRequestsTable(ctx, tx)
+	})
+
+	err := insertIntoRuns(ctx, db, &AddRunParams{
+		ID:        "runid",
+		StartTime: time.Now().UTC(),
+	})
+	require.NoError(t, err)
+
+	stats, err := getRunStats(ctx, db, "runid")
+	require.NoError(t, err)
+	require.Equal(t, 0, stats.Requests)
+	require.Equal(t, 0.0, stats.Throughput)
+
+	_, err = getRunStats(ctx, db, "missing")
+	require.Error(t, err)
+}
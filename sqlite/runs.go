@@ -3,16 +3,68 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+// Statuses of a run.
+const (
+	RunStatusRunning   = "running"
+	RunStatusCompleted = "completed"
+	// RunStatusAborted is a run that was stopped before it was over, e.g.
+	// with Ctrl-C. Its abort_reason says why.
+	RunStatusAborted = "aborted"
+	// RunStatusFailed is a run whose process exited without finishing it,
+	// like one that crashed or was killed.
+	RunStatusFailed = "failed"
+)
+
 type AddRunParams struct {
-	ID         string
-	StartTime  time.Time
-	Desc       string
-	NumWorkers int
+	ID          string
+	StartTime   time.Time
+	Desc        string
+	NumWorkers  int
+	ArrivalRate float64
+	// ExperimentID groups the runs of a search or sweep. It is empty for
+	// standalone runs.
+	ExperimentID string
+	// Scenario is the serialized scenario the run was started from.
+	Scenario string
+	// ClientSettings are the JSON encoded connection settings of the HTTP
+	// client.
+	ClientSettings string
+	// Transport is what the client connected over, tcp or unix.
+	Transport string
+	// ProcessID and Host identify the process running the run, so a run
+	// left running by a process that is gone can be detected.
+	ProcessID int
+	Host      string
+}
+
+// RunEndParams is how a run ended.
+type RunEndParams struct {
+	RunID   string
+	EndTime time.Time
+	// Status is one of the RunStatus constants.
+	Status string
+	// AbortReason says why an aborted run was stopped.
+	AbortReason string
+	// AbortRule is the abort rule that stopped the run, if one did, and
+	// AbortTime is when the run was told to stop. It is zero unless the run
+	// was aborted.
+	AbortRule string
+	AbortTime time.Time
+}
+
+// RunStatus is how a run ended, or that it hasn't.
+type RunStatus struct {
+	Status      string
+	AbortReason string
+	AbortRule   string
+	AbortTime   *time.Time
+	EndTime     *time.Time
 }
 
 func createRunsTable(ctx context.Context, tx *sql.Tx) error {
@@ -22,7 +74,18 @@ func createRunsTable(ctx context.Context, tx *sql.Tx) error {
 			start_time 		DATETIME 	NOT NULL,
 			end_time 		DATETIME,
 			desc 			TEXT,
-			num_workers 	INTEGER
+			num_workers 	INTEGER,
+			arrival_rate 	REAL,
+			experiment_id 	TEXT,
+			scenario 		TEXT,
+			client_settings	TEXT,
+			transport 		TEXT,
+			status 			TEXT,
+			abort_reason 	TEXT,
+			abort_rule 		TEXT,
+			abort_time 		DATETIME,
+			pid 			INTEGER,
+			host 			TEXT
 		);`
 
 	_, err := tx.ExecContext(ctx, query)
@@ -30,19 +93,41 @@ func createRunsTable(ctx context.Context, tx *sql.Tx) error {
 		return errors.Wrap(err, "creating runs table failed")
 	}
 
+	query = `
+		CREATE INDEX IF NOT EXISTS runs_experiment_id
+		ON runs (experiment_id);`
+
+	_, err = tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "creating runs experiment_id index failed")
+	}
+
 	return nil
 }
 
 func insertIntoRuns(ctx context.Context, db *sql.DB, params *AddRunParams) error {
 	query := `
-		INSERT INTO runs (id, start_time, desc, num_workers)		
-		VALUES ($1, $2, $3, $4);`
+		INSERT INTO runs (id, start_time, desc, num_workers, arrival_rate, experiment_id, scenario, client_settings, transport, status, pid, host)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
+
+	var experimentID *string
+	if params.ExperimentID != "" {
+		experimentID = &params.ExperimentID
+	}
 
 	args := []interface{}{
 		params.ID,
 		params.StartTime,
 		params.Desc,
 		params.NumWorkers,
+		params.ArrivalRate,
+		experimentID,
+		params.Scenario,
+		params.ClientSettings,
+		params.Transport,
+		RunStatusRunning,
+		params.ProcessID,
+		params.Host,
 	}
 
 	_, err := db.ExecContext(ctx, query, args...)
@@ -53,32 +138,155 @@ func insertIntoRuns(ctx context.Context, db *sql.DB, params *AddRunParams) error
 	return nil
 }
 
-func updateRunEndTime(ctx context.Context, db *sql.DB, runID string, endTime time.Time) error {
+func updateRunEnd(ctx context.Context, db *sql.DB, params *RunEndParams) error {
 	query := `
 		UPDATE runs
-		SET end_time = $1
-		WHERE id = $2;`
-	args := []interface{}{endTime, runID}
+		SET end_time = $1, status = $2, abort_reason = $3, abort_rule = $4, abort_time = $5
+		WHERE id = $6;`
+
+	var abortReason, abortRule *string
+	if params.AbortReason != "" {
+		abortReason = &params.AbortReason
+	}
+	if params.AbortRule != "" {
+		abortRule = &params.AbortRule
+	}
+	var abortTime *time.Time
+	if !params.AbortTime.IsZero() {
+		abortTime = &params.AbortTime
+	}
+	args := []interface{}{params.EndTime, params.Status, abortReason, abortRule, abortTime, params.RunID}
 
 	_, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
-		return errors.Wrap(err, "update end time run failed")
+		return errors.Wrap(err, "update run end failed")
 	}
 
 	return nil
 }
 
+// markStaleRuns marks the runs on host whose process is gone as failed.
+func markStaleRuns(ctx context.Context, db *sql.DB, host string, processExists func(pid int) bool) ([]string, error) {
+	query := `
+		SELECT id, pid
+		FROM runs
+		WHERE status = $1 AND host = $2;`
+	rows, err := db.QueryContext(ctx, query, RunStatusRunning, host)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get running runs failed")
+	}
+
+	staleRunIDs := make([]string, 0)
+	staleRunPIDs := make([]int, 0)
+	for rows.Next() {
+		var id string
+		var pid int
+		err := rows.Scan(&id, &pid)
+		if err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "db - get running runs failed - scanning failed")
+		}
+
+		if !processExists(pid) {
+			staleRunIDs = append(staleRunIDs, id)
+			staleRunPIDs = append(staleRunPIDs, pid)
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get running runs failed - scaning failed")
+	}
+
+	query = `
+		UPDATE runs
+		SET status = $1, abort_reason = $2
+		WHERE id = $3 AND status = $4;`
+	for i, id := range staleRunIDs {
+		reason := fmt.Sprintf("process %d on %s exited without finishing the run", staleRunPIDs[i], host)
+		_, err := db.ExecContext(ctx, query, RunStatusFailed, reason, id, RunStatusRunning)
+		if err != nil {
+			return nil, errors.Wrap(err, "marking stale run failed")
+		}
+	}
+
+	return staleRunIDs, nil
+}
+
+func getRunStatus(ctx context.Context, db *sql.DB, runID string) (*RunStatus, error) {
+	query := `
+		SELECT status, abort_reason, abort_rule, abort_time, end_time
+		FROM runs
+		WHERE id = $1;`
+
+	var status, abortReason, abortRule *string
+	result := &RunStatus{}
+	err := db.QueryRowContext(ctx, query, runID).Scan(&status, &abortReason, &abortRule, &result.AbortTime, &result.EndTime)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get run status failed")
+	}
+	if status != nil {
+		result.Status = *status
+	}
+	if abortReason != nil {
+		result.AbortReason = *abortReason
+	}
+	if abortRule != nil {
+		result.AbortRule = *abortRule
+	}
+
+	return result, nil
+}
+
+func getExperimentRunIDs(ctx context.Context, db *sql.DB, experimentID string) ([]string, error) {
+	query := `
+		SELECT id
+		FROM runs
+		WHERE experiment_id = $1
+		ORDER BY start_time;`
+	rows, err := db.QueryContext(ctx, query, experimentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get experiment run ids failed")
+	}
+	defer rows.Close()
+
+	results := make([]string, 0)
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - get experiment run ids failed - scanning failed")
+		}
+
+		results = append(results, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - get experiment run ids failed - scaning failed")
+	}
+
+	return results, nil
+}
+
 type run struct {
-	id         string
-	startTime  time.Time
-	endTime    *time.Time
-	desc       *string
-	numWorkers *int
+	id             string
+	startTime      time.Time
+	endTime        *time.Time
+	desc           *string
+	numWorkers     *int
+	arrivalRate    *float64
+	experimentID   *string
+	scenario       *string
+	clientSettings *string
+	transport      *string
+	status         *string
+	abortReason    *string
+	pid            *int
+	host           *string
 }
 
 func getRuns(ctx context.Context, db *sql.DB) ([]*run, error) {
 	query := `
-		SELECT id, start_time, end_time, desc, num_workers
+		SELECT id, start_time, end_time, desc, num_workers, arrival_rate, experiment_id, scenario, client_settings, transport, status, abort_reason, pid, host
 		FROM runs;`
 	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
@@ -95,7 +303,16 @@ func getRuns(ctx context.Context, db *sql.DB) ([]*run, error) {
 			&r.startTime,
 			&r.endTime,
 			&r.desc,
-			&r.numWorkers)
+			&r.numWorkers,
+			&r.arrivalRate,
+			&r.experimentID,
+			&r.scenario,
+			&r.clientSettings,
+			&r.transport,
+			&r.status,
+			&r.abortReason,
+			&r.pid,
+			&r.host)
 		if err != nil {
 			return nil, errors.Wrap(err, "db - get runs failed - scanning failed")
 		}
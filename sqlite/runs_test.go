@@ -21,10 +21,17 @@ func TestRuns(t *testing.T) {
 
 	startTime := time.Now().UTC()
 	params := &AddRunParams{
-		ID:         "runid",
-		StartTime:  startTime,
-		Desc:       "test desc",
-		NumWorkers: 3,
+		ID:             "runid",
+		StartTime:      startTime,
+		Desc:           "test desc",
+		NumWorkers:     3,
+		ArrivalRate:    12.5,
+		ExperimentID:   "experimentid",
+		Scenario:       "load:\n  workers: 3\n",
+		ClientSettings: `{"per_worker":true}`,
+		Transport:      "unix",
+		ProcessID:      1234,
+		Host:           "testhost",
 	}
 
 	err := insertIntoRuns(ctx, db, params)
@@ -41,10 +48,35 @@ func TestRuns(t *testing.T) {
 	require.Equal(t, params.Desc, *r.desc)
 	require.NotNil(t, r.numWorkers)
 	require.Equal(t, params.NumWorkers, *r.numWorkers)
+	require.NotNil(t, r.arrivalRate)
+	require.Equal(t, params.ArrivalRate, *r.arrivalRate)
+	require.NotNil(t, r.experimentID)
+	require.Equal(t, params.ExperimentID, *r.experimentID)
+	require.NotNil(t, r.scenario)
+	require.Equal(t, params.Scenario, *r.scenario)
+	require.NotNil(t, r.clientSettings)
+	require.Equal(t, params.ClientSettings, *r.clientSettings)
+	require.NotNil(t, r.transport)
+	require.Equal(t, params.Transport, *r.transport)
+	require.NotNil(t, r.status)
+	require.Equal(t, RunStatusRunning, *r.status)
+	require.Nil(t, r.abortReason)
+	require.NotNil(t, r.pid)
+	require.Equal(t, params.ProcessID, *r.pid)
+	require.NotNil(t, r.host)
+	require.Equal(t, params.Host, *r.host)
 	require.Nil(t, r.endTime)
 
 	endTime := startTime.Add(time.Second * 30)
-	err = updateRunEndTime(ctx, db, params.ID, endTime)
+	abortTime := endTime.Add(-time.Second)
+	err = updateRunEnd(ctx, db, &RunEndParams{
+		RunID:       params.ID,
+		EndTime:     endTime,
+		Status:      RunStatusAborted,
+		AbortReason: "error_rate>5% - it was 12.50% over the last 30s",
+		AbortRule:   "error_rate>5%",
+		AbortTime:   abortTime,
+	})
 	require.NoError(t, err)
 
 	runs, err = getRuns(context.Background(), db)
@@ -55,4 +87,94 @@ func TestRuns(t *testing.T) {
 	require.Equal(t, params.ID, r.id)
 	require.NotNil(t, r.endTime)
 	require.Equal(t, endTime, *r.endTime)
+
+	status, err := getRunStatus(ctx, db, params.ID)
+	require.NoError(t, err)
+	require.Equal(t, &RunStatus{
+		Status:      RunStatusAborted,
+		AbortReason: "error_rate>5% - it was 12.50% over the last 30s",
+		AbortRule:   "error_rate>5%",
+		AbortTime:   &abortTime,
+		EndTime:     &endTime,
+	}, status)
+}
+
+func TestMarkStaleRuns(t *testing.T) {
+	ctx := context.Background()
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createRunsTable(ctx, tx)
+	})
+
+	startTime := time.Now().UTC()
+	runs := []*AddRunParams{
+		{ID: "alive", ProcessID: 1, Host: "testhost"},
+		{ID: "crashed", ProcessID: 2, Host: "testhost"},
+		{ID: "finished", ProcessID: 3, Host: "testhost"},
+		{ID: "otherhost", ProcessID: 4, Host: "otherhost"},
+	}
+	for _, params := range runs {
+		params.StartTime = startTime
+		err := insertIntoRuns(ctx, db, params)
+		require.NoError(t, err)
+	}
+	err := updateRunEnd(ctx, db, &RunEndParams{
+		RunID:   "finished",
+		EndTime: startTime,
+		Status:  RunStatusCompleted,
+	})
+	require.NoError(t, err)
+
+	processExists := func(pid int) bool {
+		return pid == 1
+	}
+	staleRunIDs, err := markStaleRuns(ctx, db, "testhost", processExists)
+	require.NoError(t, err)
+	require.Equal(t, []string{"crashed"}, staleRunIDs)
+
+	for id, want := range map[string]string{
+		"alive":     RunStatusRunning,
+		"crashed":   RunStatusFailed,
+		"finished":  RunStatusCompleted,
+		"otherhost": RunStatusRunning,
+	} {
+		status, err := getRunStatus(ctx, db, id)
+		require.NoError(t, err)
+		require.Equal(t, want, status.Status, id)
+	}
+
+	status, err := getRunStatus(ctx, db, "crashed")
+	require.NoError(t, err)
+	require.Equal(t, "process 2 on testhost exited without finishing the run", status.AbortReason)
+	require.Nil(t, status.EndTime)
+}
+
+func TestExperimentRunIDs(t *testing.T) {
+	ctx := context.Background()
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createRunsTable(ctx, tx)
+	})
+
+	startTime := time.Now().UTC()
+	for i, id := range []string{"second", "first", "other"} {
+		experimentID := "experimentid"
+		if id == "other" {
+			experimentID = ""
+		}
+		err := insertIntoRuns(ctx, db, &AddRunParams{
+			ID:           id,
+			StartTime:    startTime.Add(-time.Duration(i) * time.Minute),
+			ExperimentID: experimentID,
+		})
+		require.NoError(t, err)
+	}
+
+	runIDs, err := getExperimentRunIDs(ctx, db, "experimentid")
+	require.NoError(t, err)
+	require.Equal(t, []string{"first", "second"}, runIDs)
 }
@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+type AddSearchProbeParams struct {
+	ExperimentID string
+	RunID        string
+	ProbeIndex   int
+	Load         float64
+	Passed       bool
+	Reason       string
+	Stats        *RunStats
+}
+
+func createSearchProbesTable(ctx context.Context, tx *sql.Tx) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS search_probes (
+			id 				TEXT 		PRIMARY KEY,
+			experiment_id 	TEXT 		NOT NULL,
+			run_id 			TEXT 		NOT NULL,
+			probe_index		INTEGER		NOT NULL,
+			load 			REAL 		NOT NULL,
+			passed 			INTEGER 	NOT NULL,
+			reason 			TEXT 		NOT NULL,
+
+			requests 		INTEGER 	NOT NULL,
+			error_rate 		REAL 		NOT NULL,
+			p50_ms 			INTEGER 	NOT NULL,
+			p99_ms 			INTEGER 	NOT NULL,
+			throughput 		REAL 		NOT NULL
+		);`
+
+	_, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "creating search_probes table failed")
+	}
+
+	return nil
+}
+
+func insertIntoSearchProbes(ctx context.Context, db *sql.DB, params *AddSearchProbeParams) error {
+	query := `
+		INSERT INTO search_probes (
+			id, experiment_id, run_id, probe_index, load, passed, reason,
+			requests, error_rate, p50_ms, p99_ms, throughput)
+		VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
+
+	stats := params.Stats
+	if stats == nil {
+		stats = &RunStats{}
+	}
+
+	args := []interface{}{
+		util.NewID(),
+		params.ExperimentID,
+		params.RunID,
+		params.ProbeIndex,
+		params.Load,
+		params.Passed,
+		params.Reason,
+
+		stats.Requests,
+		stats.ErrorRate,
+		stats.P50 / time.Millisecond,
+		stats.P99 / time.Millisecond,
+		stats.Throughput,
+	}
+
+	_, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "insert into search_probes failed")
+	}
+
+	return nil
+}
+
+type searchProbe struct {
+	id           string
+	experimentID string
+	runID        string
+	probeIndex   int
+	load         float64
+	passed       bool
+	reason       string
+	requests     int
+	errorRate    float64
+	p50Ms        int
+	p99Ms        int
+	throughput   float64
+}
+
+func getSearchProbes(ctx context.Context, db *sql.DB) ([]*searchProbe, error) {
+	query := `
+		SELECT
+			id, experiment_id, run_id, probe_index, load, passed, reason,
+			requests, error_rate, p50_ms, p99_ms, throughput
+		FROM search_probes;`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "db - get search probes failed")
+	}
+	defer rows.Close()
+
+	results := make([]*searchProbe, 0)
+	for rows.Next() {
+		r := searchProbe{}
+
+		err := rows.Scan(
+			&r.id,
+			&r.experimentID,
+			&r.runID,
+			&r.probeIndex,
+			&r.load,
+			&r.passed,
+			&r.reason,
+			&r.requests,
+			&r.errorRate,
+			&r.p50Ms,
+			&r.p99Ms,
+			&r.throughput,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "db - getting search probes - scanning failed")
+		}
+
+		results = append(results, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "db - getting search probes - scaning failed")
+	}
+
+	return results, nil
+}
@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchProbes(t *testing.T) {
+	ctx := context.Background()
+	db := newInMemoryDb(t)
+	defer db.Close()
+
+	testInTransaction(t, db, func(ctx context.Context, tx *sql.Tx) error {
+		return createSearchProbesTable(ctx, tx)
+	})
+
+	params := &AddSearchProbeParams{
+		ExperimentID: "experimentid",
+		RunID:        "runid",
+		ProbeIndex:   3,
+		Load:         40,
+		Passed:       false,
+		Reason:       "p99 latency 1.2s is above 500ms",
+		Stats: &RunStats{
+			Requests:   1000,
+			Failures:   10,
+			ErrorRate:  0.01,
+			P50:        time.Millisecond * 120,
+			P99:        time.Millisecond * 1200,
+			Throughput: 16.5,
+		},
+	}
+	err := insertIntoSearchProbes(ctx, db, params)
+	require.NoError(t, err)
+
+	probes, err := getSearchProbes(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, probes, 1)
+	p := probes[0]
+
+	require.Equal(t, params.ExperimentID, p.experimentID)
+	require.Equal(t, params.RunID, p.runID)
+	require.Equal(t, params.ProbeIndex, p.probeIndex)
+	require.Equal(t, params.Load, p.load)
+	require.False(t, p.passed)
+	require.Equal(t, params.Reason, p.reason)
+	require.Equal(t, 1000, p.requests)
+	require.Equal(t, 0.01, p.errorRate)
+	require.Equal(t, 120, p.p50Ms)
+	require.Equal(t, 1200, p.p99Ms)
+	require.Equal(t, 16.5, p.throughput)
+}
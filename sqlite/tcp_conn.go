@@ -12,6 +12,10 @@ import (
 type AddTCPConnParams struct {
 	RunID string
 	Time  time.Time
+	// ProcessID and ProcessName are the process whose connections were
+	// counted.
+	ProcessID   uint32
+	ProcessName string
 
 	Established int
 	SynSent     int
@@ -32,6 +36,8 @@ func createTCPConnsTable(ctx context.Context, tx *sql.Tx) error {
 			id 				TEXT 		PRIMARY KEY,
 			run_id 			TEXT 		NOT NULL,
 			time 			DATETIME 	NOT NULL,
+			process_id		INTEGER		NOT NULL,
+			process_name	TEXT		NOT NULL,
 
 			established 	INTEGER 	NOT NULL,
 			syn_sent		INTEGER		NOT NULL,
@@ -57,16 +63,18 @@ func createTCPConnsTable(ctx context.Context, tx *sql.Tx) error {
 func insertIntoTCPConns(ctx context.Context, tx *sql.Tx, params *AddTCPConnParams) error {
 	query := `
 		INSERT INTO tcp_conns (
-			id, run_id, time, established, syn_sent, 
+			id, run_id, time, process_id, process_name, established, syn_sent, 
 			syn_recv, fin_wait_1, fin_wait_2, time_wait, close, close_wait,
 			last_ack, listen, closing)
 		VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14);`
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16);`
 
 	args := []interface{}{
 		util.NewID(),
 		params.RunID,
 		params.Time,
+		params.ProcessID,
+		params.ProcessName,
 
 		params.Established,
 		params.SynSent,
@@ -93,6 +101,8 @@ type tcpConn struct {
 	id          string
 	runID       string
 	time        time.Time
+	processID   uint32
+	processName string
 	established int
 	synSent     int
 	synRecv     int
@@ -109,7 +119,7 @@ type tcpConn struct {
 func getTCPConns(ctx context.Context, db *sql.DB) ([]*tcpConn, error) {
 	query := `
 		SELECT 
-			id, run_id, time, established, syn_sent, 
+			id, run_id, time, process_id, process_name, established, syn_sent, 
 			syn_recv, fin_wait_1, fin_wait_2, time_wait, close, close_wait,
 			last_ack, listen, closing
 		FROM tcp_conns;`
@@ -127,6 +137,8 @@ func getTCPConns(ctx context.Context, db *sql.DB) ([]*tcpConn, error) {
 			&r.id,
 			&r.runID,
 			&r.time,
+			&r.processID,
+			&r.processName,
 			&r.established,
 			&r.synSent,
 			&r.synRecv,
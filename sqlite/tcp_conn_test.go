@@ -21,6 +21,8 @@ func TestTCPConns(t *testing.T) {
 	params := &AddTCPConnParams{
 		Time:        time.Now().UTC(),
 		RunID:       "runid",
+		ProcessID:   1234,
+		ProcessName: "server",
 		Established: 1,
 		SynSent:     2,
 		SynRecv:     3,
@@ -44,6 +46,8 @@ func TestTCPConns(t *testing.T) {
 
 	require.Equal(t, params.Time, c.time)
 	require.Equal(t, params.RunID, c.runID)
+	require.Equal(t, params.ProcessID, c.processID)
+	require.Equal(t, params.ProcessName, c.processName)
 	require.Equal(t, params.Established, c.established)
 	require.Equal(t, params.SynSent, c.synSent)
 	require.Equal(t, params.SynRecv, c.synRecv)
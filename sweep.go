@@ -0,0 +1,177 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+)
+
+type SweepConfig struct {
+	// Run is the configuration every run of the sweep starts from. Each run
+	// gets a new RunID and one of WorkerCounts as its NumWorkers.
+	Run          TestConfig
+	SweepID      string
+	Desc         string
+	WorkerCounts []int
+	// Cooldown is how long to wait between runs.
+	Cooldown time.Duration
+}
+
+// SweepWorkers runs config.Run once per worker count and returns the run IDs in order.
+func SweepWorkers(ctx context.Context, config *SweepConfig, f SendRequestFunc) (runIDs []string, err error) {
+	if len(config.WorkerCounts) == 0 {
+		return nil, errors.New("sweep needs at least one worker count")
+	}
+	if config.Run.Controller != nil {
+		return nil, errors.New("sweep runs fixed worker counts, so it can't use the controller")
+	}
+	if len(config.Run.Schedule) > 0 {
+		return nil, errors.New("a replayed log is used up by the first run, so a sweep can't replay one")
+	}
+
+	// Stopping the sweep shouldn't stop how it ended from being saved.
+	writeCtx := context.WithoutCancel(ctx)
+
+	data, err := sqlite.NewDataStore(config.Run.DBFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	err = data.CreateTables(writeCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = data.WriteExperimentStart(writeCtx, &sqlite.AddExperimentParams{
+		ID:        config.SweepID,
+		Kind:      sqlite.ExperimentKindSweep,
+		StartTime: time.Now().UTC(),
+		Desc:      config.Desc,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		endErr := data.WriteExperimentEnd(writeCtx, experimentEnd(ctx, config.SweepID, err))
+		if err == nil && endErr != nil {
+			runIDs, err = nil, endErr
+		}
+	}()
+
+	runIDs = make([]string, 0, len(config.WorkerCounts))
+	for i, numWorkers := range config.WorkerCounts {
+		if i > 0 {
+			err = cooldown(ctx, config.Cooldown)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		runConfig := config.Run
+		runConfig.RunID = util.NewID()
+		runConfig.ExperimentID = config.SweepID
+		runConfig.NumWorkers = numWorkers
+		runConfig.Stages = nil
+		runConfig.Desc = fmt.Sprintf("sweep run %d: %d workers", i, numWorkers)
+
+		log.Println(runConfig.Desc)
+		// A run stopped by an abort rule is recorded as aborted, and the
+		// sweep goes on.
+		err = GenerateLoad(ctx, &runConfig, f)
+		abortErr, aborted := errors.Cause(err).(*AbortError)
+		if aborted && abortErr.Rule != "" {
+			log.Println(err)
+		} else if err != nil {
+			return nil, err
+		}
+		runIDs = append(runIDs, runConfig.RunID)
+	}
+
+	return runIDs, nil
+}
+
+// cooldown waits d between runs, unless ctx is cancelled first.
+func cooldown(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(context.Cause(ctx), "cooldown interrupted")
+	}
+}
+
+// ParseWorkerCounts parses worker counts and ranges like "1,2,5" or "10-100:10".
+func ParseWorkerCounts(s string) ([]int, error) {
+	counts := make([]int, 0)
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if !strings.Contains(part, "-") {
+			count, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid worker count %q", part)
+			}
+			counts = append(counts, count)
+			continue
+		}
+
+		step := 1
+		rangeSpec := part
+		if i := strings.Index(part, ":"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return nil, errors.Errorf("invalid step in worker count range %q", part)
+			}
+			rangeSpec = part[:i]
+		}
+
+		bounds := strings.SplitN(rangeSpec, "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid start of worker count range %q", part)
+		}
+		to, err := strconv.Atoi(bounds[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid end of worker count range %q", part)
+		}
+		if to < from {
+			return nil, errors.Errorf("worker count range %q ends before it starts", part)
+		}
+
+		for count := from; count <= to; count += step {
+			counts = append(counts, count)
+		}
+	}
+
+	for _, count := range counts {
+		if count <= 0 {
+			return nil, errors.Errorf("worker counts should be positive, got %d", count)
+		}
+	}
+	if len(counts) == 0 {
+		return nil, errors.Errorf("no worker counts in %q", s)
+	}
+
+	return counts, nil
+}
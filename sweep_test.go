@@ -0,0 +1,108 @@
+package webservice_benchmarks
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWorkerCounts(t *testing.T) {
+	counts, err := ParseWorkerCounts("1,2,5")
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 5}, counts)
+
+	counts, err = ParseWorkerCounts("10-50:20, 100")
+	require.NoError(t, err)
+	require.Equal(t, []int{10, 30, 50, 100}, counts)
+
+	counts, err = ParseWorkerCounts("3-5")
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 4, 5}, counts)
+
+	for _, s := range []string{"", "x", "0", "5-3", "1-x", "1-5:0", "-1"} {
+		_, err = ParseWorkerCounts(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestSweepWorkers(t *testing.T) {
+	ctx := context.Background()
+	config := &SweepConfig{
+		Run: TestConfig{
+			DBFilePath:   filepath.Join(t.TempDir(), "sweep.db"),
+			TestDuration: time.Millisecond * 200,
+		},
+		SweepID:      util.NewID(),
+		WorkerCounts: []int{1, 3},
+	}
+
+	runIDs, err := SweepWorkers(ctx, config, failFromWorker(10))
+	require.NoError(t, err)
+	require.Len(t, runIDs, 2)
+
+	data, err := sqlite.NewDataStore(config.Run.DBFilePath)
+	require.NoError(t, err)
+	defer data.Close()
+
+	experimentRunIDs, err := data.GetExperimentRunIDs(ctx, config.SweepID)
+	require.NoError(t, err)
+	require.Equal(t, runIDs, experimentRunIDs)
+
+	status, err := data.GetExperimentStatus(ctx, config.SweepID)
+	require.NoError(t, err)
+	require.Equal(t, sqlite.RunStatusCompleted, status.Status)
+}
+
+func TestSweepWorkersCancelledInCooldown(t *testing.T) {
+	config := &SweepConfig{
+		Run: TestConfig{
+			DBFilePath:   filepath.Join(t.TempDir(), "sweep.db"),
+			TestDuration: time.Millisecond * 100,
+		},
+		SweepID:      util.NewID(),
+		WorkerCounts: []int{1, 3},
+		Cooldown:     time.Second * 30,
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(time.Millisecond*500, func() {
+		cancel(errors.New("received signal interrupt"))
+	})
+
+	_, err := SweepWorkers(ctx, config, failFromWorker(10))
+	require.EqualError(t, err, "cooldown interrupted: received signal interrupt")
+
+	status := getTestExperimentStatus(t, config.Run.DBFilePath, config.SweepID)
+	require.Equal(t, sqlite.RunStatusAborted, status.Status)
+	require.Equal(t, "received signal interrupt", status.Error)
+	require.NotNil(t, status.EndTime)
+
+	data, err := sqlite.NewDataStore(config.Run.DBFilePath)
+	require.NoError(t, err)
+	defer data.Close()
+
+	runIDs, err := data.GetExperimentRunIDs(context.Background(), config.SweepID)
+	require.NoError(t, err)
+	require.Len(t, runIDs, 1)
+}
+
+func TestSweepWorkersReplay(t *testing.T) {
+	config := &SweepConfig{
+		Run: TestConfig{
+			DBFilePath:   filepath.Join(t.TempDir(), "sweep.db"),
+			TestDuration: time.Millisecond * 100,
+			Schedule:     []time.Duration{0, time.Second},
+		},
+		SweepID:      util.NewID(),
+		WorkerCounts: []int{1, 3},
+	}
+
+	_, err := SweepWorkers(context.Background(), config, failFromWorker(10))
+	require.EqualError(t, err, "a replayed log is used up by the first run, so a sweep can't replay one")
+}
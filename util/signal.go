@@ -0,0 +1,50 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// SignalContext returns a context cancelled on SIGINT or SIGTERM; a second signal exits.
+func SignalContext(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	stopped := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(stopped)
+			cancel(context.Canceled)
+		})
+	}
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Println(fmt.Sprintf("received %v, stopping - send it again to exit right away", sig))
+			cancel(errors.Errorf("received signal %v", sig))
+		case <-stopped:
+			return
+		}
+
+		select {
+		case sig := <-signals:
+			log.Println(fmt.Sprintf("received %v again, exiting", sig))
+			os.Exit(1)
+		case <-stopped:
+		}
+	}()
+
+	return ctx, stop
+}
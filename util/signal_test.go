@@ -0,0 +1,36 @@
+package util
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignalContext(t *testing.T) {
+	ctx, stop := SignalContext(context.Background())
+	defer stop()
+	require.NoError(t, ctx.Err())
+
+	p, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	err = p.Signal(os.Interrupt)
+	require.NoError(t, err)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("context wasn't cancelled")
+	}
+	require.EqualError(t, context.Cause(ctx), "received signal interrupt")
+}
+
+func TestSignalContextStop(t *testing.T) {
+	ctx, stop := SignalContext(context.Background())
+	stop()
+	stop()
+
+	require.Equal(t, context.Canceled, context.Cause(ctx))
+}
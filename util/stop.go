@@ -5,20 +5,34 @@ import "sync"
 type StopSender struct {
 	shouldStopC chan struct{}
 	wg          *sync.WaitGroup
+	once        *sync.Once
 }
 
 func NewStopSender() *StopSender {
 	return &StopSender{
 		shouldStopC: make(chan struct{}),
 		wg:          &sync.WaitGroup{},
+		once:        &sync.Once{},
 	}
 }
 
-func (ss *StopSender) StopAndWait() {
-	close(ss.shouldStopC)
+// Stop tells the recievers to stop without waiting for them.
+func (ss *StopSender) Stop() {
+	ss.once.Do(func() {
+		close(ss.shouldStopC)
+	})
+}
+
+// Wait blocks until every reciever has called Done.
+func (ss *StopSender) Wait() {
 	ss.wg.Wait()
 }
 
+func (ss *StopSender) StopAndWait() {
+	ss.Stop()
+	ss.Wait()
+}
+
 func (ss *StopSender) NewReciever() *StopReciever {
 	ss.wg.Add(1)
 	return &StopReciever{
@@ -38,3 +38,29 @@ func TestStop(t *testing.T) {
 	shouldContinue = stopReciever.ShouldContinue()
 	require.False(t, shouldContinue)
 }
+
+func TestStopThenWait(t *testing.T) {
+	stopSender := NewStopSender()
+	stopReciever := stopSender.NewReciever()
+
+	stopSender.Stop()
+	stopSender.Stop()
+	require.True(t, stopReciever.ShouldStop())
+
+	ch := make(chan struct{})
+	go func() {
+		stopSender.Wait()
+		close(ch)
+	}()
+
+	select {
+	case <-ch:
+		require.FailNow(t, "Wait returned before the reciever was done")
+	default:
+	}
+
+	stopReciever.Done()
+	<-ch
+
+	stopSender.StopAndWait()
+}
@@ -0,0 +1,184 @@
+// Package websocket implements the parts of RFC 6455 the test server and load generator need.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	OpText   = 0x1
+	OpBinary = 0x2
+	OpClose  = 0x8
+	OpPing   = 0x9
+	OpPong   = 0xa
+)
+
+const MaxMessageSize = 1 << 20
+
+const CloseNormal = 1000
+
+// ErrClosed is returned by ReadMessage after the peer closed the connection.
+var ErrClosed = errors.New("websocket closed by peer")
+
+// Conn is a WebSocket connection; one goroutine can read while others write.
+type Conn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	client bool
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+func newConn(conn net.Conn, r *bufio.Reader, client bool) *Conn {
+	return &Conn{
+		conn:   conn,
+		r:      r,
+		client: client,
+	}
+}
+
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	return c.writeFrame(opcode, data)
+}
+
+func (c *Conn) writeFrame(opcode int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return errors.New("websocket is closing")
+	}
+	if opcode == OpClose {
+		c.closeSent = true
+	}
+
+	header := []byte{0x80 | byte(opcode), 0}
+	switch {
+	case len(data) < 126:
+		header[1] = byte(len(data))
+	case len(data) <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(data)))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(len(data)))
+	}
+
+	payload := data
+	if c.client {
+		header[1] |= 0x80
+		// Every frame gets a new random mask.
+		var mask [4]byte
+		_, err := rand.Read(mask[:])
+		if err != nil {
+			return errors.Wrap(err, "generating websocket mask failed")
+		}
+		header = append(header, mask[:]...)
+		payload = make([]byte, len(data))
+		for i := range data {
+			payload[i] = data[i] ^ mask[i%4]
+		}
+	}
+
+	_, err := c.conn.Write(append(header, payload...))
+	if err != nil {
+		return errors.Wrap(err, "writing websocket frame failed")
+	}
+	return nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings and closes.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	for {
+		opcode, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case OpText, OpBinary:
+			return opcode, data, nil
+		case OpPing:
+			err = c.writeFrame(OpPong, data)
+			if err != nil {
+				return 0, nil, err
+			}
+		case OpPong:
+		case OpClose:
+			_ = c.writeFrame(OpClose, data)
+			return 0, nil, ErrClosed
+		default:
+			return 0, nil, errors.Errorf("unsupported websocket opcode %#x", opcode)
+		}
+	}
+}
+
+func (c *Conn) readFrame() (int, []byte, error) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(c.r, header)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "reading websocket frame failed")
+	}
+
+	if header[0]&0x80 == 0 {
+		return 0, nil, errors.New("fragmented websocket messages aren't supported")
+	}
+	opcode := int(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return 0, nil, errors.Wrap(err, "reading websocket frame failed")
+		}
+		size = uint64(binary.BigEndian.Uint16(b))
+	case 127:
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return 0, nil, errors.Wrap(err, "reading websocket frame failed")
+		}
+		size = binary.BigEndian.Uint64(b)
+	}
+	if size > MaxMessageSize {
+		return 0, nil, errors.Errorf("websocket message of %d bytes is larger than %d", size, MaxMessageSize)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+			return 0, nil, errors.Wrap(err, "reading websocket frame failed")
+		}
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return 0, nil, errors.Wrap(err, "reading websocket frame failed")
+	}
+	if masked {
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+
+	return opcode, data, nil
+}
+
+// Close sends a close frame, if one wasn't sent yet, and closes the connection.
+func (c *Conn) Close(code int) error {
+	_ = c.writeFrame(OpClose, binary.BigEndian.AppendUint16(nil, uint16(code)))
+	return c.conn.Close()
+}
@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newEchoServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.NetConn().Close()
+
+		for {
+			opcode, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(data) == "close" {
+				conn.Close(CloseNormal)
+				return
+			}
+			require.NoError(t, conn.WriteMessage(opcode, data))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dial(t *testing.T, server *httptest.Server) *Conn {
+	u, err := url.Parse(strings.Replace(server.URL, "http", "ws", 1) + "/echo")
+	require.NoError(t, err)
+	netConn, err := net.Dial("tcp", u.Host)
+	require.NoError(t, err)
+
+	conn, err := Handshake(context.Background(), netConn, u)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.NetConn().Close() })
+	return conn
+}
+
+func TestEcho(t *testing.T) {
+	conn := dial(t, newEchoServer(t))
+
+	for _, size := range []int{0, 5, 125, 126, 70000} {
+		msg := bytes.Repeat([]byte("a"), size)
+		require.NoError(t, conn.WriteMessage(OpBinary, msg))
+		opcode, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, OpBinary, opcode)
+		require.Equal(t, msg, data)
+	}
+
+	// Pings are answered by the reader, and don't surface as messages.
+	require.NoError(t, conn.writeFrame(OpPing, []byte("ping")))
+	require.NoError(t, conn.WriteMessage(OpText, []byte("hello")))
+	opcode, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, OpText, opcode)
+	require.Equal(t, "hello", string(data))
+}
+
+func TestServerClose(t *testing.T) {
+	conn := dial(t, newEchoServer(t))
+
+	require.NoError(t, conn.WriteMessage(OpText, []byte("close")))
+	_, _, err := conn.ReadMessage()
+	require.Equal(t, ErrClosed, err)
+
+	// The close was answered, so nothing can be sent anymore.
+	require.Error(t, conn.WriteMessage(OpText, []byte("hello")))
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	netConn, err := net.Dial("tcp", u.Host)
+	require.NoError(t, err)
+	defer netConn.Close()
+
+	_, err = Handshake(context.Background(), netConn, u)
+	require.Equal(t, &HandshakeError{StatusCode: http.StatusNotFound}, err)
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	server := newEchoServer(t)
+
+	for _, test := range []struct {
+		name    string
+		key     string
+		version string
+		status  int
+	}{
+		{"no key", "", "13", http.StatusBadRequest},
+		{"short key", "c2hvcnQ=", "13", http.StatusBadRequest},
+		{"old version", "dGhlIHNhbXBsZSBub25jZQ==", "8", http.StatusUpgradeRequired},
+		{"no version", "dGhlIHNhbXBsZSBub25jZQ==", "", http.StatusUpgradeRequired},
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Key", test.key)
+		req.Header.Set("Sec-WebSocket-Version", test.version)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, test.status, resp.StatusCode, test.name)
+		if test.status == http.StatusUpgradeRequired {
+			require.Equal(t, "13", resp.Header.Get("Sec-WebSocket-Version"), test.name)
+		}
+	}
+}
+
+func TestHandshakeKey(t *testing.T) {
+	var mu sync.Mutex
+	keys := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys[r.Header.Get("Sec-WebSocket-Key")] = true
+		mu.Unlock()
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		conn.NetConn().Close()
+	}))
+	defer server.Close()
+
+	dial(t, server)
+	dial(t, server)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, keys, 2)
+}
+
+func TestFrameMask(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := newConn(client, nil, true)
+
+	masks := make(chan []byte, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			// A masked frame of "hello" is 2 header bytes, the mask and
+			// the payload.
+			frame := make([]byte, 2+4+5)
+			_, err := io.ReadFull(server, frame)
+			if err != nil {
+				close(masks)
+				return
+			}
+			masks <- frame[2:6]
+		}
+	}()
+
+	require.NoError(t, conn.WriteMessage(OpText, []byte("hello")))
+	require.NoError(t, conn.WriteMessage(OpText, []byte("hello")))
+	require.NotEqual(t, <-masks, <-masks)
+}
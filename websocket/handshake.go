@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	version = "13"
+	keyLen  = 16
+)
+
+func newKey() (string, error) {
+	b := make([]byte, keyLen)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "generating websocket key failed")
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContains(header http.Header, name, value string) bool {
+	for _, v := range header.Values(name) {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade completes the handshake of r; on error it has responded to r.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-Websocket-Key")
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != version {
+		w.Header().Set("Sec-WebSocket-Version", version)
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.Errorf("unsupported websocket version %q", r.Header.Get("Sec-Websocket-Version"))
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != keyLen {
+		http.Error(w, "invalid websocket key", http.StatusBadRequest)
+		return nil, errors.Errorf("invalid websocket key %q", key)
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("response writer can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "hijacking connection failed")
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	_, err = conn.Write([]byte(response))
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "writing handshake response failed")
+	}
+
+	return newConn(conn, rw.Reader, false), nil
+}
+
+// Handshake sends the opening handshake for u over conn and returns the WebSocket connection.
+func Handshake(ctx context.Context, conn net.Conn, u *url.URL) (*Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {version},
+		},
+	}
+	err = req.Write(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "writing handshake request failed")
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading handshake response failed")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, &HandshakeError{StatusCode: resp.StatusCode}
+	}
+	if resp.Header.Get("Sec-Websocket-Accept") != acceptKey(key) {
+		return nil, errors.New("handshake response has the wrong accept key")
+	}
+
+	return newConn(conn, r, true), nil
+}
+
+// HandshakeError is returned by Handshake when the server didn't switch protocols.
+type HandshakeError struct {
+	StatusCode int
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("websocket handshake failed with status %d", e.StatusCode)
+}
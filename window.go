@@ -0,0 +1,133 @@
+package webservice_benchmarks
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rollingWindow keeps the outcomes of the requests that ended in the last window.
+type rollingWindow struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	buckets []*windowBucket
+}
+
+type windowBucket struct {
+	second          int64
+	latencies       []time.Duration
+	failures        int
+	errorCategories map[string]int
+}
+
+// windowStats summarizes the requests in a rollingWindow, like RunStats.
+type windowStats struct {
+	Requests        int
+	Failures        int
+	ErrorRate       float64
+	P50             time.Duration
+	P90             time.Duration
+	P99             time.Duration
+	Rate            float64
+	Throughput      float64
+	ErrorCategories map[string]int
+}
+
+func newRollingWindow(window time.Duration) *rollingWindow {
+	return &rollingWindow{
+		window: window,
+	}
+}
+
+func (w *rollingWindow) add(intendedStart, end time.Time, success bool, errorCategory string) {
+	second := end.Unix()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var bucket *windowBucket
+	for i := len(w.buckets) - 1; i >= 0; i-- {
+		if w.buckets[i].second == second {
+			bucket = w.buckets[i]
+			break
+		}
+		if w.buckets[i].second < second {
+			break
+		}
+	}
+	if bucket == nil {
+		bucket = &windowBucket{second: second}
+		w.buckets = append(w.buckets, bucket)
+		sort.Slice(w.buckets, func(i, j int) bool {
+			return w.buckets[i].second < w.buckets[j].second
+		})
+	}
+
+	bucket.latencies = append(bucket.latencies, end.Sub(intendedStart))
+	if !success {
+		bucket.failures++
+	}
+	if errorCategory != "" {
+		if bucket.errorCategories == nil {
+			bucket.errorCategories = make(map[string]int)
+		}
+		bucket.errorCategories[errorCategory]++
+	}
+}
+
+// stats summarizes the window before now and forgets older buckets.
+func (w *rollingWindow) stats(now time.Time) *windowStats {
+	oldest := now.Add(-w.window).Unix()
+	span := now.Sub(time.Unix(oldest, 0)).Seconds()
+
+	w.mu.Lock()
+	i := 0
+	for i < len(w.buckets) && w.buckets[i].second < oldest {
+		i++
+	}
+	w.buckets = w.buckets[i:]
+
+	latencies := make([]time.Duration, 0)
+	stats := &windowStats{
+		ErrorCategories: make(map[string]int),
+	}
+	for _, bucket := range w.buckets {
+		latencies = append(latencies, bucket.latencies...)
+		stats.Failures += bucket.failures
+		for category, count := range bucket.errorCategories {
+			stats.ErrorCategories[category] += count
+		}
+	}
+	w.mu.Unlock()
+
+	stats.Requests = len(latencies)
+	stats.Rate = float64(stats.Requests) / span
+	stats.Throughput = float64(stats.Requests-stats.Failures) / span
+	if stats.Requests == 0 {
+		return stats
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	stats.ErrorRate = float64(stats.Failures) / float64(stats.Requests)
+	stats.P50 = durationPercentile(latencies, 0.5)
+	stats.P90 = durationPercentile(latencies, 0.9)
+	stats.P99 = durationPercentile(latencies, 0.99)
+
+	return stats
+}
+
+// durationPercentile returns the value at percentile p (0 to 1) of sorted.
+func durationPercentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(float64(len(sorted))*p)) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,38 @@
+package webservice_benchmarks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollingWindow(t *testing.T) {
+	w := newRollingWindow(time.Second * 10)
+	now := time.Unix(1000, 0)
+
+	// Too old to be in the window.
+	w.add(now.Add(-time.Second*21), now.Add(-time.Second*20), false, sqlite.ErrorCategoryTimeout)
+	for i := 0; i < 99; i++ {
+		end := now.Add(-time.Duration(i%5) * time.Second)
+		w.add(end.Add(-time.Millisecond*10), end, true, "")
+	}
+	w.add(now.Add(-time.Second*3), now.Add(-time.Second), false, sqlite.ErrorCategoryConnectionRefused)
+
+	stats := w.stats(now)
+	require.Equal(t, 100, stats.Requests)
+	require.Equal(t, 1, stats.Failures)
+	require.Equal(t, 0.01, stats.ErrorRate)
+	require.Equal(t, time.Millisecond*10, stats.P50)
+	require.Equal(t, time.Millisecond*10, stats.P90)
+	require.Equal(t, time.Millisecond*10, stats.P99)
+	require.Equal(t, 10.0, stats.Rate)
+	require.Equal(t, 9.9, stats.Throughput)
+	require.Equal(t, map[string]int{sqlite.ErrorCategoryConnectionRefused: 1}, stats.ErrorCategories)
+	require.Len(t, w.buckets, 5)
+
+	stats = w.stats(now.Add(time.Minute))
+	require.Equal(t, &windowStats{ErrorCategories: map[string]int{}}, stats)
+	require.Empty(t, w.buckets)
+}
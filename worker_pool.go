@@ -0,0 +1,98 @@
+package webservice_benchmarks
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+)
+
+type workerFunc func(stopReciever *util.StopReciever, workerID int)
+
+// resizeLogInterval is how often at most the pool logs its size.
+const resizeLogInterval = time.Second * 5
+
+// workerPool runs a variable number of workers, each with its own StopSender.
+type workerPool struct {
+	work         workerFunc
+	nextWorkerID int
+	active       []*poolWorker
+	// running counts the workers whose work hasn't returned, including the
+	// stopped ones still finishing their request.
+	running sync.WaitGroup
+
+	loggedSize int
+	loggedTime time.Time
+}
+
+type poolWorker struct {
+	id         int
+	stopSender *util.StopSender
+}
+
+func newWorkerPool(work workerFunc) *workerPool {
+	return &workerPool{
+		work: work,
+	}
+}
+
+func (p *workerPool) size() int {
+	return len(p.active)
+}
+
+func (p *workerPool) resize(numWorkers int) {
+	if numWorkers < 0 {
+		numWorkers = 0
+	}
+	p.logSize(numWorkers)
+
+	for len(p.active) < numWorkers {
+		w := &poolWorker{
+			id:         p.nextWorkerID,
+			stopSender: util.NewStopSender(),
+		}
+		p.nextWorkerID++
+
+		stopReciever := w.stopSender.NewReciever()
+		p.running.Add(1)
+		go func() {
+			defer p.running.Done()
+			p.work(stopReciever, w.id)
+		}()
+		p.active = append(p.active, w)
+	}
+
+	for len(p.active) > numWorkers {
+		last := len(p.active) - 1
+		w := p.active[last]
+		p.active = p.active[:last]
+
+		w.stopSender.Stop()
+	}
+}
+
+// logSize logs the size at most once every resizeLogInterval, and always when stopping.
+func (p *workerPool) logSize(numWorkers int) {
+	if numWorkers == p.loggedSize {
+		return
+	}
+	now := time.Now()
+	if numWorkers > 0 && now.Sub(p.loggedTime) < resizeLogInterval {
+		return
+	}
+	log.Println(fmt.Sprintf("workers: %d -> %d", p.loggedSize, numWorkers))
+	p.loggedSize = numWorkers
+	p.loggedTime = now
+}
+
+// stop tells every worker to stop after its current request.
+func (p *workerPool) stop() {
+	p.resize(0)
+}
+
+// wait blocks until every worker that has been stopped is done.
+func (p *workerPool) wait() {
+	p.running.Wait()
+}
@@ -0,0 +1,34 @@
+package webservice_benchmarks
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jlym/webservice-benchmarks/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPoolResize(t *testing.T) {
+	var running int64
+	pool := newWorkerPool(func(stopReciever *util.StopReciever, workerID int) {
+		defer stopReciever.Done()
+		atomic.AddInt64(&running, 1)
+		defer atomic.AddInt64(&running, -1)
+		<-stopReciever.ShouldStopC
+		time.Sleep(time.Millisecond * 10)
+	})
+
+	for i := 0; i < 100; i++ {
+		pool.resize(5)
+		pool.resize(2)
+	}
+	require.Equal(t, 2, pool.size())
+	require.Equal(t, 302, pool.nextWorkerID)
+	// Only the first resize was logged.
+	require.Equal(t, 5, pool.loggedSize)
+
+	pool.stop()
+	pool.wait()
+	require.Equal(t, int64(0), atomic.LoadInt64(&running))
+}